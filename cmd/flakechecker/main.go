@@ -9,6 +9,7 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/stackrox/junit2jira/pkg/testcase"
+	"github.com/stackrox/junit2jira/pkg/transport"
 	"os"
 )
 
@@ -24,6 +25,7 @@ type flakeCheckerParams struct {
 	junitReportsDir string
 	configFile      string
 	jobName         string
+	transport       transport.Options
 }
 
 func (p *flakeCheckerParams) checkFailedTests(bqClient biqQueryClient, failedTests []testcase.TestCase, flakeCheckerRecs []*flakeDetectionPolicy) error {
@@ -75,7 +77,7 @@ func (p *flakeCheckerParams) run() error {
 		return errors.Wrapf(err, "unable to load config file (%s)", p.configFile)
 	}
 
-	bqClient, err := getNewBigQueryClient()
+	bqClient, err := getNewBigQueryClient(p.transport)
 	if err != nil {
 		return errors.Wrap(err, "unable to create BigQuery client")
 	}
@@ -96,6 +98,7 @@ func main() {
 
 	var debug bool
 	flag.BoolVar(&debug, "debug", false, "Enable debug log level.")
+	p.transport.AddFlags(flag.CommandLine)
 	versioninfo.AddFlag(flag.CommandLine)
 	flag.Parse()
 
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jira "github.com/ctreminiom/go-atlassian/v2/jira/v3"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const (
+	authAuto   = "auto"
+	authBasic  = "basic"
+	authBearer = "bearer"
+	authOAuth  = "oauth"
+	authNetrc  = "netrc"
+
+	defaultOAuthTokenUrl = "https://auth.atlassian.com/oauth/token"
+	authValidateTimeout  = 30 * time.Second
+)
+
+// atlassianApiUrl is the API gateway of Atlassian Cloud. OAuth tokens of service accounts are only accepted there,
+// under /ex/jira/<cloud id>, and not on the site URL.
+var atlassianApiUrl = "https://api.atlassian.com"
+
+// jiraCredentials holds everything needed to authenticate with one of the supported methods.
+type jiraCredentials struct {
+	method string
+
+	user     string
+	token    string
+	bearer   string
+	clientID string
+	secret   string
+	tokenUrl string
+}
+
+// secret returns the value of the environment variable name. If it is not set, the value is read from the file
+// pointed to by name_FILE or from a file called name in the secrets directory (e.g. a mounted Kubernetes secret).
+func secret(name, secretsDir string) (string, error) {
+	if v := os.Getenv(name); v != "" {
+		return v, nil
+	}
+	file := os.Getenv(name + "_FILE")
+	if file == "" && secretsDir != "" {
+		file = filepath.Join(secretsDir, name)
+		if _, err := os.Stat(file); err != nil {
+			return "", nil
+		}
+	}
+	if file == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not read %s", name)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func resolveJiraCredentials(p params) (jiraCredentials, error) {
+	c := jiraCredentials{method: p.jiraAuth}
+	var err error
+	for _, s := range []struct {
+		names  []string
+		target *string
+	}{
+		{[]string{"JIRA_USER"}, &c.user},
+		// JIRA_PASSWORD for backward compatibility
+		{[]string{"JIRA_TOKEN", "JIRA_PASSWORD"}, &c.token},
+		{[]string{"JIRA_BEARER_TOKEN"}, &c.bearer},
+		{[]string{"JIRA_CLIENT_ID"}, &c.clientID},
+		{[]string{"JIRA_CLIENT_SECRET"}, &c.secret},
+		{[]string{"JIRA_OAUTH_TOKEN_URL"}, &c.tokenUrl},
+	} {
+		for _, name := range s.names {
+			if *s.target != "" {
+				break
+			}
+			*s.target, err = secret(name, p.secretsDir)
+			if err != nil {
+				return c, err
+			}
+		}
+	}
+	if c.tokenUrl == "" {
+		c.tokenUrl = defaultOAuthTokenUrl
+	}
+
+	if c.method == authAuto {
+		switch {
+		case c.bearer != "":
+			c.method = authBearer
+		case c.clientID != "":
+			c.method = authOAuth
+		case c.user != "" || c.token != "":
+			c.method = authBasic
+		default:
+			c.method = authNetrc
+		}
+	}
+
+	switch c.method {
+	case authBasic:
+		if c.user == "" || c.token == "" {
+			return c, errors.New("JIRA_USER (email) and JIRA_TOKEN are required for Jira Cloud authentication. Get your API token at https://id.atlassian.com/manage-profile/security/api-tokens or use -offline to run without Jira")
+		}
+	case authBearer:
+		if c.bearer == "" {
+			return c, errors.New("JIRA_BEARER_TOKEN is required for bearer authentication")
+		}
+	case authOAuth:
+		if c.clientID == "" || c.secret == "" {
+			return c, errors.New("JIRA_CLIENT_ID and JIRA_CLIENT_SECRET are required for OAuth 2.0 authentication")
+		}
+	case authNetrc:
+		c.user, c.token, err = netrcCredentials(netrcPath(), p.jiraUrl.Hostname())
+		if err != nil {
+			return c, errors.Wrap(err, "no Jira credentials found in environment, use -offline to run without Jira")
+		}
+	default:
+		return c, fmt.Errorf("unknown Jira authentication method %q", c.method)
+	}
+	return c, nil
+}
+
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".netrc"
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// netrcCredentials returns login and password for the host from a netrc file, falling back to the default entry.
+func netrcCredentials(path, host string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", errors.Wrap(err, "could not read netrc")
+	}
+
+	type entry struct{ login, password string }
+	var current, found, fallback *entry
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			current = nil
+			if i+1 < len(fields) {
+				i++
+				current = &entry{}
+				if fields[i] == host && found == nil {
+					found = current
+				}
+			}
+		case "default":
+			current = &entry{}
+			fallback = current
+		case "login", "password":
+			if i+1 >= len(fields) {
+				break
+			}
+			key := fields[i]
+			i++
+			if current == nil {
+				continue
+			}
+			if key == "login" {
+				current.login = fields[i]
+			} else {
+				current.password = fields[i]
+			}
+		case "account":
+			i++
+		case "macdef":
+			// Macros are not supported and end with an empty line which is lost by strings.Fields.
+			return "", "", errors.New("netrc macdef is not supported")
+		}
+	}
+	if found == nil {
+		found = fallback
+	}
+	if found == nil || found.login == "" || found.password == "" {
+		return "", "", fmt.Errorf("no netrc entry for %s in %s", host, path)
+	}
+	return found.login, found.password, nil
+}
+
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+// oauthClientCredentialsToken exchanges client credentials (e.g. of an Atlassian service account) for an access token.
+func oauthClientCredentialsToken(client *http.Client, tokenUrl, clientID, clientSecret string) (*oauth2.Token, error) {
+	body, err := json.Marshal(map[string]string{
+		"grant_type":    "client_credentials",
+		"client_id":     clientID,
+		"client_secret": clientSecret,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Post(tokenUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not request OAuth token")
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not request OAuth token: HTTP %d", resp.StatusCode)
+	}
+	var token oauthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, errors.Wrap(err, "could not parse OAuth token")
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("OAuth token response has no access token")
+	}
+	log.Debugf("OAuth token expires in %ds", token.ExpiresIn)
+	t := &oauth2.Token{AccessToken: token.AccessToken, TokenType: "Bearer"}
+	if token.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
+
+// oauthTokenSource requests a new token with the client credentials each time it is called. It is wrapped in
+// oauth2.ReuseTokenSource, so that a token is reused until it expires, e.g. during serve-slack.
+type oauthTokenSource struct {
+	client                           *http.Client
+	tokenUrl, clientID, clientSecret string
+}
+
+func (s oauthTokenSource) Token() (*oauth2.Token, error) {
+	return oauthClientCredentialsToken(s.client, s.tokenUrl, s.clientID, s.clientSecret)
+}
+
+// oauthApiUrl returns the API gateway URL of the Jira site. A -jira-url already pointing to the gateway is kept.
+func oauthApiUrl(client *http.Client, site *url.URL) (string, error) {
+	if strings.HasPrefix(site.Path, "/ex/jira/") {
+		return site.String(), nil
+	}
+	resp, err := client.Get(site.JoinPath("_edge/tenant_info").String())
+	if err != nil {
+		return "", errors.Wrap(err, "could not get cloud ID of Jira")
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get cloud ID of Jira: HTTP %d", resp.StatusCode)
+	}
+	var tenant struct {
+		CloudID string `json:"cloudId"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tenant); err != nil {
+		return "", errors.Wrap(err, "could not parse cloud ID of Jira")
+	}
+	if tenant.CloudID == "" {
+		return "", errors.New("Jira tenant info has no cloud ID")
+	}
+	return atlassianApiUrl + "/ex/jira/" + url.PathEscape(tenant.CloudID), nil
+}
+
+func newJiraClient(p params) (*jira.Client, error) {
+	creds, err := resolveJiraCredentials(p)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := p.transport.NewClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create HTTP client")
+	}
+
+	apiUrl := p.jiraUrl.String()
+	if creds.method == authOAuth {
+		source := oauth2.ReuseTokenSource(nil, oauthTokenSource{
+			client:       httpClient,
+			tokenUrl:     creds.tokenUrl,
+			clientID:     creds.clientID,
+			clientSecret: creds.secret,
+		})
+		// Request the first token now to report wrong client credentials as such.
+		if _, err := source.Token(); err != nil {
+			return nil, err
+		}
+		apiUrl, err = oauthApiUrl(httpClient, p.jiraUrl)
+		if err != nil {
+			return nil, err
+		}
+		httpClient = &http.Client{
+			Transport: &oauth2.Transport{Source: source, Base: httpClient.Transport},
+			Timeout:   httpClient.Timeout,
+		}
+	}
+
+	jiraClient, err := jira.New(httpClient, apiUrl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create client for %s", apiUrl)
+	}
+
+	switch creds.method {
+	case authBasic:
+		jiraClient.Auth.SetBasicAuth(creds.user, creds.token)
+		log.Info("Using Basic Auth (email + API token)")
+	case authNetrc:
+		jiraClient.Auth.SetBasicAuth(creds.user, creds.token)
+		log.Info("Using Basic Auth from netrc")
+	case authBearer:
+		jiraClient.Auth.SetBearerToken(creds.bearer)
+		log.Info("Using Bearer Auth (personal access token)")
+	case authOAuth:
+		log.Infof("Using OAuth 2.0 (client credentials) through %s", apiUrl)
+	}
+
+	if err := validateJiraAuth(jiraClient); err != nil {
+		return nil, err
+	}
+	return jiraClient, nil
+}
+
+// validateJiraAuth makes sure the credentials work before any work starts.
+func validateJiraAuth(jiraClient *jira.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), authValidateTimeout)
+	defer cancel()
+
+	user, response, err := jiraClient.MySelf.Details(ctx, nil)
+	if err != nil {
+		logError(err, response)
+		return errors.Wrap(err, "could not authenticate with Jira")
+	}
+	log.Infof("Authenticated as %s", user.DisplayName)
+	return nil
+}
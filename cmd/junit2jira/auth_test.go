@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clearJiraEnv(t *testing.T) {
+	for _, name := range []string{"JIRA_USER", "JIRA_TOKEN", "JIRA_PASSWORD", "JIRA_BEARER_TOKEN", "JIRA_CLIENT_ID", "JIRA_CLIENT_SECRET", "JIRA_OAUTH_TOKEN_URL"} {
+		t.Setenv(name, "")
+		t.Setenv(name+"_FILE", "")
+	}
+	t.Setenv("NETRC", filepath.Join(t.TempDir(), "missing"))
+}
+
+// newFakeJira returns a Jira stand-in accepting only the given Authorization header.
+// Routes map "METHOD path" to the JSON response body.
+func newFakeJira(t *testing.T, authorization string, routes map[string]string) *url.URL {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Serve the API gateway path of OAuth clients like the site.
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/ex/jira/cloud-id")
+		switch {
+		case r.URL.Path == "/_edge/tenant_info":
+			_, _ = w.Write([]byte(`{"cloudId":"cloud-id"}`))
+		case r.URL.Path == "/oauth/token":
+			var body map[string]string
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			if body["client_id"] != "id" || body["client_secret"] != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"oauth-token","expires_in":3600}`))
+		case r.Header.Get("Authorization") != authorization:
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/rest/api/3/myself":
+			_, _ = w.Write([]byte(`{"displayName":"CI Bot"}`))
+		case routes[r.Method+" "+r.URL.Path] != "":
+			_, _ = w.Write([]byte(routes[r.Method+" "+r.URL.Path]))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return u
+}
+
+func TestNewJiraClient(t *testing.T) {
+	t.Run("basic", func(t *testing.T) {
+		clearJiraEnv(t)
+		t.Setenv("JIRA_USER", "user@example.com")
+		t.Setenv("JIRA_PASSWORD", "token")
+		u := newFakeJira(t, "Basic dXNlckBleGFtcGxlLmNvbTp0b2tlbg==", nil)
+		_, err := newJiraClient(params{jiraUrl: u, jiraAuth: authAuto})
+		assert.NoError(t, err)
+	})
+	t.Run("basic with token file", func(t *testing.T) {
+		clearJiraEnv(t)
+		file := filepath.Join(t.TempDir(), "token")
+		require.NoError(t, os.WriteFile(file, []byte("token\n"), 0600))
+		t.Setenv("JIRA_USER", "user@example.com")
+		t.Setenv("JIRA_TOKEN_FILE", file)
+		u := newFakeJira(t, "Basic dXNlckBleGFtcGxlLmNvbTp0b2tlbg==", nil)
+		_, err := newJiraClient(params{jiraUrl: u, jiraAuth: authBasic})
+		assert.NoError(t, err)
+	})
+	t.Run("bearer from secrets dir", func(t *testing.T) {
+		clearJiraEnv(t)
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "JIRA_BEARER_TOKEN"), []byte("pat"), 0600))
+		u := newFakeJira(t, "Bearer pat", nil)
+		_, err := newJiraClient(params{jiraUrl: u, jiraAuth: authAuto, secretsDir: dir})
+		assert.NoError(t, err)
+	})
+	t.Run("oauth", func(t *testing.T) {
+		clearJiraEnv(t)
+		u := newFakeJira(t, "Bearer oauth-token", nil)
+		defer func(api string) { atlassianApiUrl = api }(atlassianApiUrl)
+		atlassianApiUrl = u.String()
+		t.Setenv("JIRA_CLIENT_ID", "id")
+		t.Setenv("JIRA_CLIENT_SECRET", "secret")
+		t.Setenv("JIRA_OAUTH_TOKEN_URL", u.JoinPath("oauth/token").String())
+		_, err := newJiraClient(params{jiraUrl: u, jiraAuth: authAuto})
+		assert.NoError(t, err)
+
+		t.Setenv("JIRA_CLIENT_SECRET", "wrong")
+		_, err = newJiraClient(params{jiraUrl: u, jiraAuth: authOAuth})
+		assert.EqualError(t, err, "could not request OAuth token: HTTP 401")
+	})
+	t.Run("netrc", func(t *testing.T) {
+		clearJiraEnv(t)
+		u := newFakeJira(t, "Basic dXNlckBleGFtcGxlLmNvbTp0b2tlbg==", nil)
+		netrc := filepath.Join(t.TempDir(), ".netrc")
+		require.NoError(t, os.WriteFile(netrc, []byte("machine other login a password b\nmachine "+u.Hostname()+"\n  login user@example.com\n  password token\n"), 0600))
+		t.Setenv("NETRC", netrc)
+		_, err := newJiraClient(params{jiraUrl: u, jiraAuth: authAuto})
+		assert.NoError(t, err)
+	})
+	t.Run("invalid credentials are rejected before any work", func(t *testing.T) {
+		clearJiraEnv(t)
+		t.Setenv("JIRA_BEARER_TOKEN", "wrong")
+		u := newFakeJira(t, "Bearer pat", nil)
+		_, err := newJiraClient(params{jiraUrl: u, jiraAuth: authBearer})
+		assert.ErrorContains(t, err, "could not authenticate with Jira")
+	})
+	t.Run("missing credentials", func(t *testing.T) {
+		clearJiraEnv(t)
+		u := newFakeJira(t, "", nil)
+		_, err := newJiraClient(params{jiraUrl: u, jiraAuth: authAuto})
+		assert.ErrorContains(t, err, "no Jira credentials found in environment")
+		_, err = newJiraClient(params{jiraUrl: u, jiraAuth: authBasic})
+		assert.ErrorContains(t, err, "JIRA_USER (email) and JIRA_TOKEN are required")
+		_, err = newJiraClient(params{jiraUrl: u, jiraAuth: "kerberos"})
+		assert.EqualError(t, err, `unknown Jira authentication method "kerberos"`)
+	})
+}
+
+func TestOAuthJiraClient(t *testing.T) {
+	clearJiraEnv(t)
+	var paths []string
+	tokens := 0
+	expiresIn := 3600
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/oauth/token":
+			tokens++
+			_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":%d}`, tokens, expiresIn)
+		case "/site/_edge/tenant_info":
+			_, _ = w.Write([]byte(`{"cloudId":"cloud-id"}`))
+		case "/ex/jira/cloud-id/rest/api/3/myself":
+			assert.Equal(t, fmt.Sprintf("Bearer token-%d", tokens), r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"displayName":"Service Account"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defer func(api string) { atlassianApiUrl = api }(atlassianApiUrl)
+	atlassianApiUrl = server.URL
+	t.Setenv("JIRA_CLIENT_ID", "id")
+	t.Setenv("JIRA_CLIENT_SECRET", "secret")
+	t.Setenv("JIRA_OAUTH_TOKEN_URL", server.URL+"/oauth/token")
+	site, err := url.Parse(server.URL + "/site/")
+	require.NoError(t, err)
+
+	t.Run("site URL is resolved to the API gateway", func(t *testing.T) {
+		paths, tokens = nil, 0
+		jiraClient, err := newJiraClient(params{jiraUrl: site, jiraAuth: authOAuth})
+		require.NoError(t, err)
+		require.NoError(t, validateJiraAuth(jiraClient))
+		assert.Equal(t, []string{"/oauth/token", "/site/_edge/tenant_info", "/ex/jira/cloud-id/rest/api/3/myself", "/ex/jira/cloud-id/rest/api/3/myself"}, paths)
+	})
+	t.Run("gateway URL is kept", func(t *testing.T) {
+		paths, tokens = nil, 0
+		gateway, err := url.Parse(server.URL + "/ex/jira/cloud-id/")
+		require.NoError(t, err)
+		_, err = newJiraClient(params{jiraUrl: gateway, jiraAuth: authOAuth})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/oauth/token", "/ex/jira/cloud-id/rest/api/3/myself"}, paths)
+	})
+	t.Run("expired token is refreshed", func(t *testing.T) {
+		paths, tokens = nil, 0
+		expiresIn = 1
+		jiraClient, err := newJiraClient(params{jiraUrl: site, jiraAuth: authOAuth})
+		require.NoError(t, err)
+		require.NoError(t, validateJiraAuth(jiraClient))
+		assert.Equal(t, 3, tokens)
+	})
+}
+
+func TestNetrcCredentials(t *testing.T) {
+	netrc := filepath.Join(t.TempDir(), ".netrc")
+	require.NoError(t, os.WriteFile(netrc, []byte("machine a.example.com login a password pa account x\ndefault login d password pd\n"), 0600))
+
+	login, password, err := netrcCredentials(netrc, "a.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "a", login)
+	assert.Equal(t, "pa", password)
+
+	login, password, err = netrcCredentials(netrc, "b.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "d", login)
+	assert.Equal(t, "pd", password)
+
+	require.NoError(t, os.WriteFile(netrc, []byte("machine a.example.com login a\n"), 0600))
+	_, _, err = netrcCredentials(netrc, "a.example.com")
+	assert.ErrorContains(t, err, "no netrc entry for a.example.com")
+}
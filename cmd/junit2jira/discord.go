@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	discordWebhookEnv = "DISCORD_WEBHOOK_URL"
+	discordColor      = 0xbb2124
+	// Limits of Discord embeds, in characters.
+	discordTitleLimit       = 256
+	discordDescriptionLimit = 4096
+	discordFieldValueLimit  = 1024
+	discordMaxFields        = 25
+	discordMaxEmbeds        = 10
+	discordMaxMessageSize   = 6000
+	// discordOutputLimit keeps the message and the error of a failure within one description.
+	discordOutputLimit = 1800
+)
+
+// discordNotifier renders the digest as embeds for Discord webhooks.
+type discordNotifier struct{}
+
+type discordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds"`
+	// AllowedMentions keeps test output from notifying users or roles.
+	AllowedMentions discordAllowedMentions `json:"allowed_mentions"`
+}
+
+type discordAllowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// size is the number of characters Discord counts against the limit of a message.
+func (e discordEmbed) size() int {
+	n := utf8.RuneCountInString(e.Title) + utf8.RuneCountInString(e.Description)
+	for _, f := range e.Fields {
+		n += utf8.RuneCountInString(f.Name) + utf8.RuneCountInString(f.Value)
+	}
+	return n
+}
+
+func (discordNotifier) name() string {
+	return "discord"
+}
+
+func (discordNotifier) webhookEnv() string {
+	return discordWebhookEnv
+}
+
+func (discordNotifier) render(d chatDigest) []any {
+	digest := discordEmbed{Title: "Failed tests", URL: d.buildLink, Color: discordColor}
+	description := []string{d.buildContext(markdownEscape, markdownLink)}
+	if d.more > 0 {
+		description = append(description, d.moreText(markdownLink))
+	}
+	digest.Description = strings.TrimSpace(strings.Join(description, "\n"))
+
+	fields := []discordField{
+		{Name: "Failed", Value: fmt.Sprint(d.failed), Inline: true},
+		{Name: "New issues", Value: fmt.Sprint(d.newIssues), Inline: true},
+		{Name: "Existing issues", Value: fmt.Sprint(d.existingIssues), Inline: true},
+	}
+	if d.total > 0 {
+		fields = append([]discordField{{Name: "Total", Value: fmt.Sprint(d.total), Inline: true}}, fields...)
+	}
+	for _, suite := range d.suites {
+		var lines []string
+		for _, f := range suite.failures {
+			lines = append(lines, "• "+f.line(markdownEscape, markdownLink))
+		}
+		for _, text := range joinLines(lines, discordFieldValueLimit) {
+			fields = append(fields, discordField{Name: crop(orDefault(suite.name, "No suite"), discordTitleLimit), Value: text})
+		}
+	}
+
+	// Fields that do not fit in the digest continue in embeds without a title.
+	var embeds []discordEmbed
+	for n, part := range splitBySize(fields, discordMaxMessageSize-digest.size(), discordMaxFields) {
+		embed := discordEmbed{Color: discordColor, Fields: part}
+		if n == 0 {
+			embed.Title, embed.URL, embed.Description = digest.Title, digest.URL, digest.Description
+		}
+		embeds = append(embeds, embed)
+	}
+
+	for _, f := range d.details {
+		message, value := failureTexts(f.testCase, discordOutputLimit)
+		if message == "" && value == "" {
+			continue
+		}
+		embed := discordEmbed{Title: crop(f.title(), discordTitleLimit), URL: f.issueURL, Color: discordColor}
+		var blocks []string
+		for _, text := range []string{message, value} {
+			if text != "" {
+				blocks = append(blocks, discordCodeBlock(text))
+			}
+		}
+		embed.Description = crop(strings.Join(blocks, "\n"), discordDescriptionLimit)
+		embeds = append(embeds, embed)
+	}
+
+	var messages []any
+	var current []discordEmbed
+	size := 0
+	for _, e := range embeds {
+		if len(current) > 0 && (len(current) >= discordMaxEmbeds || size+e.size() > discordMaxMessageSize) {
+			messages = append(messages, discordMessage{Embeds: current, AllowedMentions: discordAllowedMentions{Parse: []string{}}})
+			current, size = nil, 0
+		}
+		current = append(current, e)
+		size += e.size()
+	}
+	if len(current) > 0 {
+		messages = append(messages, discordMessage{Embeds: current, AllowedMentions: discordAllowedMentions{Parse: []string{}}})
+	}
+	if len(messages) > 0 {
+		first := messages[0].(discordMessage)
+		first.Content = d.text()
+		messages[0] = first
+	}
+	return messages
+}
+
+// discordCodeBlock shows text as is, with fences in the text broken up so that they do not end the block.
+func discordCodeBlock(text string) string {
+	return "```\n" + strings.ReplaceAll(text, "```", "`\u200b``") + "\n```"
+}
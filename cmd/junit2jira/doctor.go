@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	jira "github.com/ctreminiom/go-atlassian/v2/jira/v3"
+	"github.com/pkg/errors"
+	"github.com/stackrox/junit2jira/pkg/testcase"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	checkPass = "PASS"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+
+	doctorCheckTimeout = 30 * time.Second
+)
+
+type checkResult struct {
+	name    string
+	status  string
+	details string
+}
+
+// doctor runs preflight checks of the configuration without filing anything.
+type doctor struct {
+	params
+	jiraClient *jira.Client
+	results    []checkResult
+}
+
+func (d *doctor) check(name string, f func() (string, error)) bool {
+	details, err := f()
+	if err != nil {
+		d.results = append(d.results, checkResult{name: name, status: checkFail, details: err.Error()})
+		return false
+	}
+	d.results = append(d.results, checkResult{name: name, status: checkPass, details: details})
+	return true
+}
+
+func (d *doctor) skip(name, reason string) {
+	d.results = append(d.results, checkResult{name: name, status: checkSkip, details: reason})
+}
+
+func runDoctor(p params, out io.Writer) error {
+	d := &doctor{params: p}
+	d.checkConfiguration()
+	d.checkRoutingFiles()
+	d.checkJira()
+	d.checkReports()
+	d.checkOutputs()
+	d.checkHtmlTemplate()
+	d.checkChatWebhooks()
+	d.checkWebhook()
+	d.checkSMTP()
+	d.checkGitHub()
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "CHECK\tRESULT\tDETAILS")
+	failed := 0
+	for _, r := range d.results {
+		if r.status == checkFail {
+			failed++
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", r.name, r.status, r.details)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(d.results))
+	}
+	return nil
+}
+
+func (d *doctor) checkConfiguration() {
+	d.check("configuration", func() (string, error) {
+		if err := validateHookParams(d.params); err != nil {
+			return "", err
+		}
+		if err := validateHistoryParams(d.params); err != nil {
+			return "", err
+		}
+		if err := validateSlackParams(d.params); err != nil {
+			return "", err
+		}
+		if err := validateChatParams(d.params); err != nil {
+			return "", err
+		}
+		if err := validateWebhookParams(d.params); err != nil {
+			return "", err
+		}
+		if err := validateEmailParams(d.params); err != nil {
+			return "", err
+		}
+		if err := validateHtmlParams(d.params); err != nil {
+			return "", err
+		}
+		if err := validateGitHubParams(d.params); err != nil {
+			return "", err
+		}
+		if err := validateStdoutParams(d.params); err != nil {
+			return "", err
+		}
+		if _, err := newRedactor(d.redactPatterns); err != nil {
+			return "", err
+		}
+		if _, err := newExcerpter(d.excerptMarkers, d.excerptContext); err != nil {
+			return "", err
+		}
+		if d.policyFile != "" {
+			policies, err := loadFilingPolicyFile(d.policyFile)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d policy rules", len(policies)), nil
+		}
+		return "ok", nil
+	})
+}
+
+func (d *doctor) checkRoutingFiles() {
+	if d.slackRoutingFile != "" {
+		d.check("slack routing", func() (string, error) {
+			routes, err := loadSlackRoutingFile(d.slackRoutingFile)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d routes", len(routes)), nil
+		})
+	}
+	if d.emailRoutingFile != "" {
+		d.check("email routing", func() (string, error) {
+			routes, err := loadEmailRoutingFile(d.emailRoutingFile)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d routes", len(routes)), nil
+		})
+	}
+}
+
+func (d *doctor) checkJira() {
+	checks := []string{"jira credentials", "jira project", "jira issue type", "jira label", "jira link type", "jira search"}
+	if d.offline {
+		for _, name := range checks {
+			d.skip(name, "offline mode")
+		}
+		return
+	}
+
+	ok := d.check("jira credentials", func() (string, error) {
+		creds, err := resolveJiraCredentials(d.params)
+		if err != nil {
+			return "", err
+		}
+		d.jiraClient, err = newJiraClient(d.params)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s auth for %s", creds.method, d.jiraUrl), nil
+	})
+	if !ok {
+		for _, name := range checks[1:] {
+			d.skip(name, "no Jira client")
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), doctorCheckTimeout)
+	defer cancel()
+
+	d.check("jira project", func() (string, error) {
+		project, _, err := d.jiraClient.Project.Get(ctx, d.jiraProject, nil)
+		if err != nil {
+			return "", errors.Wrapf(err, "project %s not found", d.jiraProject)
+		}
+		return fmt.Sprintf("%s (%s)", project.Key, project.Name), nil
+	})
+
+	var issueTypeID string
+	ok = d.check("jira issue type", func() (string, error) {
+		issueTypes, _, err := d.jiraClient.Issue.Metadata.FetchIssueMappings(ctx, d.jiraProject, 0, 100)
+		if err != nil {
+			return "", errors.Wrap(err, "could not get issue types")
+		}
+		issueTypeID = findInPage(issueTypes, "issueTypes", fmt.Sprintf("#(name==%q).id", issueTypeName)).String()
+		if issueTypeID == "" {
+			return "", fmt.Errorf("%s issues cannot be created in %s", issueTypeName, d.jiraProject)
+		}
+		return fmt.Sprintf("%s can be created", issueTypeName), nil
+	})
+
+	if ok {
+		d.check("jira label", func() (string, error) {
+			fields, _, err := d.jiraClient.Issue.Metadata.FetchFieldMappings(ctx, d.jiraProject, issueTypeID, 0, 200)
+			if err != nil {
+				return "", errors.Wrap(err, "could not get fields")
+			}
+			if !findInPage(fields, "fields", `#(fieldId=="labels")`).Exists() {
+				return "", fmt.Errorf("labels cannot be set on %s issues, %s will be missing", issueTypeName, ciFailureLabel)
+			}
+			return fmt.Sprintf("%s can be set", ciFailureLabel), nil
+		})
+	} else {
+		d.skip("jira label", "issue type not available")
+	}
+
+	d.check("jira link type", func() (string, error) {
+		linkTypes, _, err := d.jiraClient.Issue.Link.Type.Gets(ctx)
+		if err != nil {
+			return "", errors.Wrap(err, "could not get link types")
+		}
+		for _, t := range linkTypes.IssueLinkTypes {
+			if t.Name == linkType {
+				return fmt.Sprintf("%s exists", linkType), nil
+			}
+		}
+		return "", fmt.Errorf("link type %s does not exist", linkType)
+	})
+
+	d.check("jira search", func() (string, error) {
+		_, _, err := d.jiraClient.Issue.Search.SearchJQL(ctx, fmt.Sprintf(jql, d.jiraProject, "junit2jira doctor"), []string{"summary"}, nil, 1, "")
+		if err != nil {
+			return "", errors.Wrap(err, "could not search")
+		}
+		return "ok", nil
+	})
+}
+
+func (d *doctor) checkReports() {
+	d.check("junit reports", func() (string, error) {
+		if d.junitReportsDir == "" {
+			return "", errors.New("no reports dir set, use -junit-reports-dir or ARTIFACT_DIR")
+		}
+		suites, err := testcase.LoadTestSuites(d.junitReportsDir)
+		if err != nil {
+			return "", err
+		}
+		if len(suites) == 0 {
+			return "", fmt.Errorf("no test suites found in %s", d.junitReportsDir)
+		}
+		return fmt.Sprintf("%d test suites in %s", len(suites), d.junitReportsDir), nil
+	})
+}
+
+func (d *doctor) checkOutputs() {
+	for _, o := range []struct {
+		name string
+		path string
+	}{
+		{"csv output", d.csvOutput},
+		{"discord output", d.discordOutput},
+		{"google chat output", d.googleChatOutput},
+		{"html output", d.htmlOutput},
+		{"markdown output", d.markdownOutput},
+		{"slack output", d.slackOutput},
+		{"summary output", d.summaryOutput},
+		{"teams output", d.teamsOutput},
+	} {
+		if o.path == "" {
+			continue
+		}
+		d.check(o.name, func() (string, error) {
+			if o.path == "-" {
+				return "stdout", nil
+			}
+			return o.path, checkWritable(o.path)
+		})
+	}
+}
+
+func (d *doctor) checkHtmlTemplate() {
+	if d.htmlTemplate == "" {
+		return
+	}
+	d.check("html template", func() (string, error) {
+		_, err := loadHtmlTemplate(d.htmlTemplate)
+		return d.htmlTemplate, err
+	})
+}
+
+// checkChatWebhooks verifies the webhook URL of each -chat-webhook is set, without posting to it.
+func (d *doctor) checkChatWebhooks() {
+	for _, n := range notifiers {
+		if !slices.Contains(d.chatWebhooks, n.name()) {
+			continue
+		}
+		d.check(n.name()+" webhook", func() (string, error) {
+			webhook, err := secret(n.webhookEnv(), d.secretsDir)
+			if err != nil {
+				return "", err
+			}
+			if webhook == "" {
+				return "", fmt.Errorf("%s is required to post to %s", n.webhookEnv(), n.name())
+			}
+			return n.webhookEnv() + " is set", nil
+		})
+	}
+}
+
+// checkWebhook parses the webhook template and verifies the webhook can be written or its headers are set,
+// without posting to it.
+func (d *doctor) checkWebhook() {
+	if d.webhook == "" || d.webhookTemplate == "" {
+		return
+	}
+	d.check("webhook", func() (string, error) {
+		if _, err := loadWebhookTemplate(d.webhookTemplate); err != nil {
+			return "", err
+		}
+		switch {
+		case d.webhook == "-":
+			return "stdout", nil
+		case isURL(d.webhook):
+			if _, err := (junit2jira{params: d.params}).webhookHeader(nil); err != nil {
+				return "", err
+			}
+			u, err := url.Parse(d.webhook)
+			if err != nil {
+				return "", errors.Wrap(withoutWebhookURL(err, d.webhook), "invalid webhook URL")
+			}
+			return "posts to " + u.Host, nil
+		default:
+			return d.webhook, checkWritable(d.webhook)
+		}
+	})
+}
+
+// checkSMTP opens a session with the SMTP server, including TLS and authentication, without sending an email.
+func (d *doctor) checkSMTP() {
+	if d.smtpServer == "" {
+		return
+	}
+	d.check("smtp server", func() (string, error) {
+		c, err := (junit2jira{params: d.params}).dialSMTP()
+		if err != nil {
+			return "", err
+		}
+		defer c.Close() //nolint:errcheck
+		return d.smtpServer, c.Quit()
+	})
+}
+
+// checkGitHub verifies GITHUB_TOKEN can read -github-repo, without commenting or creating a check run.
+func (d *doctor) checkGitHub() {
+	if !d.github {
+		return
+	}
+	d.check("github", func() (string, error) {
+		c, err := (junit2jira{params: d.params}).newGitHubClient()
+		if err != nil {
+			return "", err
+		}
+		var repo struct {
+			FullName string `json:"full_name"`
+		}
+		if err := c.do(http.MethodGet, "/repos/"+d.githubRepo, nil, &repo); err != nil {
+			return "", err
+		}
+		return repo.FullName, nil
+	})
+}
+
+// findInPage queries a page of results. Jira Cloud returns them in the named field, Jira Data Center in values.
+func findInPage(page gjson.Result, field, query string) gjson.Result {
+	if r := page.Get(field + "." + query); r.Exists() {
+		return r
+	}
+	return page.Get("values." + query)
+}
+
+// checkWritable verifies path can be written without modifying an existing file.
+func checkWritable(path string) error {
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", path)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return errors.Wrap(err, "not writable")
+		}
+		return f.Close()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".junit2jira-doctor-*")
+	if err != nil {
+		return errors.Wrap(err, "not writable")
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
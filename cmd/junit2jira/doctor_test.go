@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctor(t *testing.T) {
+	routes := map[string]string{
+		"GET /rest/api/3/project/ROX":                       `{"key":"ROX","name":"StackRox"}`,
+		"GET /rest/api/3/issue/createmeta/ROX/issuetypes":   `{"issueTypes":[{"id":"1","name":"Bug"}]}`,
+		"GET /rest/api/3/issue/createmeta/ROX/issuetypes/1": `{"fields":[{"fieldId":"summary"},{"fieldId":"labels"}]}`,
+		"GET /rest/api/3/issueLinkType":                     `{"issueLinkTypes":[{"name":"Blocks"},{"name":"Related"}]}`,
+		"POST /rest/api/3/search/jql":                       `{"issues":[]}`,
+	}
+
+	t.Run("all checks pass", func(t *testing.T) {
+		clearJiraEnv(t)
+		t.Setenv("JIRA_BEARER_TOKEN", "pat")
+		u := newFakeJira(t, "Bearer pat", routes)
+		out := &bytes.Buffer{}
+		err := runDoctor(params{
+			jiraUrl:         u,
+			jiraProject:     "ROX",
+			jiraAuth:        authAuto,
+			junitReportsDir: "testdata/jira",
+			csvOutput:       filepath.Join(t.TempDir(), "report.csv"),
+			summaryOutput:   "-",
+		}, out)
+		require.NoError(t, err, out.String())
+		assert.Contains(t, out.String(), "jira credentials  PASS    bearer auth for "+u.String())
+		assert.Contains(t, out.String(), "jira project      PASS    ROX (StackRox)")
+		assert.Contains(t, out.String(), "jira label        PASS    CI_Failure can be set")
+		assert.Contains(t, out.String(), "summary output    PASS    stdout")
+	})
+
+	t.Run("missing permissions fail", func(t *testing.T) {
+		clearJiraEnv(t)
+		t.Setenv("JIRA_BEARER_TOKEN", "pat")
+		u := newFakeJira(t, "Bearer pat", map[string]string{
+			"GET /rest/api/3/issue/createmeta/ROX/issuetypes": `{"issueTypes":[{"id":"2","name":"Task"}]}`,
+			"GET /rest/api/3/issueLinkType":                   `{"issueLinkTypes":[{"name":"Blocks"}]}`,
+		})
+		out := &bytes.Buffer{}
+		err := runDoctor(params{
+			jiraUrl:         u,
+			jiraProject:     "ROX",
+			jiraAuth:        authAuto,
+			junitReportsDir: "testdata/jira",
+			htmlOutput:      filepath.Join(t.TempDir(), "missing", "report.html"),
+		}, out)
+		assert.EqualError(t, err, "5 of 9 checks failed")
+		assert.Contains(t, out.String(), "Bug issues cannot be created in ROX")
+		assert.Contains(t, out.String(), "jira label        SKIP    issue type not available")
+		assert.Contains(t, out.String(), "link type Related does not exist")
+		assert.Contains(t, out.String(), "html output       FAIL    not writable")
+	})
+
+	t.Run("offline", func(t *testing.T) {
+		clearJiraEnv(t)
+		dir := t.TempDir()
+		readOnly := filepath.Join(dir, "summary.json")
+		require.NoError(t, os.WriteFile(readOnly, nil, 0400))
+		out := &bytes.Buffer{}
+		err := runDoctor(params{
+			jiraUrl:       &url.URL{Scheme: "https", Host: "jira.example.com"},
+			offline:       true,
+			summaryOutput: readOnly,
+		}, out)
+		assert.Error(t, err)
+		assert.Contains(t, out.String(), "jira credentials  SKIP    offline mode")
+		assert.Contains(t, out.String(), "junit reports     FAIL    no reports dir set")
+		if os.Geteuid() != 0 {
+			assert.Contains(t, out.String(), "summary output    FAIL    not writable")
+		}
+	})
+}
+
+func TestDoctorNotifications(t *testing.T) {
+	clearJiraEnv(t)
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.yml")
+	require.NoError(t, os.WriteFile(invalid, []byte("- channel: '#ci'\n  suiteRegex: '('\n"), 0644))
+	offline := params{jiraUrl: &url.URL{Scheme: "https", Host: "jira.example.com"}, offline: true, junitReportsDir: "testdata/slack"}
+
+	t.Run("valid", func(t *testing.T) {
+		p := offline
+		p.slackRoutingFile = "testdata/routing/routing.yml"
+		p.chatWebhooks = stringList{"teams"}
+		p.teamsOutput = filepath.Join(dir, "teams.json")
+		p.discordOutput = "-"
+		t.Setenv(teamsWebhookEnv, "https://teams.example.com/webhook")
+		p.webhook = "https://dashboard.example.com/runs?token=secret"
+		p.webhookTemplate = "testdata/webhook/dashboard.tmpl"
+		p.webhookHeaders = stringList{"Authorization=DASHBOARD_TOKEN"}
+		t.Setenv("DASHBOARD_TOKEN", "Bearer token")
+		p.smtpServer = newFakeSMTP(t).addr
+		p.emailFrom = "ci@example.com"
+		p.emailRoutingFile = "testdata/routing/email.yml"
+		p.htmlOutput = filepath.Join(dir, "report.html")
+		p.htmlTemplate = filepath.Join(dir, "report.html.tpl")
+		require.NoError(t, os.WriteFile(p.htmlTemplate, []byte("<h1>{{ .JobName }}</h1>"), 0644))
+		out := &bytes.Buffer{}
+		require.NoError(t, runDoctor(p, out), out.String())
+		assert.Regexp(t, `slack routing +PASS +\d+ routes`, out.String())
+		assert.Regexp(t, `teams webhook +PASS +TEAMS_WEBHOOK_URL is set`, out.String())
+		assert.Regexp(t, `teams output +PASS +`+regexp.QuoteMeta(p.teamsOutput), out.String())
+		assert.Regexp(t, `discord output +PASS +stdout`, out.String())
+		assert.Regexp(t, `webhook +PASS +posts to dashboard.example.com\n`, out.String())
+		assert.Regexp(t, `email routing +PASS +\d+ routes`, out.String())
+		assert.Regexp(t, `smtp server +PASS +`+regexp.QuoteMeta(p.smtpServer), out.String())
+		assert.Regexp(t, `html template +PASS +`+regexp.QuoteMeta(p.htmlTemplate), out.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		p := offline
+		p.slackDelivery = slackDeliveryBot
+		p.slackRoutingFile = invalid
+		out := &bytes.Buffer{}
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `slack routing +FAIL +create Slack route from file`, out.String())
+
+		p.slackRoutingFile = ""
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `configuration +FAIL +-slack-channel is required to post with a bot token`, out.String())
+
+		p = offline
+		p.chatWebhooks = stringList{"discord"}
+		t.Setenv(discordWebhookEnv, "")
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `discord webhook +FAIL +DISCORD_WEBHOOK_URL is required to post to discord`, out.String())
+
+		p.chatWebhooks = stringList{"irc"}
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `configuration +FAIL +unknown chat webhook "irc"`, out.String())
+
+		p = offline
+		p.webhook = "https://dashboard.example.com/runs"
+		p.webhookTemplate = "testdata/webhook/dashboard.tmpl"
+		p.webhookHeaders = stringList{"Authorization=DASHBOARD_TOKEN"}
+		t.Setenv("DASHBOARD_TOKEN", "")
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `webhook +FAIL +DASHBOARD_TOKEN is required for the webhook header Authorization`, out.String())
+
+		p.webhookTemplate = filepath.Join(dir, "invalid.tmpl")
+		require.NoError(t, os.WriteFile(p.webhookTemplate, []byte("{{ .Job"), 0644))
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `webhook +FAIL +parse webhook template`, out.String())
+
+		p.webhookTemplate = ""
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `configuration +FAIL +-webhook-template is required for -webhook`, out.String())
+
+		p = offline
+		p.smtpServer = "127.0.0.1:1"
+		p.emailFrom = "ci@example.com"
+		p.emailRoutingFile = invalid
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `email routing +FAIL +create email route from file`, out.String())
+		assert.Regexp(t, `smtp server +FAIL +could not connect to SMTP server`, out.String())
+
+		p.smtpServer = "smtp.example.com"
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `configuration +FAIL +invalid SMTP server "smtp.example.com", expected host:port`, out.String())
+
+		p = offline
+		p.htmlTemplate = filepath.Join(dir, "invalid.html.tpl")
+		require.NoError(t, os.WriteFile(p.htmlTemplate, []byte("{{ range }}"), 0644))
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `configuration +FAIL +-html-output is required for -html-template`, out.String())
+		assert.Regexp(t, `html template +FAIL +parse HTML template`, out.String())
+	})
+
+	t.Run("github", func(t *testing.T) {
+		server := httptest.NewServer(&fakeGitHub{t: t})
+		defer server.Close()
+		t.Setenv(githubTokenEnv, "gh-token")
+		p := offline
+		p.github = true
+		p.githubAPIURL = server.URL + "/api/v3"
+		p.githubRepo = "stackrox/rox"
+		p.githubPR = 7
+		out := &bytes.Buffer{}
+		require.NoError(t, runDoctor(p, out), out.String())
+		assert.Regexp(t, `github +PASS +stackrox/rox`, out.String())
+
+		p.githubRepo = "stackrox/missing"
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `github +FAIL +GitHub answered 404 Not Found to GET /repos/stackrox/missing`, out.String())
+
+		p.githubAnnotations = true
+		p.csvOutput = "-"
+		p.githubPR = 0
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `configuration +FAIL +-github-pr or -github-sha is required for -github`, out.String())
+
+		p.githubPR = 7
+		out.Reset()
+		assert.Error(t, runDoctor(p, out))
+		assert.Regexp(t, `configuration +FAIL +only one output can be written to stdout, got -csv-output, -github-annotations`, out.String())
+	})
+}
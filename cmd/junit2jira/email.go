@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	smtpUsernameEnv = "SMTP_USERNAME"
+	smtpPasswordEnv = "SMTP_PASSWORD"
+	emailTimeout    = time.Minute
+)
+
+var (
+	//go:embed email.html.tpl
+	emailHTMLTemplate string
+	//go:embed email.txt.tpl
+	emailTextTemplate string
+)
+
+// emailRouteConfig is a rule choosing who gets the failed tests owned by a team.
+// As for filing policies, all set regular expressions must match the whole value for the rule to apply.
+type emailRouteConfig struct {
+	// Name identifies the rule in logs.
+	Name              string   `yaml:"name"`
+	JobNameRegex      string   `yaml:"jobNameRegex"`
+	OrchestratorRegex string   `yaml:"orchestratorRegex"`
+	SuiteRegex        string   `yaml:"suiteRegex"`
+	TestNameRegex     string   `yaml:"testNameRegex"`
+	To                []string `yaml:"to"`
+}
+
+type emailRoute struct {
+	config emailRouteConfig
+	testMatcher
+}
+
+// emailDestination collects the failures sent to the same recipients.
+type emailDestination struct {
+	to     []string
+	issues []*testIssue
+}
+
+func newEmailRoute(config emailRouteConfig) (*emailRoute, error) {
+	if len(config.To) == 0 {
+		return nil, fmt.Errorf("rule %q has no recipients", config.Name)
+	}
+	m, err := newTestMatcher(config.Name, config.JobNameRegex, "", config.OrchestratorRegex, config.SuiteRegex, config.TestNameRegex, "")
+	if err != nil {
+		return nil, err
+	}
+	return &emailRoute{config: config, testMatcher: m}, nil
+}
+
+func loadEmailRoutingFile(fileName string) ([]*emailRoute, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("read email routing file: %s", fileName))
+	}
+
+	configs := make([]emailRouteConfig, 0)
+	err = yaml.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("parse email routing file: %s", fileName))
+	}
+
+	routes := make([]*emailRoute, 0, len(configs))
+	for _, config := range configs {
+		route, err := newEmailRoute(config)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("create email route from file: %s", fileName))
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// routeEmail groups failures by the recipients of the first matching rule. Failures without a matching
+// rule go to defaultTo, which comes first.
+func routeEmail(routes []*emailRoute, defaultTo []string, issues []*testIssue) []*emailDestination {
+	destinations := []*emailDestination{{to: defaultTo}}
+	for _, i := range issues {
+		d := destinations[0]
+		for _, r := range routes {
+			if !r.match(i.testCase) {
+				continue
+			}
+			logEntry("?", i.testCase.Suite+" / "+i.testCase.Name).Debugf("Matched email rule %q", r.config.Name)
+			k := slices.IndexFunc(destinations, func(d *emailDestination) bool { return slices.Equal(d.to, r.config.To) })
+			if k < 0 {
+				destinations = append(destinations, &emailDestination{to: r.config.To})
+				k = len(destinations) - 1
+			}
+			d = destinations[k]
+			break
+		}
+		d.issues = append(d.issues, i)
+	}
+
+	routed := make([]*emailDestination, 0, len(destinations))
+	for _, d := range destinations {
+		if len(d.issues) > 0 {
+			routed = append(routed, d)
+		}
+	}
+	return routed
+}
+
+func validateEmailParams(p params) error {
+	if p.smtpServer == "" {
+		if len(p.emailTo) > 0 || p.emailRoutingFile != "" {
+			return errors.New("-smtp-server is required to send emails")
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(p.smtpServer); err != nil {
+		return errors.Wrapf(err, "invalid SMTP server %q, expected host:port", p.smtpServer)
+	}
+	if p.emailFrom == "" {
+		return errors.New("-email-from is required to send emails")
+	}
+	if len(p.emailTo) == 0 && p.emailRoutingFile == "" {
+		return errors.New("-email-to or -email-routing-file is required to send emails")
+	}
+	return nil
+}
+
+// emailData is what the email templates show.
+type emailData struct {
+	JobName        string
+	BuildId        string
+	BuildLink      string
+	BuildTag       string
+	ReportLink     string
+	Total          int
+	Failed         int
+	NewIssues      int
+	ExistingIssues int
+	// New are all failures with a new issue, they are listed first.
+	New    []emailFailure
+	Suites []emailSuite
+	More   int
+}
+
+type emailSuite struct {
+	Name     string
+	Failures []emailFailure
+}
+
+type emailFailure struct {
+	Suite    string
+	Name     string
+	IssueKey string
+	IssueURL string
+	Status   string
+}
+
+func newEmailFailure(f chatFailure) emailFailure {
+	return emailFailure{
+		Suite:    f.testCase.Suite,
+		Name:     f.testCase.Name,
+		IssueKey: f.issueKey,
+		IssueURL: f.issueURL,
+		Status:   f.status(),
+	}
+}
+
+func (j junit2jira) emailData(issues []*testIssue) emailData {
+	d := j.chatDigest(issues)
+	data := emailData{
+		JobName:        d.jobName,
+		BuildId:        d.buildId,
+		BuildLink:      d.buildLink,
+		BuildTag:       d.buildTag,
+		ReportLink:     d.reportLink,
+		Total:          d.total,
+		Failed:         d.failed,
+		NewIssues:      d.newIssues,
+		ExistingIssues: d.existingIssues,
+		More:           d.more,
+	}
+	for _, i := range issues {
+		if f := j.chatFailure(i); f.newIssue && f.issueKey != "" {
+			data.New = append(data.New, newEmailFailure(f))
+		}
+	}
+	for _, s := range d.suites {
+		suite := emailSuite{Name: s.name}
+		for _, f := range s.failures {
+			suite.Failures = append(suite.Failures, newEmailFailure(f))
+		}
+		data.Suites = append(data.Suites, suite)
+	}
+	return data
+}
+
+// email is a message with an HTML and a plain text version.
+type email struct {
+	from    string
+	to      []string
+	subject string
+	text    string
+	html    string
+}
+
+func (j junit2jira) newEmail(to []string, issues []*testIssue) (email, error) {
+	data := j.emailData(issues)
+	var text, html bytes.Buffer
+	t, err := texttemplate.New("email.txt").Parse(emailTextTemplate)
+	if err != nil {
+		return email{}, fmt.Errorf("could not parse template: %w", err)
+	}
+	if err := t.Execute(&text, data); err != nil {
+		return email{}, fmt.Errorf("could not render template: %w", err)
+	}
+	h, err := template.New("email.html").Parse(emailHTMLTemplate)
+	if err != nil {
+		return email{}, fmt.Errorf("could not parse template: %w", err)
+	}
+	if err := h.Execute(&html, data); err != nil {
+		return email{}, fmt.Errorf("could not render template: %w", err)
+	}
+	return email{
+		from:    j.emailFrom,
+		to:      to,
+		subject: j.chatDigest(issues).text(),
+		text:    text.String(),
+		html:    html.String(),
+	}, nil
+}
+
+// bytes returns the message as multipart/alternative, with the plain text first as clients show the last
+// version they support.
+func (e email) bytes() ([]byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", e.text},
+		{"text/html; charset=UTF-8", e.html},
+	} {
+		p, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Quoted-printable keeps lines within the limit of RFC 5322 and needs no 8BITMIME support of the server.
+		qp := quotedprintable.NewWriter(p)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", e.subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", w.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// sendEmails sends a digest of the failures to the recipients of each destination. With -email-only-new,
+// it is only sent to destinations with new issues.
+func (j junit2jira) sendEmails(issues []*testIssue) error {
+	if j.smtpServer == "" || len(issues) == 0 {
+		return nil
+	}
+	for _, d := range routeEmail(j.emailRoutes, j.emailTo, issues) {
+		if len(d.to) == 0 {
+			log.Warnf("Not sending %d failures by email: no rule routes them to recipients and -email-to is not set", len(d.issues))
+			continue
+		}
+		if j.emailOnlyNew && !slices.ContainsFunc(d.issues, func(i *testIssue) bool { return i.newJIRA }) {
+			log.Infof("Not sending %d failures to %s: no new issues", len(d.issues), strings.Join(d.to, ", "))
+			continue
+		}
+		if j.dryRun {
+			log.Infof("Dry run: would send %d failures to %s", len(d.issues), strings.Join(d.to, ", "))
+			continue
+		}
+		e, err := j.newEmail(d.to, d.issues)
+		if err != nil {
+			return err
+		}
+		if err := j.sendEmail(e); err != nil {
+			return errors.Wrapf(err, "could not send email to %s", strings.Join(d.to, ", "))
+		}
+		log.Infof("Sent %d failures to %s", len(d.issues), strings.Join(d.to, ", "))
+	}
+	return nil
+}
+
+// sendEmail sends e through -smtp-server.
+func (j junit2jira) sendEmail(e email) error {
+	msg, err := e.bytes()
+	if err != nil {
+		return errors.Wrap(err, "could not create message")
+	}
+	c, err := j.dialSMTP()
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+
+	from, err := mail.ParseAddress(e.from)
+	if err != nil {
+		return errors.Wrapf(err, "invalid sender %q", e.from)
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return errors.Wrap(err, "sender rejected")
+	}
+	for _, to := range e.to {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return errors.Wrapf(err, "invalid recipient %q", to)
+		}
+		if err := c.Rcpt(address.Address); err != nil {
+			return errors.Wrapf(err, "recipient %s rejected", to)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "message rejected")
+	}
+	return c.Quit()
+}
+
+// dialSMTP opens a session with -smtp-server. The connection is upgraded with STARTTLS if the server supports it,
+// and authenticated if SMTP_USERNAME is set.
+func (j junit2jira) dialSMTP() (*smtp.Client, error) {
+	username, err := secret(smtpUsernameEnv, j.secretsDir)
+	if err != nil {
+		return nil, err
+	}
+	password, err := secret(smtpPasswordEnv, j.secretsDir)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := j.transport.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	host, _, err := net.SplitHostPort(j.smtpServer)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", j.smtpServer, emailTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not connect to SMTP server")
+	}
+	if err := conn.SetDeadline(time.Now().Add(emailTimeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "could not start SMTP session")
+	}
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		tlsConfig.ServerName = host
+		if err := c.StartTLS(tlsConfig); err != nil {
+			_ = c.Close()
+			return nil, errors.Wrap(err, "could not start TLS")
+		}
+	}
+	if username != "" {
+		// PlainAuth refuses to send the password over a connection without TLS, except to localhost.
+		if err := c.Auth(smtp.PlainAuth("", username, password, host)); err != nil {
+			_ = c.Close()
+			return nil, errors.Wrap(err, "could not authenticate")
+		}
+	}
+	return c, nil
+}
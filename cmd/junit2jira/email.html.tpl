@@ -0,0 +1,38 @@
+<html>
+<body style="font-family: Arial, Helvetica, sans-serif; font-size: 14px; color: #222222">
+<h2 style="color: #bb2124">Failed tests</h2>
+{{- if .JobName }}
+<p>Job: <b>{{ .JobName }}</b>
+{{- if .BuildLink }}, build <a href="{{ .BuildLink }}">{{ or .BuildId "link" }}</a>{{ else if .BuildId }}, build {{ .BuildId }}{{ end }}
+{{- if .BuildTag }}, tag {{ .BuildTag }}{{ end }}</p>
+{{- end }}
+<table cellpadding="4" style="border-collapse: collapse">
+{{- if .Total }}
+<tr><td>Total</td><td><b>{{ .Total }}</b></td></tr>
+{{- end }}
+<tr><td>Failed</td><td><b>{{ .Failed }}</b></td></tr>
+<tr><td>New issues</td><td><b>{{ .NewIssues }}</b></td></tr>
+<tr><td>Existing issues</td><td><b>{{ .ExistingIssues }}</b></td></tr>
+</table>
+{{- if .New }}
+<h3>New issues</h3>
+<ul>
+{{- range .New }}
+<li><a href="{{ .IssueURL }}">{{ .IssueKey }}</a> {{ .Suite }}: {{ .Name }}</li>
+{{- end }}
+</ul>
+{{- end }}
+<h3>All failures</h3>
+{{- range .Suites }}
+<p><b>{{ or .Name "No suite" }}</b></p>
+<ul>
+{{- range .Failures }}
+<li>{{ if .IssueKey }}<a href="{{ .IssueURL }}">{{ .IssueKey }}</a> {{ end }}{{ .Name }}{{ if .Status }} ({{ .Status }}){{ end }}</li>
+{{- end }}
+</ul>
+{{- end }}
+{{- if .More }}
+<p>…and {{ .More }} more failures{{ if .ReportLink }}, see the <a href="{{ .ReportLink }}">HTML report</a>{{ else if .BuildLink }}, see the <a href="{{ .BuildLink }}">build</a>{{ end }}.</p>
+{{- end }}
+</body>
+</html>
@@ -0,0 +1,36 @@
+Failed tests
+{{- if .JobName }}
+
+Job: {{ .JobName }}
+{{- if .BuildId }}, build {{ .BuildId }}{{ end }}
+{{- if .BuildTag }}, tag {{ .BuildTag }}{{ end }}
+{{- if .BuildLink }}
+Build: {{ .BuildLink }}
+{{- end }}
+{{- end }}
+
+{{ if .Total }}Total: {{ .Total }}
+{{ end -}}
+Failed: {{ .Failed }}
+New issues: {{ .NewIssues }}
+Existing issues: {{ .ExistingIssues }}
+{{- if .New }}
+
+New issues:
+{{- range .New }}
+- {{ .IssueKey }} {{ .Suite }}: {{ .Name }} {{ .IssueURL }}
+{{- end }}
+{{- end }}
+
+All failures:
+{{- range .Suites }}
+
+{{ or .Name "No suite" }}
+{{- range .Failures }}
+- {{ if .IssueKey }}{{ .IssueKey }} {{ end }}{{ .Name }}{{ if .Status }} ({{ .Status }}){{ end }}
+{{- end }}
+{{- end }}
+{{- if .More }}
+
+...and {{ .More }} more failures{{ if .ReportLink }}, see {{ .ReportLink }}{{ else if .BuildLink }}, see {{ .BuildLink }}{{ end }}.
+{{- end }}
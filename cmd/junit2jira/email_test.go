@@ -0,0 +1,224 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type smtpEnvelope struct {
+	from string
+	to   []string
+	data []byte
+}
+
+// fakeSMTP is a local SMTP stand-in that accepts all messages, except for recipients in reject.
+type fakeSMTP struct {
+	addr   string
+	reject []string
+
+	mu       sync.Mutex
+	received []smtpEnvelope
+}
+
+func newFakeSMTP(t *testing.T, reject ...string) *fakeSMTP {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	s := &fakeSMTP{addr: l.Addr().String(), reject: reject}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close() //nolint:errcheck
+	c := textproto.NewConn(conn)
+	envelope := smtpEnvelope{}
+	_ = c.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO", "HELO":
+			_ = c.PrintfLine("250-fake\r\n250 8BITMIME")
+		case "MAIL":
+			from, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+			envelope.from = strings.Trim(from, "<>")
+			_ = c.PrintfLine("250 OK")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			for _, r := range s.reject {
+				if to == r {
+					_ = c.PrintfLine("550 no such user")
+					to = ""
+				}
+			}
+			if to != "" {
+				envelope.to = append(envelope.to, to)
+				_ = c.PrintfLine("250 OK")
+			}
+		case "DATA":
+			_ = c.PrintfLine("354 go ahead")
+			envelope.data, err = c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.received = append(s.received, envelope)
+			s.mu.Unlock()
+			envelope = smtpEnvelope{}
+			_ = c.PrintfLine("250 OK")
+		case "QUIT":
+			_ = c.PrintfLine("221 bye")
+			return
+		default:
+			_ = c.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// parseEmail returns the headers and the parts of a message by content type.
+func parseEmail(t *testing.T, data []byte) (mail.Header, map[string]string) {
+	m, err := mail.ReadMessage(strings.NewReader(string(data)))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	parts := map[string]string{}
+	r := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(p)
+		require.NoError(t, err)
+		parts[strings.Split(p.Header.Get("Content-Type"), ";")[0]] = string(body)
+	}
+	return m.Header, parts
+}
+
+func emailTestJira(t *testing.T, server string) junit2jira {
+	jiraUrl, err := url.Parse("https://jira.example.com/")
+	require.NoError(t, err)
+	routes, err := loadEmailRoutingFile("testdata/routing/email.yml")
+	require.NoError(t, err)
+	return junit2jira{
+		params: params{
+			jiraUrl:    jiraUrl,
+			JobName:    "nightly",
+			BuildId:    "42",
+			BuildLink:  "https://ci/42",
+			smtpServer: server,
+			emailFrom:  "CI <ci@example.com>",
+			emailTo:    stringList{"managers@example.com"},
+		},
+		emailRoutes: routes,
+	}
+}
+
+func TestSendEmails(t *testing.T) {
+	scanner := &testIssue{issue: &models.IssueScheme{Key: "ROX-1"}, newJIRA: true, testCase: j2jTestCase{Suite: "github.com/stackrox/rox/scanner/api", Name: "TestA"}}
+	central := &testIssue{issue: &models.IssueScheme{Key: "ROX-2"}, testCase: j2jTestCase{Suite: "github.com/stackrox/rox/central", Name: "Test<B>"}}
+
+	s := newFakeSMTP(t)
+	j := emailTestJira(t, s.addr)
+	require.NoError(t, j.sendEmails([]*testIssue{scanner, central}))
+
+	require.Len(t, s.received, 2)
+	assert.Equal(t, "ci@example.com", s.received[0].from)
+	assert.Equal(t, []string{"managers@example.com"}, s.received[0].to)
+	assert.Equal(t, []string{"scanner-leads@example.com", "jane@example.com"}, s.received[1].to)
+
+	header, parts := parseEmail(t, s.received[0].data)
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "nightly: 1 failed tests, 0 new issues", subject)
+	assert.Equal(t, "managers@example.com", header.Get("To"))
+	assert.Contains(t, parts["text/plain"], "- ROX-2 Test<B> (existing)")
+	assert.Contains(t, parts["text/plain"], "Build: https://ci/42")
+	assert.Contains(t, parts["text/html"], `<a href="https://jira.example.com/browse/ROX-2">ROX-2</a> Test&lt;B&gt; (existing)`)
+	assert.NotContains(t, parts["text/html"], "<h3>New issues</h3>")
+
+	_, parts = parseEmail(t, s.received[1].data)
+	assert.Contains(t, parts["text/plain"], "New issues:\n- ROX-1 github.com/stackrox/rox/scanner/api: TestA https://jira.example.com/browse/ROX-1")
+	assert.Contains(t, parts["text/html"], "<h3>New issues</h3>")
+
+	t.Run("only new", func(t *testing.T) {
+		s := newFakeSMTP(t)
+		j := emailTestJira(t, s.addr)
+		j.emailOnlyNew = true
+		require.NoError(t, j.sendEmails([]*testIssue{scanner, central}))
+		require.Len(t, s.received, 1)
+		assert.Equal(t, []string{"scanner-leads@example.com", "jane@example.com"}, s.received[0].to)
+	})
+	t.Run("dry run", func(t *testing.T) {
+		s := newFakeSMTP(t)
+		j := emailTestJira(t, s.addr)
+		j.dryRun = true
+		require.NoError(t, j.sendEmails([]*testIssue{scanner, central}))
+		assert.Empty(t, s.received)
+	})
+	t.Run("rejected recipient", func(t *testing.T) {
+		s := newFakeSMTP(t, "managers@example.com")
+		j := emailTestJira(t, s.addr)
+		assert.ErrorContains(t, j.sendEmails([]*testIssue{central}), `recipient managers@example.com rejected: 550 "no such user"`)
+	})
+}
+
+func TestEmailBytesLongLines(t *testing.T) {
+	long := "TestÄ" + strings.Repeat("x", 2000)
+	data, err := email{from: "ci@example.com", to: []string{"jane@example.com"}, subject: "s", text: long, html: "<p>" + long + "</p>"}.bytes()
+	require.NoError(t, err)
+	// RFC 5322 limits lines to 998 octets.
+	for _, line := range strings.Split(string(data), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998)
+	}
+	assert.NotContains(t, string(data), "8bit")
+
+	_, parts := parseEmail(t, data)
+	assert.Equal(t, long, parts["text/plain"])
+	assert.Equal(t, "<p>"+long+"</p>", parts["text/html"])
+}
+
+func TestValidateEmailParams(t *testing.T) {
+	assert.NoError(t, validateEmailParams(params{}))
+	assert.NoError(t, validateEmailParams(params{smtpServer: "smtp.example.com:587", emailFrom: "ci@example.com", emailTo: stringList{"a@example.com"}}))
+	assert.ErrorContains(t, validateEmailParams(params{emailTo: stringList{"a@example.com"}}), "-smtp-server is required")
+	assert.ErrorContains(t, validateEmailParams(params{smtpServer: "smtp.example.com"}), "expected host:port")
+	assert.ErrorContains(t, validateEmailParams(params{smtpServer: "smtp.example.com:587", emailTo: stringList{"a@example.com"}}), "-email-from is required")
+	assert.ErrorContains(t, validateEmailParams(params{smtpServer: "smtp.example.com:587", emailFrom: "ci@example.com"}), "-email-to or -email-routing-file is required")
+}
+
+func TestLoadEmailRoutingFile(t *testing.T) {
+	routes, err := loadEmailRoutingFile("testdata/routing/email.yml")
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+
+	_, err = newEmailRoute(emailRouteConfig{Name: "nobody", SuiteRegex: "suite"})
+	assert.EqualError(t, err, `rule "nobody" has no recipients`)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// defaultExcerptMarkers match lines of Go, testify and Ginkgo output that explain a failure.
+var defaultExcerptMarkers = []string{
+	`--- FAIL`,
+	`Error Trace:`,
+	`Expected`,
+	`panic:`,
+	`\[FAIL\]`,
+	`\[PANICKED\]`,
+}
+
+// excerpter shortens long output to the lines that explain a failure.
+type excerpter struct {
+	markers []*regexp.Regexp
+	// context is the number of lines kept before a line of interest, a quarter of it is kept after.
+	context int
+}
+
+// defaultExcerpter is used when no excerpter is configured, e.g. for test cases not created from reports.
+var defaultExcerpter = &excerpter{markers: compileExcerptMarkers(defaultExcerptMarkers), context: 20}
+
+func compileExcerptMarkers(patterns []string) []*regexp.Regexp {
+	markers := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		markers = append(markers, regexp.MustCompile(p))
+	}
+	return markers
+}
+
+// newExcerpter adds markers to the default ones and keeps context lines around them.
+func newExcerpter(patterns []string, context int) (*excerpter, error) {
+	if context < 0 {
+		return nil, fmt.Errorf("-excerpt-context must not be negative, got %d", context)
+	}
+	e := &excerpter{markers: compileExcerptMarkers(defaultExcerptMarkers), context: context}
+	for _, p := range patterns {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid excerpt marker %q", p)
+		}
+		e.markers = append(e.markers, r)
+	}
+	return e, nil
+}
+
+// excerpt shortens text longer than limit runes to the lines around markers and the test name.
+// If nothing is found, or the excerpt is still too long, the end of the text is kept as failures are usually
+// reported last.
+func (e *excerpter) excerpt(text, testName string, limit int) string {
+	if len([]rune(text)) <= limit {
+		return text
+	}
+	if e == nil {
+		e = defaultExcerpter
+	}
+
+	names := []string{testName}
+	if i := strings.LastIndex(testName, "/"); i >= 0 {
+		names = append(names, testName[i+1:])
+	}
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	keep := make([]bool, len(lines))
+	found := false
+	for i, line := range lines {
+		if !e.isExcerptLine(line, names) {
+			continue
+		}
+		found = true
+		for k := max(0, i-e.context); k <= min(len(lines)-1, i+(e.context+3)/4); k++ {
+			keep[k] = true
+		}
+	}
+	if !found {
+		return tail(text, limit)
+	}
+
+	var b strings.Builder
+	omitted := 0
+	for i, line := range lines {
+		if !keep[i] {
+			omitted++
+			continue
+		}
+		if omitted > 0 {
+			b.WriteString(fmt.Sprintf("[… %d lines omitted …]\n", omitted))
+			omitted = 0
+		}
+		b.WriteString(line + "\n")
+	}
+	if omitted > 0 {
+		b.WriteString(fmt.Sprintf("[… %d lines omitted …]\n", omitted))
+	}
+	return tail(strings.TrimSuffix(b.String(), "\n"), limit)
+}
+
+func (e *excerpter) isExcerptLine(line string, names []string) bool {
+	for _, m := range e.markers {
+		if m.MatchString(line) {
+			return true
+		}
+	}
+	for _, n := range names {
+		if n != "" && strings.Contains(line, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// excerpt shortens text of the test case with its excerpter.
+func (tc j2jTestCase) excerpt(text string, limit int) string {
+	return tc.excerpter.excerpt(text, tc.Name, limit)
+}
+
+// tail keeps the last limit runes of text.
+func tail(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	const prefix = "… too long, truncated.\n"
+	return prefix + string(runes[len(runes)-max(0, limit-len([]rune(prefix))):])
+}
+
+// fullOutputFileName is the name of the attachment with the full text of a field.
+func (tc j2jTestCase) fullOutputFileName(field string) string {
+	if tc.BuildId == "" {
+		return field + ".txt"
+	}
+	return fmt.Sprintf("%s-%s.txt", field, tc.BuildId)
+}
+
+// fullOutput is the text of a field that is too long to be shown in full.
+type fullOutput struct {
+	field, name, text string
+}
+
+// fullOutputs returns the fields that are too long to be shown in full, in the order of the description.
+func (tc j2jTestCase) fullOutputs() []fullOutput {
+	var outputs []fullOutput
+	for _, f := range []struct{ field, text string }{{"message", tc.Message}, {"stderr", tc.Stderr}, {"stdout", tc.Stdout}, {"error", tc.Error}} {
+		if len([]rune(f.text)) > maxTextBlockLength {
+			outputs = append(outputs, fullOutput{field: f.field, name: tc.fullOutputFileName(f.field), text: f.text})
+		}
+	}
+	return outputs
+}
+
+// fullOutputNote tells where to find the full text of a field shown as an excerpt, or returns nil.
+func (tc j2jTestCase) fullOutputNote(field, text string) *models.CommentNodeScheme {
+	if len([]rune(text)) <= maxTextBlockLength {
+		return nil
+	}
+	content := []*models.CommentNodeScheme{{Type: "text", Text: "Excerpt shown, "}}
+	switch {
+	case tc.AttachFullOutput && !slices.Contains(tc.missingAttachments, field):
+		content = append(content, &models.CommentNodeScheme{Type: "text", Text: "the full output is attached as " + tc.fullOutputFileName(field) + "."})
+	case tc.BuildLink != "":
+		content = append(content,
+			&models.CommentNodeScheme{Type: "text", Text: "the full output is in the "},
+			&models.CommentNodeScheme{
+				Type: "text",
+				Text: "build",
+				Marks: []*models.MarkScheme{{
+					Type: "link",
+					Attrs: map[string]any{
+						"href": tc.BuildLink,
+					},
+				}},
+			},
+			&models.CommentNodeScheme{Type: "text", Text: "."},
+		)
+	default:
+		content = append(content, &models.CommentNodeScheme{Type: "text", Text: "the full output is in the build log."})
+	}
+	return &models.CommentNodeScheme{
+		Type:    "paragraph",
+		Content: content,
+	}
+}
+
+// attachFullOutput attaches the full text of fields that are shown as excerpts to the issue. It returns the fields
+// that could not be attached, the others stay attached.
+func (j junit2jira) attachFullOutput(issueKey string, tc j2jTestCase) ([]string, error) {
+	if !tc.AttachFullOutput {
+		return nil, nil
+	}
+	var missing []string
+	var result error
+	for _, output := range tc.fullOutputs() {
+		_, response, err := j.jiraClient.Issue.Attachment.Add(context.TODO(), issueKey, output.name, strings.NewReader(output.text))
+		if err != nil {
+			logError(err, response)
+			missing = append(missing, output.field)
+			result = multierror.Append(result, errors.Wrapf(err, "could not attach %s", output.name))
+		}
+	}
+	return missing, result
+}
+
+// withMissingAttachments records the fields that could not be attached, so that their notes do not point to
+// attachments. If nothing was attached, AttachFullOutput is cleared.
+func (tc j2jTestCase) withMissingAttachments(missing []string) j2jTestCase {
+	tc.missingAttachments = missing
+	if len(missing) == len(tc.fullOutputs()) {
+		tc.AttachFullOutput = false
+	}
+	return tc
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	jira "github.com/ctreminiom/go-atlassian/v2/jira/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func goTestOutput(noise int) string {
+	var b strings.Builder
+	b.WriteString("=== RUN   TestServer\n")
+	for i := 0; i < noise; i++ {
+		b.WriteString(fmt.Sprintf("log line %d\n", i))
+	}
+	b.WriteString("    server_test.go:42:\n        \tError Trace:\tserver_test.go:42\n        \tError:      \tNot equal\n")
+	for i := 0; i < noise; i++ {
+		b.WriteString(fmt.Sprintf("cleanup line %d\n", i))
+	}
+	b.WriteString("--- FAIL: TestServer (1.00s)\nFAIL\n")
+	return b.String()
+}
+
+func TestExcerpt(t *testing.T) {
+	e, err := newExcerpter(nil, 2)
+	require.NoError(t, err)
+
+	assert.Equal(t, "short", e.excerpt("short", "TestServer", 100))
+
+	assert.Equal(t, `=== RUN   TestServer
+log line 0
+[… 98 lines omitted …]
+log line 99
+    server_test.go:42:
+        	Error Trace:	server_test.go:42
+        	Error:      	Not equal
+[… 98 lines omitted …]
+cleanup line 98
+cleanup line 99
+--- FAIL: TestServer (1.00s)
+FAIL`, e.excerpt(goTestOutput(100), "TestServer", 1000))
+
+	assert.Equal(t, "… too long, truncated.\n\nFAIL", e.excerpt(goTestOutput(100), "TestServer", 28))
+
+	noMarkers := strings.Repeat("x", 50) + "end"
+	assert.Equal(t, "… too long, truncated.\nxxxxend", e.excerpt(noMarkers, "TestServer", 30))
+
+	e, err = newExcerpter([]string{`log line 5\d`}, 0)
+	require.NoError(t, err)
+	assert.Contains(t, e.excerpt(goTestOutput(100), "TestServer", 2000), "=== RUN   TestServer\n[… 50 lines omitted …]\nlog line 50\nlog line 51\n")
+	_, err = newExcerpter([]string{"("}, 0)
+	assert.ErrorContains(t, err, `invalid excerpt marker "("`)
+	_, err = newExcerpter(nil, -1)
+	assert.EqualError(t, err, "-excerpt-context must not be negative, got -1")
+
+	// Test cases without an excerpter use the default markers.
+	tc := j2jTestCase{Name: "TestServer"}
+	assert.Contains(t, tc.excerpt(goTestOutput(100), 1000), "[… 76 lines omitted …]\nlog line 81\n")
+}
+
+func TestCrop(t *testing.T) {
+	assert.Equal(t, "short", crop("short", 10))
+	assert.Equal(t, "ääää…", crop("äääääääää", 5))
+	assert.True(t, utf8.ValidString(crop(strings.Repeat("日本", 100), 7)))
+}
+
+func TestFullOutput(t *testing.T) {
+	defer func(l int) { maxTextBlockLength = l }(maxTextBlockLength)
+	maxTextBlockLength = 100
+
+	tc := j2jTestCase{Name: "TestServer", Message: "short", Stdout: goTestOutput(100), BuildId: "42", BuildLink: "https://ci/42"}
+	assert.Nil(t, tc.fullOutputNote("message", tc.Message))
+	note := tc.fullOutputNote("stdout", tc.Stdout)
+	require.NotNil(t, note)
+	assert.Equal(t, "https://ci/42", note.Content[2].Marks[0].Attrs["href"])
+
+	tc.AttachFullOutput = true
+	assert.Equal(t, "the full output is attached as stdout-42.txt.", tc.fullOutputNote("stdout", tc.Stdout).Content[1].Text)
+
+	var attached []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/rest/api/3/issue/ROX-1/attachments", r.URL.Path)
+		_, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		attached = append(attached, header.Filename)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	client, err := jira.New(server.Client(), server.URL)
+	require.NoError(t, err)
+
+	missing, err := junit2jira{jiraClient: client}.attachFullOutput("ROX-1", tc)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+	assert.Equal(t, []string{"stdout-42.txt"}, attached)
+}
+
+func TestFullOutputPartlyAttached(t *testing.T) {
+	defer func(l int) { maxTextBlockLength = l }(maxTextBlockLength)
+	maxTextBlockLength = 100
+
+	var attempts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		attempts = append(attempts, header.Filename)
+		if header.Filename == "stderr-42.txt" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	client, err := jira.New(server.Client(), server.URL)
+	require.NoError(t, err)
+
+	output := goTestOutput(100)
+	tc := j2jTestCase{Name: "TestServer", Message: output, Stderr: output, Stdout: output, Error: output, BuildId: "42", AttachFullOutput: true}
+	missing, err := junit2jira{jiraClient: client}.attachFullOutput("ROX-1", tc)
+	assert.ErrorContains(t, err, "could not attach stderr-42.txt")
+	assert.Equal(t, []string{"message-42.txt", "stderr-42.txt", "stdout-42.txt", "error-42.txt"}, attempts)
+	assert.Equal(t, []string{"stderr"}, missing)
+
+	tc = tc.withMissingAttachments(missing)
+	assert.True(t, tc.AttachFullOutput)
+	assert.Equal(t, "the full output is attached as message-42.txt.", tc.fullOutputNote("message", tc.Message).Content[1].Text)
+	assert.Equal(t, "the full output is in the build log.", tc.fullOutputNote("stderr", tc.Stderr).Content[1].Text)
+	assert.Equal(t, "the full output is attached as stdout-42.txt.", tc.fullOutputNote("stdout", tc.Stdout).Content[1].Text)
+}
+
+func TestFullOutputAttachmentFailed(t *testing.T) {
+	defer func(l int) { maxTextBlockLength = l }(maxTextBlockLength)
+	maxTextBlockLength = 100
+
+	existing := ""
+	bodies := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /rest/api/3/search/jql":
+			_, _ = w.Write([]byte(`{"issues":[` + existing + `]}`))
+		case "POST /rest/api/3/issue/ROX-1/attachments", "POST /rest/api/3/issue/ROX-2/attachments":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "POST /rest/api/3/issue":
+			_, _ = w.Write([]byte(`{"id":"2","key":"ROX-2"}`))
+		case "PUT /rest/api/3/issue/ROX-2", "POST /rest/api/3/issue/ROX-1/comment":
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			bodies[r.Method+" "+r.URL.Path] = string(body)
+			_, _ = w.Write([]byte(`{"id":"1"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := jira.New(server.Client(), server.URL)
+	require.NoError(t, err)
+	j := junit2jira{params: params{jiraProject: "ROX"}, jiraClient: client}
+	tc := j2jTestCase{Suite: "suite", Name: "TestServer", Stdout: goTestOutput(100), BuildId: "42", AttachFullOutput: true}
+
+	issue, err := j.createIssueOrComment(tc, true)
+	require.NoError(t, err)
+	assert.True(t, issue.newJIRA)
+	assert.False(t, issue.testCase.AttachFullOutput)
+	assert.Contains(t, bodies["PUT /rest/api/3/issue/ROX-2"], "the full output is in the build log.")
+	assert.NotContains(t, bodies["PUT /rest/api/3/issue/ROX-2"], "attached")
+
+	existing = `{"key":"ROX-1","fields":{"summary":"suite / TestServer FAILED"}}`
+	issue, err = j.createIssueOrComment(tc, true)
+	require.NoError(t, err)
+	assert.False(t, issue.newJIRA)
+	assert.Contains(t, bodies["POST /rest/api/3/issue/ROX-1/comment"], "the full output is in the build log.")
+	assert.NotContains(t, bodies["POST /rest/api/3/issue/ROX-1/comment"], "attached")
+}
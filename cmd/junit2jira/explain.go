@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	"github.com/stackrox/junit2jira/pkg/testcase"
+)
+
+// explainParams select the tests to explain, either a single test given by name or failed tests from the reports.
+type explainParams struct {
+	suite  string
+	test   string
+	filter string
+}
+
+func (e *explainParams) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&e.suite, "suite", "", "Suite (classname) of the test to explain")
+	fs.StringVar(&e.test, "test", "", "Name of the test to explain. If not set, failed tests from -junit-reports-dir are explained.")
+	fs.StringVar(&e.filter, "filter", "", "Regular expression matched against \"<suite> / <test>\" to select failed tests from the reports")
+}
+
+// runExplain prints how issues are looked up for the selected tests without modifying Jira.
+func runExplain(p params, e explainParams, out io.Writer) error {
+	r, err := newRedactor(p.redactPatterns)
+	if err != nil {
+		return errors.Wrap(err, "could not create redactor")
+	}
+	j := &junit2jira{params: p, redactor: r}
+
+	if p.policyFile != "" {
+		j.policies, err = loadFilingPolicyFile(p.policyFile)
+		if err != nil {
+			return errors.Wrap(err, "could not load policy file")
+		}
+	}
+
+	tests, err := j.testsToExplain(e)
+	if err != nil {
+		return err
+	}
+
+	// Hooks can rename or skip tests, so they are run like in a real run. They are told that nothing is filed.
+	if err := validateHookParams(p); err != nil {
+		return err
+	}
+	j.dryRun = true
+	tests, err = j.runHooks(tests)
+	if err != nil {
+		return errors.Wrap(err, "could not run hooks")
+	}
+	for i, tc := range tests {
+		tests[i] = r.redactTestCase(tc)
+	}
+
+	if !p.offline {
+		j.jiraClient, err = newJiraClient(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, tc := range tests {
+		if i > 0 {
+			_, _ = fmt.Fprintln(out)
+		}
+		if err := j.explain(tc, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j junit2jira) testsToExplain(e explainParams) ([]j2jTestCase, error) {
+	if e.test != "" {
+		tc := j.newJ2jTestCase(testcase.NewTestCase(junit.Test{Name: e.test, Classname: e.suite}))
+		return []j2jTestCase{tc}, nil
+	}
+	if j.junitReportsDir == "" {
+		return nil, errors.New("either -test or -junit-reports-dir is required")
+	}
+
+	filter, err := regexp.Compile(e.filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid filter")
+	}
+	testSuites, err := testcase.LoadTestSuites(j.junitReportsDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read files")
+	}
+	failedTests, err := j.getMergedFailedTests(testSuites)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find failed tests")
+	}
+
+	var tests []j2jTestCase
+	for _, tc := range failedTests {
+		if filter.MatchString(tc.Suite + " / " + tc.Name) {
+			tests = append(tests, tc)
+		}
+	}
+	if len(tests) == 0 {
+		return nil, fmt.Errorf("no failed test in %s matches %q", j.junitReportsDir, e.filter)
+	}
+	return tests, nil
+}
+
+func (j junit2jira) explain(tc j2jTestCase, out io.Writer) error {
+	summary, err := tc.summary()
+	if err != nil {
+		return fmt.Errorf("could not get summary: %w", err)
+	}
+	rendered, err := render(tc, summaryTpl)
+	if err != nil {
+		return fmt.Errorf("could not get summary: %w", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "Test:     %s / %s\n", tc.Suite, tc.Name)
+	if tc.skippedByHook {
+		_, _ = fmt.Fprintf(out, "Result: not filed in Jira (%s)\n", decisionSkippedByHook)
+		return nil
+	}
+	_, _ = fmt.Fprintf(out, "Rendered: %q\n", rendered)
+	_, _ = fmt.Fprintf(out, "Summary:  %q\n", summary)
+	decision := decide(j.policies, tc)
+	if len(j.policies) > 0 {
+		_, _ = fmt.Fprintf(out, "Decision: %s\n", decision)
+	}
+	if decision != decisionCreateOrComment && decision != decisionCommentOnlyIfExists {
+		_, _ = fmt.Fprintf(out, "Result: not filed in Jira (%s)\n", decision)
+		return nil
+	}
+
+	_, _ = fmt.Fprintf(out, "\nOpen issues JQL:\n%s\n", fmt.Sprintf(jql, j.jiraProject, summary))
+	if j.jiraClient == nil {
+		_, _ = fmt.Fprintln(out, "Search skipped in offline mode.")
+		_, _ = fmt.Fprintf(out, "\nClosed issues JQL:\n%s\n", fmt.Sprintf(jqlClosedTicketsQuery, j.jiraProject, summary))
+		return nil
+	}
+	openIssues, err := j.searchOpenIssues(summary)
+	if err != nil {
+		return err
+	}
+	picked := explainHits(out, openIssues, summary)
+	if picked != nil {
+		_, _ = fmt.Fprintf(out, "Result: comment on %s\n", picked.Key)
+		return nil
+	}
+	if decision == decisionCommentOnlyIfExists {
+		_, _ = fmt.Fprintf(out, "Result: no issue is created (%s)\n", decision)
+		return nil
+	}
+	_, _ = fmt.Fprintln(out, "Result: create a new issue")
+
+	_, _ = fmt.Fprintf(out, "\nClosed issues JQL (most recently updated only):\n%s\n", fmt.Sprintf(jqlClosedTicketsQuery, j.jiraProject, summary))
+	closedIssues, err := j.searchClosedIssues(summary)
+	if err != nil {
+		return err
+	}
+	picked = explainHits(out, closedIssues, summary)
+	if picked != nil {
+		_, _ = fmt.Fprintf(out, "Result: link the new issue to %s\n", picked.Key)
+	} else {
+		_, _ = fmt.Fprintln(out, "Result: no link to a closed issue")
+	}
+	return nil
+}
+
+// explainHits prints the search results with the reason why findMatchingIssue picks or rejects each of them.
+func explainHits(out io.Writer, issues []*models.IssueScheme, summary string) *models.IssueScheme {
+	picked := findMatchingIssue(issues, summary)
+	_, _ = fmt.Fprintf(out, "Hits (%d):\n", len(issues))
+	for _, i := range issues {
+		if i.Fields == nil {
+			_, _ = fmt.Fprintf(out, "  %s  rejected  no summary returned\n", i.Key)
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "  %s  %s  %q\n", i.Key, verdict(i, picked, summary), i.Fields.Summary)
+	}
+	return picked
+}
+
+func verdict(i, picked *models.IssueScheme, summary string) string {
+	s := i.Fields.Summary
+	switch {
+	case i == picked:
+		return "picked    exact summary match"
+	case s == summary:
+		return fmt.Sprintf("rejected  also matches, but %s was returned first", picked.Key)
+	case strings.Join(strings.Fields(s), " ") == strings.Join(strings.Fields(summary), " "):
+		return "rejected  summary differs in whitespace"
+	case strings.EqualFold(s, summary):
+		return "rejected  summary differs in case"
+	default:
+		return "rejected  summary differs"
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	t.Run("offline from report", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		err := runExplain(params{
+			jiraUrl:         &url.URL{Scheme: "https", Host: "jira.example.com"},
+			jiraProject:     "ROX",
+			offline:         true,
+			junitReportsDir: "testdata/jira/report.xml",
+		}, explainParams{filter: "TestDifferentBaseTypes"}, out)
+		require.NoError(t, err)
+		assert.Equal(t, `Test:     github.com/stackrox/rox/pkg/booleanpolicy/evaluator / TestDifferentBaseTypes
+Rendered: "github.com/stackrox/rox/pkg/booleanpolicy/evaluator / TestDifferentBaseTypes FAILED"
+Summary:  "github.com/stackrox/rox/pkg/booleanpolicy/evaluator / TestDifferentBaseTypes FAILED"
+
+Open issues JQL:
+project in (ROX)
+AND issuetype = Bug
+AND status != Closed
+AND labels = CI_Failure
+AND summary ~ "github.com/stackrox/rox/pkg/booleanpolicy/evaluator / TestDifferentBaseTypes FAILED"
+ORDER BY created DESC
+Search skipped in offline mode.
+
+Closed issues JQL:
+project in (ROX)
+AND issuetype = Bug
+AND status = Closed
+AND labels = CI_Failure
+AND summary ~ "github.com/stackrox/rox/pkg/booleanpolicy/evaluator / TestDifferentBaseTypes FAILED"
+ORDER BY updated DESC
+`, out.String())
+
+		err = runExplain(params{offline: true, junitReportsDir: "testdata/jira/report.xml"}, explainParams{filter: "NoSuchTest"}, out)
+		assert.EqualError(t, err, `no failed test in testdata/jira/report.xml matches "NoSuchTest"`)
+	})
+
+	t.Run("picks exact summary", func(t *testing.T) {
+		clearJiraEnv(t)
+		t.Setenv("JIRA_BEARER_TOKEN", "pat")
+		u := newFakeJira(t, "Bearer pat", map[string]string{
+			"POST /rest/api/3/search/jql": `{"issues":[
+				{"key":"ROX-1","fields":{"summary":"suite / TestA  FAILED"}},
+				{"key":"ROX-2","fields":{"summary":"suite / testa failed"}},
+				{"key":"ROX-3","fields":{"summary":"suite / TestA FAILED"}},
+				{"key":"ROX-4","fields":{"summary":"suite / TestA FAILED"}},
+				{"key":"ROX-5","fields":{"summary":"suite / TestAB FAILED"}}
+			]}`,
+		})
+		out := &bytes.Buffer{}
+		err := runExplain(params{jiraUrl: u, jiraProject: "ROX", jiraAuth: authAuto}, explainParams{suite: "suite", test: "TestA"}, out)
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), `Hits (5):
+  ROX-1  rejected  summary differs in whitespace  "suite / TestA  FAILED"
+  ROX-2  rejected  summary differs in case  "suite / testa failed"
+  ROX-3  picked    exact summary match  "suite / TestA FAILED"
+  ROX-4  rejected  also matches, but ROX-3 was returned first  "suite / TestA FAILED"
+  ROX-5  rejected  summary differs  "suite / TestAB FAILED"
+Result: comment on ROX-3
+`)
+		assert.NotContains(t, out.String(), "Closed issues JQL")
+	})
+
+	t.Run("hook", func(t *testing.T) {
+		p := params{
+			jiraUrl:         &url.URL{Scheme: "https", Host: "jira.example.com"},
+			jiraProject:     "ROX",
+			offline:         true,
+			hookCommand:     `in=$(cat); echo "$in" | grep -q '"dryRun":true' && if echo "$in" | grep -q TestA; then echo '{"testCase":{"suite":"renamed"}}'; else echo '{"skip":true}'; fi`,
+			hookMode:        hookModePerTest,
+			hookTimeout:     5 * time.Second,
+			hookErrorPolicy: hookErrorPolicyFail,
+		}
+		out := &bytes.Buffer{}
+		require.NoError(t, runExplain(p, explainParams{suite: "suite", test: "TestA"}, out))
+		assert.Contains(t, out.String(), "Test:     renamed / TestA\n")
+		assert.Contains(t, out.String(), `summary ~ "renamed / TestA FAILED"`)
+
+		out.Reset()
+		require.NoError(t, runExplain(p, explainParams{suite: "suite", test: "TestB"}, out))
+		assert.Equal(t, "Test:     suite / TestB\nResult: not filed in Jira (skipped-by-hook)\n", out.String())
+	})
+
+	t.Run("policy decision", func(t *testing.T) {
+		clearJiraEnv(t)
+		t.Setenv("JIRA_BEARER_TOKEN", "pat")
+		u := newFakeJira(t, "Bearer pat", map[string]string{
+			"POST /rest/api/3/search/jql": `{"issues":[]}`,
+		})
+		p := params{jiraUrl: u, jiraProject: "ROX", jiraAuth: authAuto, policyFile: "testdata/policy/policy.yml"}
+
+		out := &bytes.Buffer{}
+		p.JobName = "pull-gke-tests"
+		require.NoError(t, runExplain(p, explainParams{suite: "suite", test: "TestA"}, out))
+		assert.Contains(t, out.String(), "Decision: comment-only-if-exists\n")
+		assert.Contains(t, out.String(), "Hits (0):\nResult: no issue is created (comment-only-if-exists)\n")
+		assert.NotContains(t, out.String(), "create a new issue")
+		assert.NotContains(t, out.String(), "Closed issues JQL")
+
+		out.Reset()
+		p.JobName = "nightly-ocp"
+		p.Orchestrator = "openshift"
+		require.NoError(t, runExplain(p, explainParams{suite: "github.com/stackrox/rox/pkg/grpc", test: "TestA"}, out))
+		assert.Contains(t, out.String(), "Decision: report-only\nResult: not filed in Jira (report-only)\n")
+		assert.NotContains(t, out.String(), "Open issues JQL")
+
+		out.Reset()
+		p.JobName = "main"
+		require.NoError(t, runExplain(p, explainParams{suite: "suite", test: "TestA"}, out))
+		assert.Contains(t, out.String(), "Decision: create-or-comment\n")
+		assert.Contains(t, out.String(), "Result: create a new issue\n")
+	})
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	githubTokenEnv = "GITHUB_TOKEN"
+	// githubAPIVersion is the version of the REST API the requests are written for.
+	githubAPIVersion = "2022-11-28"
+	githubTimeout    = time.Minute
+	// githubCommentMaxSize keeps the comment below the 65536 characters GitHub accepts.
+	githubCommentMaxSize = 65000
+	// githubMaxAnnotations is the number of annotations GitHub accepts per check run request.
+	githubMaxAnnotations = 50
+	// githubAnnotationLimit is the length of the message and the error shown in an annotation.
+	githubAnnotationLimit = 2000
+	githubTitleLimit      = 255
+)
+
+// writeGitHubAnnotations prints an error workflow command for each failure, so that GitHub Actions shows it in
+// the run summary and, if the test was located, inline in the changed files of the PR.
+func (j junit2jira) writeGitHubAnnotations(issues []*testIssue) error {
+	if !j.githubAnnotations {
+		return nil
+	}
+	return errors.Wrap(j.renderGitHubAnnotations(issues, os.Stdout), "could not write GitHub annotations")
+}
+
+func (j junit2jira) renderGitHubAnnotations(issues []*testIssue, out io.Writer) error {
+	for _, i := range issues {
+		f := j.chatFailure(i)
+		properties := []string{}
+		if path, line := j.sourceLocation(f.testCase); path != "" {
+			properties = append(properties, "file="+githubEscapeProperty(filepath.ToSlash(path)))
+			if line > 0 {
+				properties = append(properties, fmt.Sprintf("line=%d", line))
+			}
+		}
+		properties = append(properties, "title="+githubEscapeProperty(f.title()))
+
+		if _, err := fmt.Fprintf(out, "::error %s::%s\n", strings.Join(properties, ","), githubEscapeData(j.annotationMessage(f))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// githubEscapeData escapes the message of a workflow command.
+func githubEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// githubEscapeProperty escapes a property value of a workflow command.
+func githubEscapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// githubClient calls the GitHub REST API of github.com or of a GitHub Enterprise Server.
+type githubClient struct {
+	client *http.Client
+	apiURL string
+	token  string
+}
+
+type githubComment struct {
+	ID   int64  `json:"id,omitempty"`
+	Body string `json:"body"`
+}
+
+type githubCheckRun struct {
+	ID         int64                 `json:"id,omitempty"`
+	Name       string                `json:"name,omitempty"`
+	HeadSHA    string                `json:"head_sha,omitempty"`
+	Status     string                `json:"status,omitempty"`
+	Conclusion string                `json:"conclusion,omitempty"`
+	DetailsURL string                `json:"details_url,omitempty"`
+	Output     *githubCheckRunOutput `json:"output,omitempty"`
+}
+
+type githubCheckRunOutput struct {
+	Title       string             `json:"title"`
+	Summary     string             `json:"summary"`
+	Annotations []githubAnnotation `json:"annotations,omitempty"`
+}
+
+type githubAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"`
+	Title           string `json:"title"`
+	Message         string `json:"message"`
+}
+
+func validateGitHubParams(p params) error {
+	if !p.github {
+		return nil
+	}
+	if owner, name, ok := strings.Cut(p.githubRepo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid -github-repo %q, expected owner/name", p.githubRepo)
+	}
+	if p.githubPR <= 0 && p.githubSHA == "" {
+		return errors.New("-github-pr or -github-sha is required for -github")
+	}
+	if !isURL(p.githubAPIURL) {
+		return fmt.Errorf("invalid -github-api-url %q", p.githubAPIURL)
+	}
+	return nil
+}
+
+// githubPullRequest returns the number of the pull request of a GitHub Actions ref like refs/pull/42/merge, or 0.
+func githubPullRequest(ref string) int {
+	rest, ok := strings.CutPrefix(ref, "refs/pull/")
+	if !ok {
+		return 0
+	}
+	number, _, _ := strings.Cut(rest, "/")
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// reportToGitHub updates the sticky comment on -github-pr and creates a check run on -github-sha.
+func (j junit2jira) reportToGitHub(issues []*testIssue) error {
+	if !j.github {
+		return nil
+	}
+	if j.dryRun {
+		log.Infof("Dry run: would report %d failures to GitHub %s", len(issues), j.githubRepo)
+		return nil
+	}
+	c, err := j.newGitHubClient()
+	if err != nil {
+		return err
+	}
+
+	if j.githubPR > 0 {
+		if err := j.updateGitHubComment(c, issues); err != nil {
+			return errors.Wrap(err, "could not comment on the pull request")
+		}
+	}
+	if j.githubSHA != "" {
+		if err := j.createGitHubCheckRun(c, issues); err != nil {
+			return errors.Wrap(err, "could not create check run")
+		}
+	}
+	return nil
+}
+
+// newGitHubClient returns a client of -github-api-url authenticated with GITHUB_TOKEN.
+func (j junit2jira) newGitHubClient() (githubClient, error) {
+	token, err := secret(githubTokenEnv, j.secretsDir)
+	if err != nil {
+		return githubClient{}, err
+	}
+	if token == "" {
+		return githubClient{}, fmt.Errorf("%s is required for -github", githubTokenEnv)
+	}
+	httpClient, err := j.transport.NewClient()
+	if err != nil {
+		return githubClient{}, errors.Wrap(err, "could not create HTTP client")
+	}
+	return githubClient{client: httpClient, apiURL: strings.TrimSuffix(j.githubAPIURL, "/"), token: token}, nil
+}
+
+// githubCommentMarker identifies the comment of the job, so that it is updated by later runs.
+func (j junit2jira) githubCommentMarker() string {
+	return fmt.Sprintf("<!-- junit2jira: %s -->", strings.ReplaceAll(j.JobName, "--", "- -"))
+}
+
+// updateGitHubComment replaces the comment of an earlier run of the job or adds one. No comment is added if all
+// tests passed.
+func (j junit2jira) updateGitHubComment(c githubClient, issues []*testIssue) error {
+	marker := j.githubCommentMarker()
+	existing, err := c.findComment(j.githubRepo, j.githubPR, marker)
+	if err != nil {
+		return err
+	}
+	if existing == nil && len(issues) == 0 {
+		log.Info("Not commenting on the pull request, no test failed")
+		return nil
+	}
+	comment := githubComment{Body: marker + "\n" + j.markdownReport(issues, githubCommentMaxSize-len(marker)-1)}
+	if existing != nil {
+		if err := c.do(http.MethodPatch, fmt.Sprintf("/repos/%s/issues/comments/%d", j.githubRepo, existing.ID), comment, nil); err != nil {
+			return err
+		}
+		log.Infof("Updated comment %d on pull request %d", existing.ID, j.githubPR)
+		return nil
+	}
+	if err := c.do(http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", j.githubRepo, j.githubPR), comment, &comment); err != nil {
+		return err
+	}
+	log.Infof("Added comment %d on pull request %d", comment.ID, j.githubPR)
+	return nil
+}
+
+// findComment returns the first comment of the pull request starting with marker, if any.
+func (c githubClient) findComment(repo string, pr int, marker string) (*githubComment, error) {
+	for page := 1; ; page++ {
+		var comments []githubComment
+		if err := c.do(http.MethodGet, fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100&page=%d", repo, pr, page), nil, &comments); err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			if strings.HasPrefix(comment.Body, marker) {
+				return &comment, nil
+			}
+		}
+		if len(comments) < 100 {
+			return nil, nil
+		}
+	}
+}
+
+// createGitHubCheckRun creates a completed check run with the report as summary and an annotation for each
+// located failure. Annotations are sent in batches, as GitHub accepts only 50 per request.
+func (j junit2jira) createGitHubCheckRun(c githubClient, issues []*testIssue) error {
+	d := j.chatDigest(issues)
+	conclusion := "success"
+	if len(issues) > 0 {
+		conclusion = "failure"
+	}
+	title := d.text()
+	if d.failed == 0 {
+		title = "All tests passed"
+	}
+	output := githubCheckRunOutput{Title: title, Summary: j.markdownReport(issues, githubCommentMaxSize)}
+	annotations := j.checkRunAnnotations(issues)
+	output.Annotations = annotations[:min(len(annotations), githubMaxAnnotations)]
+
+	run := githubCheckRun{
+		Name:       j.githubCheckName,
+		HeadSHA:    j.githubSHA,
+		Status:     "completed",
+		Conclusion: conclusion,
+		DetailsURL: j.BuildLink,
+		Output:     &output,
+	}
+	if err := c.do(http.MethodPost, fmt.Sprintf("/repos/%s/check-runs", j.githubRepo), run, &run); err != nil {
+		return err
+	}
+	for start := githubMaxAnnotations; start < len(annotations); start += githubMaxAnnotations {
+		output.Annotations = annotations[start:min(len(annotations), start+githubMaxAnnotations)]
+		update := githubCheckRun{Output: &output}
+		if err := c.do(http.MethodPatch, fmt.Sprintf("/repos/%s/check-runs/%d", j.githubRepo, run.ID), update, nil); err != nil {
+			return err
+		}
+	}
+	log.Infof("Created check run %d with %d annotations on %s", run.ID, len(annotations), j.githubSHA)
+	return nil
+}
+
+// checkRunAnnotations annotates the definition of each failed test. Check run annotations need a file, so failures
+// that could not be located are only listed in the summary.
+func (j junit2jira) checkRunAnnotations(issues []*testIssue) []githubAnnotation {
+	var annotations []githubAnnotation
+	for _, i := range issues {
+		f := j.chatFailure(i)
+		path, line := j.sourceLocation(f.testCase)
+		if path == "" {
+			continue
+		}
+		line = max(line, 1)
+		annotations = append(annotations, githubAnnotation{
+			Path:            filepath.ToSlash(path),
+			StartLine:       line,
+			EndLine:         line,
+			AnnotationLevel: "failure",
+			Title:           crop(f.title(), githubTitleLimit),
+			Message:         j.annotationMessage(f),
+		})
+	}
+	return annotations
+}
+
+// annotationMessage is the message and the error of a failure with a link to its issue.
+func (j junit2jira) annotationMessage(f chatFailure) string {
+	var texts []string
+	message, value := failureTexts(f.testCase, githubAnnotationLimit)
+	for _, text := range []string{message, value} {
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if f.issueKey != "" {
+		texts = append(texts, fmt.Sprintf("%s issue: %s", f.status(), f.issueURL))
+	}
+	return orDefault(strings.Join(texts, "\n"), "Test failed")
+}
+
+// do sends a request with body as JSON and decodes the response into result, if not nil.
+func (c githubClient) do(method, path string, body, result any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), githubTimeout)
+	defer cancel()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "could not marshal request")
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.apiURL+path, reader)
+	if err != nil {
+		return errors.Wrap(err, "could not create request")
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("X-GitHub-Api-Version", githubAPIVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "could not send %s %s", method, path)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GitHub answered %s to %s %s: %s", resp.Status, method, path, strings.TrimSpace(string(respBody)))
+	}
+	if result == nil {
+		return nil
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(result), "could not decode response of %s %s", method, path)
+}
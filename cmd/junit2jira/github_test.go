@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderGitHubAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	for file, content := range map[string]string{
+		"go.mod":                  "module github.com/stackrox/rox\n",
+		"pkg/grpc/server_test.go": "package grpc\n\nimport \"testing\"\n\nfunc TestServer(t *testing.T) {\n}\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(content), 0644))
+	}
+	j := chatTestJira(t)
+	j.locator = newSourceLocator(dir)
+
+	issues := []*testIssue{
+		{
+			issue:    &models.IssueScheme{Key: "ROX-1"},
+			newJIRA:  true,
+			testCase: j2jTestCase{Suite: "github.com/stackrox/rox/pkg/grpc", Name: "TestServer", Message: "expected: 1\nactual: 2"},
+		},
+		{
+			issue:    &models.IssueScheme{Key: "ROX-2"},
+			testCase: j2jTestCase{Suite: "PolicyTest", Name: "Verify policy, 100%", File: "qa/PolicyTest.groovy", Line: 7, Error: "timeout"},
+		},
+		{testCase: j2jTestCase{Suite: "Other", Name: "reported", File: "/build/elsewhere/Other.java", Line: 3}},
+	}
+	buf := bytes.NewBufferString("")
+	require.NoError(t, j.renderGitHubAnnotations(issues, buf))
+
+	assert.Equal(t, ""+
+		"::error file=pkg/grpc/server_test.go,line=5,title=ROX-1%3A github.com/stackrox/rox/pkg/grpc%3A TestServer::"+
+		"expected: 1%0Aactual: 2%0Anew issue: https://jira.example.com/browse/ROX-1\n"+
+		"::error file=qa/PolicyTest.groovy,line=7,title=ROX-2%3A PolicyTest%3A Verify policy%2C 100%25::"+
+		"timeout%0Aexisting issue: https://jira.example.com/browse/ROX-2\n"+
+		"::error title=Other%3A reported::Test failed\n", buf.String())
+}
+
+// fakeGitHub stands in for the REST API with the comments of a single pull request.
+type fakeGitHub struct {
+	t        *testing.T
+	mu       sync.Mutex
+	requests []string
+	comments []githubComment
+	runs     []githubCheckRun
+}
+
+func (g *fakeGitHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	assert.Equal(g.t, "Bearer gh-token", r.Header.Get("Authorization"))
+	assert.Equal(g.t, githubAPIVersion, r.Header.Get("X-GitHub-Api-Version"))
+	g.requests = append(g.requests, r.Method+" "+r.URL.Path)
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/stackrox/rox":
+		_, _ = w.Write([]byte(`{"full_name":"stackrox/rox"}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v3/repos/stackrox/rox/issues/7/comments":
+		_ = json.NewEncoder(w).Encode(g.comments)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v3/repos/stackrox/rox/issues/7/comments":
+		var c githubComment
+		require.NoError(g.t, json.NewDecoder(r.Body).Decode(&c))
+		c.ID = int64(100 + len(g.comments))
+		g.comments = append(g.comments, c)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(c)
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/api/v3/repos/stackrox/rox/issues/comments/"):
+		var c githubComment
+		require.NoError(g.t, json.NewDecoder(r.Body).Decode(&c))
+		for n := range g.comments {
+			if r.URL.Path == fmt.Sprintf("/api/v3/repos/stackrox/rox/issues/comments/%d", g.comments[n].ID) {
+				g.comments[n].Body = c.Body
+			}
+		}
+		_ = json.NewEncoder(w).Encode(c)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v3/repos/stackrox/rox/check-runs":
+		var run githubCheckRun
+		require.NoError(g.t, json.NewDecoder(r.Body).Decode(&run))
+		run.ID = int64(200 + len(g.runs))
+		g.runs = append(g.runs, run)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(run)
+	case r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/api/v3/repos/stackrox/rox/check-runs/"):
+		var run githubCheckRun
+		require.NoError(g.t, json.NewDecoder(r.Body).Decode(&run))
+		last := &g.runs[len(g.runs)-1]
+		assert.Equal(g.t, fmt.Sprintf("/api/v3/repos/stackrox/rox/check-runs/%d", last.ID), r.URL.Path)
+		last.Output.Annotations = append(last.Output.Annotations, run.Output.Annotations...)
+		_ = json.NewEncoder(w).Encode(last)
+	default:
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	}
+}
+
+func TestReportToGitHub(t *testing.T) {
+	g := &fakeGitHub{t: t, comments: []githubComment{{ID: 1, Body: "LGTM"}}}
+	server := httptest.NewServer(g)
+	defer server.Close()
+	t.Setenv(githubTokenEnv, "gh-token")
+
+	j := chatTestJira(t)
+	j.params.github = true
+	j.githubAPIURL = server.URL + "/api/v3/"
+	j.githubRepo = "stackrox/rox"
+	j.githubPR = 7
+	j.githubSHA = "abc123"
+	j.githubCheckName = "tests"
+	j.stats.Failed = 60
+	var issues []*testIssue
+	for n := 0; n < 60; n++ {
+		issues = append(issues, &testIssue{
+			issue:    &models.IssueScheme{Key: fmt.Sprintf("ROX-%d", n)},
+			testCase: j2jTestCase{Suite: "suite", Name: fmt.Sprintf("Test%d", n), File: "pkg/a_test.go", Line: n, Error: "failed"},
+		})
+	}
+	issues = append(issues, &testIssue{testCase: j2jTestCase{Suite: "suite", Name: "TestUnlocated"}})
+
+	require.NoError(t, j.reportToGitHub(issues))
+	assert.Equal(t, []string{
+		"GET /api/v3/repos/stackrox/rox/issues/7/comments",
+		"POST /api/v3/repos/stackrox/rox/issues/7/comments",
+		"POST /api/v3/repos/stackrox/rox/check-runs",
+		"PATCH /api/v3/repos/stackrox/rox/check-runs/200",
+	}, g.requests)
+	require.Len(t, g.comments, 2)
+	assert.True(t, strings.HasPrefix(g.comments[1].Body, "<!-- junit2jira: nightly -->\n### Failed tests"))
+	assert.Contains(t, g.comments[1].Body, "[ROX-1](https://jira.example.com/browse/ROX-1) Test1 (existing)")
+	assert.LessOrEqual(t, len(g.comments[1].Body), githubCommentMaxSize)
+
+	require.Len(t, g.runs, 1)
+	run := g.runs[0]
+	assert.Equal(t, "tests", run.Name)
+	assert.Equal(t, "abc123", run.HeadSHA)
+	assert.Equal(t, "completed", run.Status)
+	assert.Equal(t, "failure", run.Conclusion)
+	assert.Equal(t, "https://ci/42", run.DetailsURL)
+	assert.Equal(t, "nightly: 61 failed tests, 0 new issues", run.Output.Title)
+	require.Len(t, run.Output.Annotations, 60)
+	assert.Equal(t, githubAnnotation{
+		Path:            "pkg/a_test.go",
+		StartLine:       1,
+		EndLine:         1,
+		AnnotationLevel: "failure",
+		Title:           "ROX-0: suite: Test0",
+		Message:         "failed\nexisting issue: https://jira.example.com/browse/ROX-0",
+	}, run.Output.Annotations[0])
+
+	t.Run("passed after failures", func(t *testing.T) {
+		g.requests = nil
+		j.stats.Failed = 0
+		require.NoError(t, j.reportToGitHub(nil))
+		assert.Equal(t, []string{
+			"GET /api/v3/repos/stackrox/rox/issues/7/comments",
+			"PATCH /api/v3/repos/stackrox/rox/issues/comments/101",
+			"POST /api/v3/repos/stackrox/rox/check-runs",
+		}, g.requests)
+		assert.True(t, strings.HasPrefix(g.comments[1].Body, "<!-- junit2jira: nightly -->\n### All tests passed"))
+		assert.Equal(t, "success", g.runs[1].Conclusion)
+		assert.Equal(t, "All tests passed", g.runs[1].Output.Title)
+	})
+	t.Run("passed without earlier comment", func(t *testing.T) {
+		g.requests = nil
+		j.JobName = "other"
+		j.githubSHA = ""
+		require.NoError(t, j.reportToGitHub(nil))
+		assert.Equal(t, []string{"GET /api/v3/repos/stackrox/rox/issues/7/comments"}, g.requests)
+	})
+	t.Run("error", func(t *testing.T) {
+		j.githubRepo = "stackrox/missing"
+		assert.ErrorContains(t, j.reportToGitHub(nil), `GitHub answered 404 Not Found to GET /repos/stackrox/missing/issues/7/comments?per_page=100&page=1: {"message":"Not Found"}`)
+	})
+	t.Run("missing token", func(t *testing.T) {
+		t.Setenv(githubTokenEnv, "")
+		assert.ErrorContains(t, j.reportToGitHub(nil), "GITHUB_TOKEN is required for -github")
+	})
+}
+
+func TestValidateGitHubParams(t *testing.T) {
+	valid := params{github: true, githubRepo: "stackrox/rox", githubPR: 7, githubAPIURL: "https://api.github.com"}
+	assert.NoError(t, validateGitHubParams(params{}))
+	assert.NoError(t, validateGitHubParams(valid))
+
+	p := valid
+	p.githubRepo = "rox"
+	assert.EqualError(t, validateGitHubParams(p), `invalid -github-repo "rox", expected owner/name`)
+	p = valid
+	p.githubPR = 0
+	assert.EqualError(t, validateGitHubParams(p), "-github-pr or -github-sha is required for -github")
+	p = valid
+	p.githubAPIURL = "api.github.com"
+	assert.EqualError(t, validateGitHubParams(p), `invalid -github-api-url "api.github.com"`)
+}
+
+func TestGitHubPullRequest(t *testing.T) {
+	assert.Equal(t, 42, githubPullRequest("refs/pull/42/merge"))
+	assert.Equal(t, 0, githubPullRequest("refs/heads/main"))
+	assert.Equal(t, 0, githubPullRequest("refs/pull/abc/merge"))
+	assert.Equal(t, 0, githubPullRequest(""))
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+const (
+	googleChatWebhookEnv = "GOOGLE_CHAT_WEBHOOK_URL"
+	// Google Chat accepts messages of up to 32,000 bytes.
+	googleChatMaxMessageSize = 30000
+	googleChatTextLimit      = 3000
+)
+
+// googleChatNotifier renders the digest as a card v2 for Google Chat incoming webhooks.
+type googleChatNotifier struct{}
+
+type googleChatMessage struct {
+	Text    string                 `json:"text,omitempty"`
+	CardsV2 []googleChatCardWithID `json:"cardsV2"`
+}
+
+type googleChatCardWithID struct {
+	CardID string         `json:"cardId"`
+	Card   googleChatCard `json:"card"`
+}
+
+type googleChatCard struct {
+	Header   *googleChatHeader   `json:"header,omitempty"`
+	Sections []googleChatSection `json:"sections"`
+}
+
+type googleChatHeader struct {
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle,omitempty"`
+}
+
+type googleChatSection struct {
+	Header string `json:"header,omitempty"`
+	// Collapsible sections show only the first UncollapsibleWidgetsCount widgets until they are expanded.
+	Collapsible               bool               `json:"collapsible,omitempty"`
+	UncollapsibleWidgetsCount int                `json:"uncollapsibleWidgetsCount,omitempty"`
+	Widgets                   []googleChatWidget `json:"widgets"`
+}
+
+// googleChatWidget has exactly one of its fields set.
+type googleChatWidget struct {
+	TextParagraph *googleChatTextParagraph `json:"textParagraph,omitempty"`
+	DecoratedText *googleChatDecoratedText `json:"decoratedText,omitempty"`
+	ButtonList    *googleChatButtonList    `json:"buttonList,omitempty"`
+}
+
+type googleChatTextParagraph struct {
+	Text string `json:"text"`
+}
+
+type googleChatDecoratedText struct {
+	TopLabel string `json:"topLabel"`
+	Text     string `json:"text"`
+}
+
+type googleChatButtonList struct {
+	Buttons []googleChatButton `json:"buttons"`
+}
+
+type googleChatButton struct {
+	Text    string            `json:"text"`
+	OnClick googleChatOnClick `json:"onClick"`
+}
+
+type googleChatOnClick struct {
+	OpenLink googleChatOpenLink `json:"openLink"`
+}
+
+type googleChatOpenLink struct {
+	URL string `json:"url"`
+}
+
+func (googleChatNotifier) name() string {
+	return "google-chat"
+}
+
+func (googleChatNotifier) webhookEnv() string {
+	return googleChatWebhookEnv
+}
+
+func (googleChatNotifier) render(d chatDigest) []any {
+	var sections []googleChatSection
+
+	stats := googleChatSection{}
+	if d.total > 0 {
+		stats.Widgets = append(stats.Widgets, googleChatFact("Total", d.total))
+	}
+	stats.Widgets = append(stats.Widgets,
+		googleChatFact("Failed", d.failed),
+		googleChatFact("New issues", d.newIssues),
+		googleChatFact("Existing issues", d.existingIssues),
+	)
+	var buttons []googleChatButton
+	if d.buildLink != "" {
+		buttons = append(buttons, googleChatLinkButton("Open build", d.buildLink))
+	}
+	if d.reportLink != "" {
+		buttons = append(buttons, googleChatLinkButton("Open HTML report", d.reportLink))
+	}
+	if len(buttons) > 0 {
+		stats.Widgets = append(stats.Widgets, googleChatWidget{ButtonList: &googleChatButtonList{Buttons: buttons}})
+	}
+	sections = append(sections, stats)
+
+	for _, suite := range d.suites {
+		var lines []string
+		for _, f := range suite.failures {
+			lines = append(lines, "• "+f.line(html.EscapeString, googleChatLink))
+		}
+		section := googleChatSection{Header: html.EscapeString(orDefault(suite.name, "No suite"))}
+		for _, text := range joinLines(lines, googleChatTextLimit) {
+			section.Widgets = append(section.Widgets, googleChatText(text))
+		}
+		sections = append(sections, section)
+	}
+	if d.more > 0 {
+		sections = append(sections, googleChatSection{Widgets: []googleChatWidget{googleChatText(d.moreText(googleChatLink))}})
+	}
+
+	// The output of failures is collapsed, only their title is shown until the section is expanded.
+	for _, f := range d.details {
+		message, value := failureTexts(f.testCase, googleChatTextLimit)
+		if message == "" && value == "" {
+			continue
+		}
+		title := html.EscapeString(f.title())
+		if f.issueURL != "" {
+			title = googleChatLink(f.issueURL, title)
+		}
+		section := googleChatSection{Collapsible: true, UncollapsibleWidgetsCount: 1, Widgets: []googleChatWidget{googleChatText("<b>" + title + "</b>")}}
+		for _, text := range []string{message, value} {
+			if text != "" {
+				section.Widgets = append(section.Widgets, googleChatText(html.EscapeString(text)))
+			}
+		}
+		sections = append(sections, section)
+	}
+
+	parts := splitBySize(sections, googleChatMaxMessageSize, len(sections))
+	messages := make([]any, 0, len(parts))
+	for n, part := range parts {
+		card := googleChatCard{Sections: part}
+		message := googleChatMessage{}
+		if n == 0 {
+			message.Text = d.text()
+			card.Header = &googleChatHeader{Title: "Failed tests", Subtitle: d.buildContext(func(s string) string { return s }, func(_, text string) string { return text })}
+		}
+		message.CardsV2 = []googleChatCardWithID{{CardID: fmt.Sprintf("junit2jira-%d", n+1), Card: card}}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func googleChatFact(label string, value int) googleChatWidget {
+	return googleChatWidget{DecoratedText: &googleChatDecoratedText{TopLabel: label, Text: fmt.Sprint(value)}}
+}
+
+func googleChatText(text string) googleChatWidget {
+	return googleChatWidget{TextParagraph: &googleChatTextParagraph{Text: strings.ReplaceAll(text, "\n", "<br>")}}
+}
+
+func googleChatLinkButton(text, url string) googleChatButton {
+	return googleChatButton{Text: text, OnClick: googleChatOnClick{OpenLink: googleChatOpenLink{URL: url}}}
+}
+
+func googleChatLink(url, text string) string {
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), text)
+}
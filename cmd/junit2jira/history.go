@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/stackrox/junit2jira/pkg/history"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	flakyLabel  = "flaky"
+	brokenLabel = "broken"
+)
+
+// testHistory is how often a test failed recently, as recorded in the CI metrics.
+type testHistory struct {
+	Runs int `json:"runs"`
+	// FailRatio is the percentage of failed runs.
+	FailRatio int    `json:"failRatio"`
+	Window    string `json:"window"`
+}
+
+func (h testHistory) String() string {
+	if h.Runs == 0 {
+		return fmt.Sprintf("No runs recorded in the %s.", h.Window)
+	}
+	return fmt.Sprintf("Failed %d%% of %d runs in the %s.", h.FailRatio, h.Runs, h.Window)
+}
+
+// label returns flaky or broken depending on the thresholds, or nothing if there are not enough runs or failures.
+func (h testHistory) label(p params) string {
+	switch {
+	case h.Runs < p.historyMinRuns:
+		return ""
+	case h.FailRatio >= p.brokenThreshold:
+		return brokenLabel
+	case h.FailRatio >= p.flakyThreshold:
+		return flakyLabel
+	default:
+		return ""
+	}
+}
+
+func validateHistoryParams(p params) error {
+	if !p.historyEnabled {
+		return nil
+	}
+	for _, t := range []struct {
+		flag  string
+		value int
+	}{{"-flaky-threshold", p.flakyThreshold}, {"-broken-threshold", p.brokenThreshold}} {
+		if t.value < 0 || t.value > 100 {
+			return fmt.Errorf("%s must be a percentage between 0 and 100, got %d", t.flag, t.value)
+		}
+	}
+	if p.flakyThreshold >= p.brokenThreshold {
+		return fmt.Errorf("-flaky-threshold (%d) must be lower than -broken-threshold (%d)", p.flakyThreshold, p.brokenThreshold)
+	}
+	return nil
+}
+
+// addHistory adds the recent history and the matching label to failed tests. The opposite label is removed from
+// existing issues, so that an issue is never labeled both flaky and broken. History is optional, so errors are
+// only logged.
+func (j junit2jira) addHistory(tests []j2jTestCase) []j2jTestCase {
+	if j.history == nil {
+		return tests
+	}
+	jobName := j.historyJobName
+	if jobName == "" {
+		jobName = j.JobName
+	}
+
+	for i, tc := range tests {
+		runs, failRatio, err := j.history.GetRatioForTest(jobName, tc.Suite, tc.Name)
+		if err != nil && !errors.Is(err, iterator.Done) {
+			log.WithError(err).Warnf("Could not get history of %s / %s", tc.Suite, tc.Name)
+			continue
+		}
+		h := testHistory{Runs: runs, FailRatio: failRatio, Window: history.RecentWindow}
+		tests[i].History = &h
+		switch h.label(j.params) {
+		case flakyLabel:
+			tests[i].Labels = append(tests[i].Labels, flakyLabel)
+			tests[i].StaleLabels = append(tests[i].StaleLabels, brokenLabel)
+		case brokenLabel:
+			tests[i].Labels = append(tests[i].Labels, brokenLabel)
+			tests[i].StaleLabels = append(tests[i].StaleLabels, flakyLabel)
+		}
+	}
+	return tests
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jira "github.com/ctreminiom/go-atlassian/v2/jira/v3"
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/iterator"
+)
+
+type fakeHistory map[string][2]int
+
+func (f fakeHistory) GetRatioForTest(jobName, className, testName string) (int, int, error) {
+	if jobName != "nightly" {
+		return 0, 0, errors.New("unexpected job name " + jobName)
+	}
+	r, ok := f[className+" / "+testName]
+	if !ok {
+		return 0, 0, errors.Wrap(iterator.Done, "read BigQuery result")
+	}
+	if r[0] < 0 {
+		return 0, 0, errors.New("query failed")
+	}
+	return r[0], r[1], nil
+}
+
+func TestAddHistory(t *testing.T) {
+	j := junit2jira{
+		params: params{
+			JobName:         "pr",
+			historyJobName:  "nightly",
+			historyMinRuns:  10,
+			flakyThreshold:  5,
+			brokenThreshold: 90,
+		},
+		history: fakeHistory{
+			"s / flaky":  {100, 20},
+			"s / broken": {20, 95},
+			"s / stable": {100, 1},
+			"s / new":    {3, 100},
+			"s / error":  {-1, 0},
+		},
+	}
+	tests := j.addHistory([]j2jTestCase{
+		{Suite: "s", Name: "flaky", Labels: []string{"hook"}},
+		{Suite: "s", Name: "broken"},
+		{Suite: "s", Name: "stable"},
+		{Suite: "s", Name: "new"},
+		{Suite: "s", Name: "unknown"},
+		{Suite: "s", Name: "error"},
+	})
+
+	assert.Equal(t, []string{"hook", flakyLabel}, tests[0].Labels)
+	assert.Equal(t, "Failed 20% of 100 runs in the last 30 days.", tests[0].History.String())
+	assert.Equal(t, []string{brokenLabel}, tests[0].StaleLabels)
+	assert.Equal(t, []string{brokenLabel}, tests[1].Labels)
+	assert.Equal(t, []string{flakyLabel}, tests[1].StaleLabels)
+	assert.Empty(t, tests[2].StaleLabels)
+	assert.Empty(t, tests[2].Labels)
+	assert.Empty(t, tests[3].Labels)
+	assert.Equal(t, "No runs recorded in the last 30 days.", tests[4].History.String())
+	assert.Nil(t, tests[5].History)
+
+	adf := tests[0].buildADFDescription()
+	assert.Equal(t, "History", adf.Content[0].Content[0].Text)
+	assert.Equal(t, "Failed 20% of 100 runs in the last 30 days.", adf.Content[1].Content[0].Text)
+}
+
+func TestValidateHistoryParams(t *testing.T) {
+	assert.NoError(t, validateHistoryParams(params{flakyThreshold: 90, brokenThreshold: 5}))
+	assert.NoError(t, validateHistoryParams(params{historyEnabled: true, flakyThreshold: 5, brokenThreshold: 90}))
+	assert.EqualError(t, validateHistoryParams(params{historyEnabled: true, flakyThreshold: 90, brokenThreshold: 5}),
+		"-flaky-threshold (90) must be lower than -broken-threshold (5)")
+	assert.EqualError(t, validateHistoryParams(params{historyEnabled: true, flakyThreshold: 50, brokenThreshold: 50}),
+		"-flaky-threshold (50) must be lower than -broken-threshold (50)")
+	assert.EqualError(t, validateHistoryParams(params{historyEnabled: true, flakyThreshold: -1, brokenThreshold: 90}),
+		"-flaky-threshold must be a percentage between 0 and 100, got -1")
+	assert.EqualError(t, validateHistoryParams(params{historyEnabled: true, flakyThreshold: 5, brokenThreshold: 101}),
+		"-broken-threshold must be a percentage between 0 and 100, got 101")
+}
+
+func TestUpdateLabels(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+strings.TrimSpace(string(body)))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	jiraClient, err := jira.New(server.Client(), server.URL)
+	require.NoError(t, err)
+	j := junit2jira{jiraClient: jiraClient}
+	issue := &models.IssueScheme{Key: "ROX-1", Fields: &models.IssueFieldsScheme{}}
+
+	require.NoError(t, j.updateLabels(issue, []string{brokenLabel}, []string{flakyLabel}))
+	require.NoError(t, j.updateLabels(issue, []string{flakyLabel}, []string{flakyLabel}))
+	require.NoError(t, j.updateLabels(issue, nil, nil))
+	require.Len(t, requests, 2)
+	assert.Contains(t, requests[0], `{"add":"broken"}`)
+	assert.Contains(t, requests[0], `{"remove":"flaky"}`)
+	assert.Equal(t, `PUT /rest/api/3/issue/ROX-1 {"update":{"labels":[{"add":"flaky"}]}}`, requests[1])
+}
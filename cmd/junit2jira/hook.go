@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	hookModePerTest = "per-test"
+	hookModePerRun  = "per-run"
+
+	// hookErrorPolicyFail aborts the run when a hook fails.
+	hookErrorPolicyFail = "fail"
+	// hookErrorPolicyIgnore keeps the failed test unchanged when a hook fails.
+	hookErrorPolicyIgnore = "ignore"
+	// hookErrorPolicySkip does not file the failed test when a hook fails.
+	hookErrorPolicySkip = "skip"
+)
+
+// hookParams is the part of the run configuration passed to hooks.
+type hookParams struct {
+	BuildId      string `json:"buildId"`
+	JobName      string `json:"jobName"`
+	Orchestrator string `json:"orchestrator"`
+	BuildTag     string `json:"buildTag"`
+	BaseLink     string `json:"baseLink"`
+	BuildLink    string `json:"buildLink"`
+	JiraUrl      string `json:"jiraUrl"`
+	JiraProject  string `json:"jiraProject"`
+	DryRun       bool   `json:"dryRun"`
+}
+
+// hookInput is written to the hook's stdin. In per-test mode only TestCase is set, in per-run mode only TestCases.
+type hookInput struct {
+	Params    hookParams    `json:"params"`
+	TestCase  *j2jTestCase  `json:"testCase,omitempty"`
+	TestCases []j2jTestCase `json:"testCases,omitempty"`
+}
+
+// hookResult is the hook's answer for a single failed test.
+type hookResult struct {
+	// TestCase overrides fields of the failed test. Fields that are not set are kept.
+	TestCase json.RawMessage `json:"testCase,omitempty"`
+	// Labels are added to the Jira issue.
+	Labels []string `json:"labels,omitempty"`
+	// Note is added to the issue description and comment.
+	Note string `json:"note,omitempty"`
+	// Skip prevents filing the failed test.
+	Skip bool `json:"skip,omitempty"`
+}
+
+// hookOutput is read from the hook's stdout in per-run mode. Results must be in the same order as the input test cases.
+type hookOutput struct {
+	Results []hookResult `json:"results"`
+}
+
+func (p params) hookParams() hookParams {
+	hp := hookParams{
+		BuildId:      p.BuildId,
+		JobName:      p.JobName,
+		Orchestrator: p.Orchestrator,
+		BuildTag:     p.BuildTag,
+		BaseLink:     p.BaseLink,
+		BuildLink:    p.BuildLink,
+		JiraProject:  p.jiraProject,
+		DryRun:       p.dryRun,
+	}
+	if p.jiraUrl != nil {
+		hp.JiraUrl = p.jiraUrl.String()
+	}
+	return hp
+}
+
+func validateHookParams(p params) error {
+	if p.hookCommand == "" {
+		return nil
+	}
+	switch p.hookMode {
+	case hookModePerTest, hookModePerRun:
+	default:
+		return fmt.Errorf("unknown hook mode %q, expected %q or %q", p.hookMode, hookModePerTest, hookModePerRun)
+	}
+	switch p.hookErrorPolicy {
+	case hookErrorPolicyFail, hookErrorPolicyIgnore, hookErrorPolicySkip:
+	default:
+		return fmt.Errorf("unknown hook error policy %q, expected %q, %q or %q", p.hookErrorPolicy, hookErrorPolicyFail, hookErrorPolicyIgnore, hookErrorPolicySkip)
+	}
+	return nil
+}
+
+// runHooks lets an external command enrich, modify or veto failed tests before they are filed.
+func (j junit2jira) runHooks(failedTests []j2jTestCase) ([]j2jTestCase, error) {
+	if j.hookCommand == "" || len(failedTests) == 0 {
+		return failedTests, nil
+	}
+	if j.hookMode == hookModePerRun {
+		return j.runHookPerRun(failedTests)
+	}
+
+	result := make([]j2jTestCase, 0, len(failedTests))
+	for _, tc := range failedTests {
+		var out hookResult
+		var modified j2jTestCase
+		err := j.execHook(hookInput{Params: j.hookParams(), TestCase: &tc}, &out)
+		if err == nil {
+			modified, err = applyHookResult(tc, out)
+		}
+		if err != nil {
+			keep, err := j.handleHookError(tc, err)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, skipUnless(keep, tc))
+			continue
+		}
+		if out.Skip {
+			result = append(result, skipByHook(tc))
+			continue
+		}
+		result = append(result, modified)
+	}
+	return result, nil
+}
+
+func (j junit2jira) runHookPerRun(failedTests []j2jTestCase) ([]j2jTestCase, error) {
+	var out hookOutput
+	err := j.execHook(hookInput{Params: j.hookParams(), TestCases: failedTests}, &out)
+	if err == nil && out.Results == nil {
+		// Like in per-test mode, an empty answer means nothing to change.
+		return failedTests, nil
+	}
+	if err == nil && len(out.Results) != len(failedTests) {
+		err = fmt.Errorf("hook returned %d results for %d failed tests", len(out.Results), len(failedTests))
+	}
+	if err != nil {
+		err = errors.Wrap(err, "hook failed")
+		switch j.hookErrorPolicy {
+		case hookErrorPolicyFail:
+			return nil, err
+		case hookErrorPolicySkip:
+			log.WithError(err).Warn("Hook failed, no failed tests will be filed")
+			result := make([]j2jTestCase, 0, len(failedTests))
+			for _, tc := range failedTests {
+				result = append(result, skipByHook(tc))
+			}
+			return result, nil
+		default:
+			log.WithError(err).Warn("Hook failed, filing failed tests unchanged")
+			return failedTests, nil
+		}
+	}
+
+	result := make([]j2jTestCase, 0, len(failedTests))
+	for i, tc := range failedTests {
+		if out.Results[i].Skip {
+			result = append(result, skipByHook(tc))
+			continue
+		}
+		modified, err := applyHookResult(tc, out.Results[i])
+		if err != nil {
+			keep, err := j.handleHookError(tc, err)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, skipUnless(keep, tc))
+			continue
+		}
+		result = append(result, modified)
+	}
+	return result, nil
+}
+
+// skipByHook marks a failed test as not to be filed. It is kept to be reported in the summary.
+func skipByHook(tc j2jTestCase) j2jTestCase {
+	log.Infof("Hook skipped filing %s / %s", tc.Suite, tc.Name)
+	tc.skippedByHook = true
+	return tc
+}
+
+func skipUnless(keep bool, tc j2jTestCase) j2jTestCase {
+	if keep {
+		return tc
+	}
+	return skipByHook(tc)
+}
+
+// handleHookError applies the error policy to a failed test the hook failed for.
+// It returns whether the unchanged test should still be filed.
+func (j junit2jira) handleHookError(tc j2jTestCase, err error) (bool, error) {
+	err = errors.Wrapf(err, "hook failed for %s / %s", tc.Suite, tc.Name)
+	switch j.hookErrorPolicy {
+	case hookErrorPolicyFail:
+		return false, err
+	case hookErrorPolicySkip:
+		log.WithError(err).Warn("Skipping failed test")
+		return false, nil
+	default:
+		log.WithError(err).Warn("Filing failed test unchanged")
+		return true, nil
+	}
+}
+
+func (j junit2jira) execHook(in hookInput, out any) error {
+	stdin, err := json.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "could not marshal hook input")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), j.hookTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", j.hookCommand)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "JUNIT2JIRA_HOOK_MODE="+j.hookMode)
+	// Do not wait for orphaned children holding the output pipes after the timeout.
+	cmd.WaitDelay = time.Second
+
+	log.Debugf("Running hook %q", j.hookCommand)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("hook timed out after %s", j.hookTimeout)
+		}
+		return fmt.Errorf("hook exited with %w: %s", err, stderr.String())
+	}
+	if stderr.Len() > 0 {
+		log.Debugf("Hook stderr: %s", stderr.String())
+	}
+
+	// An empty answer means nothing to change.
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), out); err != nil {
+		return errors.Wrapf(err, "could not parse hook output %q", stdout.String())
+	}
+	return nil
+}
+
+func applyHookResult(tc j2jTestCase, r hookResult) (j2jTestCase, error) {
+	if len(r.TestCase) > 0 {
+		if err := json.Unmarshal(r.TestCase, &tc); err != nil {
+			return tc, errors.Wrap(err, "could not apply test case from hook")
+		}
+	}
+	tc.Labels = append(tc.Labels, r.Labels...)
+	if r.Note != "" {
+		if tc.Note != "" {
+			tc.Note += "\n"
+		}
+		tc.Note += r.Note
+	}
+	return tc, nil
+}
+
+// updateLabels adds labels to an existing issue and removes stale ones that are not added again.
+func (j junit2jira) updateLabels(issue *models.IssueScheme, labels, stale []string) error {
+	mapping := make(map[string]string, len(labels)+len(stale))
+	for _, label := range stale {
+		mapping[label] = "remove"
+	}
+	for _, label := range labels {
+		mapping[label] = "add"
+	}
+	if len(mapping) == 0 {
+		return nil
+	}
+	operations := &models.UpdateOperations{}
+	if err := operations.AddArrayOperation("labels", mapping); err != nil {
+		return err
+	}
+	response, err := j.jiraClient.Issue.Update(context.TODO(), issue.Key, false, nil, nil, operations)
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not update labels of %s: %w", issue.Key, err)
+	}
+	logEntry(issue.Key, issue.Fields.Summary).Debugf("Updated labels %v", mapping)
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHooks(t *testing.T) {
+	failedTests := []j2jTestCase{
+		{Name: "TestA", Suite: "suite", Message: "a failed"},
+		{Name: "TestB", Suite: "suite", Message: "b failed"},
+	}
+
+	samples := map[string]struct {
+		command     string
+		mode        string
+		errorPolicy string
+
+		expected       []j2jTestCase
+		expectErrorStr string
+	}{
+		"no output keeps tests": {
+			command:  "cat > /dev/null",
+			expected: failedTests,
+		},
+		"input is passed on stdin": {
+			command: `grep -q '"params":{"buildId":"1"' && echo '{"note":"seen"}'`,
+			expected: []j2jTestCase{
+				{Name: "TestA", Suite: "suite", Message: "a failed", Note: "seen"},
+				{Name: "TestB", Suite: "suite", Message: "b failed", Note: "seen"},
+			},
+		},
+		"modify fields and add labels": {
+			command: `if grep -q TestA; then echo '{"testCase":{"message":"changed"},"labels":["infra"]}'; else echo '{"skip":true}'; fi`,
+			expected: []j2jTestCase{
+				{Name: "TestA", Suite: "suite", Message: "changed", Labels: []string{"infra"}},
+				{Name: "TestB", Suite: "suite", Message: "b failed", skippedByHook: true},
+			},
+		},
+		"per run": {
+			command: `grep -q '"testCases":\[' && echo '{"results":[{"skip":true},{"labels":["x"],"note":"n"}]}'`,
+			mode:    hookModePerRun,
+			expected: []j2jTestCase{
+				{Name: "TestA", Suite: "suite", Message: "a failed", skippedByHook: true},
+				{Name: "TestB", Suite: "suite", Message: "b failed", Labels: []string{"x"}, Note: "n"},
+			},
+		},
+		"per run with no output keeps tests": {
+			command:  "cat > /dev/null",
+			mode:     hookModePerRun,
+			expected: failedTests,
+		},
+		"per run with wrong number of results": {
+			command:        `echo '{"results":[]}'`,
+			mode:           hookModePerRun,
+			expectErrorStr: "hook returned 0 results for 2 failed tests",
+		},
+		"failure with fail policy": {
+			command:        "echo boom >&2; exit 3",
+			expectErrorStr: "hook exited with exit status 3: boom",
+		},
+		"failure with ignore policy": {
+			command:     "exit 1",
+			errorPolicy: hookErrorPolicyIgnore,
+			expected:    failedTests,
+		},
+		"failure with skip policy": {
+			command:     "echo not json",
+			errorPolicy: hookErrorPolicySkip,
+			expected: []j2jTestCase{
+				{Name: "TestA", Suite: "suite", Message: "a failed", skippedByHook: true},
+				{Name: "TestB", Suite: "suite", Message: "b failed", skippedByHook: true},
+			},
+		},
+		"per run failure with skip policy": {
+			command:     "echo not json",
+			mode:        hookModePerRun,
+			errorPolicy: hookErrorPolicySkip,
+			expected: []j2jTestCase{
+				{Name: "TestA", Suite: "suite", Message: "a failed", skippedByHook: true},
+				{Name: "TestB", Suite: "suite", Message: "b failed", skippedByHook: true},
+			},
+		},
+		"timeout": {
+			command:        "sleep 5",
+			expectErrorStr: "hook timed out after 200ms",
+		},
+	}
+
+	for name, sample := range samples {
+		t.Run(name, func(t *testing.T) {
+			p := params{
+				BuildId:         "1",
+				hookCommand:     sample.command,
+				hookMode:        hookModePerTest,
+				hookTimeout:     200 * time.Millisecond,
+				hookErrorPolicy: hookErrorPolicyFail,
+			}
+			if sample.mode != "" {
+				p.hookMode = sample.mode
+			}
+			if sample.errorPolicy != "" {
+				p.hookErrorPolicy = sample.errorPolicy
+			}
+			require.NoError(t, validateHookParams(p))
+
+			actual, err := junit2jira{params: p}.runHooks(failedTests)
+			if sample.expectErrorStr != "" {
+				assert.ErrorContains(t, err, sample.expectErrorStr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, sample.expected, actual)
+		})
+	}
+}
+
+func TestSkippedByHookInSummary(t *testing.T) {
+	j := junit2jira{params: params{offline: true}}
+	issues, err := j.createIssuesOrComments([]j2jTestCase{
+		{Name: "TestA", Suite: "suite", skippedByHook: true},
+		{Name: "TestB", Suite: "suite"},
+	})
+	require.NoError(t, err)
+	require.Len(t, issues, 2)
+	assert.Equal(t, decisionSkippedByHook, issues[0].decision)
+	assert.Equal(t, decisionReportOnly, issues[1].decision)
+	assert.Equal(t, issues[1:], reportedIssues(issues))
+
+	buf := bytes.NewBufferString("")
+	require.NoError(t, j.generateSummary(issues, buf))
+	assert.Contains(t, buf.String(), `{"suite":"suite","name":"TestA","decision":"skipped-by-hook"}`)
+}
+
+func TestValidateHookParams(t *testing.T) {
+	assert.NoError(t, validateHookParams(params{}))
+	assert.ErrorContains(t, validateHookParams(params{hookCommand: "true", hookMode: "never", hookErrorPolicy: hookErrorPolicyFail}), "unknown hook mode")
+	assert.ErrorContains(t, validateHookParams(params{hookCommand: "true", hookMode: hookModePerRun, hookErrorPolicy: "retry"}), "unknown hook error policy")
+}
+
+func TestNoteInDescription(t *testing.T) {
+	tc := j2jTestCase{Name: "Test", Note: "Cluster: rox-ci-1"}
+	actual, err := tc.description()
+	require.NoError(t, err)
+	assert.Equal(t, "paragraph", actual.Content[0].Type)
+	assert.Equal(t, "Cluster: rox-ci-1", actual.Content[0].Content[0].Text)
+
+	issue := newIssue("ROX", "summary", actual, "infra")
+	assert.Equal(t, []string{"CI_Failure", "infra"}, issue.Fields.Labels)
+}
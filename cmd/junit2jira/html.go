@@ -0,0 +1,262 @@
+package main
+
+import (
+	"cmp"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+)
+
+// htmlSlowestTests is the number of tests listed as the slowest of the run.
+const htmlSlowestTests = 10
+
+//go:embed htmlOutput.html.tpl
+var htmlOutputTemplate string
+
+// htmlFuncs are available in HTML templates in addition to the builtin functions.
+var htmlFuncs = template.FuncMap{
+	"duration": formatDuration,
+}
+
+// htmlReport is the run as seen by HTML templates.
+type htmlReport struct {
+	JobName      string
+	BuildId      string
+	BuildLink    string
+	BuildTag     string
+	Orchestrator string
+	Timestamp    string
+	JiraUrl      *url.URL
+	Totals       htmlTotals
+	Suites       []htmlSuite
+	// Failures are the failed tests of all suites, in report order.
+	Failures []htmlTest
+	Slowest  []htmlTest
+	// Issues are the Jira issues the failures were filed in.
+	Issues []htmlIssue
+}
+
+type htmlTotals struct {
+	Total    int
+	Passed   int
+	Failed   int
+	Error    int
+	Skipped  int
+	Duration time.Duration
+}
+
+func (t *htmlTotals) add(test htmlTest) {
+	t.Total++
+	t.Duration += test.Duration
+	switch junit.Status(test.Status) {
+	case junit.StatusPassed:
+		t.Passed++
+	case junit.StatusFailed:
+		t.Failed++
+	case junit.StatusError:
+		t.Error++
+	case junit.StatusSkipped:
+		t.Skipped++
+	}
+}
+
+type htmlSuite struct {
+	// Name of nested suites includes the names of their parents.
+	Name   string
+	Totals htmlTotals
+	Tests  []htmlTest
+}
+
+type htmlTest struct {
+	Suite     string
+	Name      string
+	Classname string
+	Status    string
+	Duration  time.Duration
+	// Message, Error, Stdout and Stderr are excerpts of the output, only set for failed tests.
+	Message string
+	Error   string
+	Stdout  string
+	Stderr  string
+	// Issue is the Jira issue the failure was filed in, if any.
+	Issue *htmlIssue
+}
+
+// Failed tells whether the test failed or errored.
+func (t htmlTest) Failed() bool {
+	return junit.Status(t.Status) == junit.StatusFailed || junit.Status(t.Status) == junit.StatusError
+}
+
+type htmlIssue struct {
+	Key     string
+	URL     string
+	Summary string
+	New     bool
+}
+
+type htmlTestKey struct {
+	classname string
+	name      string
+}
+
+// htmlReport builds the report of all tests. Failures are matched with their issue by class name and test name,
+// Go sub tests by the name of their parent.
+func (j junit2jira) htmlReport(testSuites []junit.Suite, issues []*testIssue) htmlReport {
+	report := htmlReport{
+		JobName:      j.JobName,
+		BuildId:      j.BuildId,
+		BuildLink:    j.BuildLink,
+		BuildTag:     j.BuildTag,
+		Orchestrator: j.Orchestrator,
+		Timestamp:    j.timestamp,
+		JiraUrl:      j.jiraUrl,
+	}
+
+	byTest := make(map[htmlTestKey]*htmlIssue)
+	seen := make(map[string]bool)
+	for _, i := range issues {
+		if i.issue == nil {
+			continue
+		}
+		issue := &htmlIssue{Key: i.issue.Key, URL: j.issueURL(i.issue.Key), New: i.newJIRA}
+		if i.issue.Fields != nil {
+			issue.Summary = i.issue.Fields.Summary
+		}
+		byTest[htmlTestKey{classname: i.testCase.Suite, name: i.testCase.Name}] = issue
+		if !seen[issue.Key] {
+			seen[issue.Key] = true
+			report.Issues = append(report.Issues, *issue)
+		}
+	}
+
+	var all []htmlTest
+	var addSuites func(suites []junit.Suite, parent string)
+	addSuites = func(suites []junit.Suite, parent string) {
+		for _, s := range suites {
+			name := s.Name
+			if parent != "" {
+				name = parent + " / " + name
+			}
+			suite := htmlSuite{Name: name}
+			for _, t := range s.Tests {
+				test := j.htmlTest(name, t)
+				if test.Failed() {
+					test.Issue = byTest[htmlTestKey{classname: t.Classname, name: t.Name}]
+					if test.Issue == nil {
+						parentName, _, _ := strings.Cut(t.Name, "/")
+						test.Issue = byTest[htmlTestKey{classname: t.Classname, name: parentName}]
+					}
+					report.Failures = append(report.Failures, test)
+				}
+				suite.Tests = append(suite.Tests, test)
+				suite.Totals.add(test)
+				report.Totals.add(test)
+				all = append(all, test)
+			}
+			if len(suite.Tests) > 0 {
+				report.Suites = append(report.Suites, suite)
+			}
+			addSuites(s.Suites, name)
+		}
+	}
+	addSuites(testSuites, "")
+
+	slices.SortStableFunc(all, func(a, b htmlTest) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+	for _, t := range all[:min(len(all), htmlSlowestTests)] {
+		if t.Duration > 0 {
+			report.Slowest = append(report.Slowest, t)
+		}
+	}
+	return report
+}
+
+func (j junit2jira) htmlTest(suite string, t junit.Test) htmlTest {
+	test := htmlTest{Suite: suite, Name: t.Name, Classname: t.Classname, Status: string(t.Status), Duration: t.Duration}
+	if !test.Failed() {
+		return test
+	}
+	test.Message = t.Message
+	if t.Error != nil {
+		test.Error = t.Error.Error()
+	}
+	test.Stdout, test.Stderr = t.SystemOut, t.SystemErr
+	test.Message = j.excerpter.excerpt(test.Message, t.Name, maxTextBlockLength)
+	test.Error = j.excerpter.excerpt(test.Error, t.Name, maxTextBlockLength)
+	test.Stdout = j.excerpter.excerpt(test.Stdout, t.Name, maxTextBlockLength)
+	test.Stderr = j.excerpter.excerpt(test.Stderr, t.Name, maxTextBlockLength)
+	return test
+}
+
+// formatDuration shows short durations with two decimals and longer ones rounded to the second.
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	}
+	return d.Round(time.Second).String()
+}
+
+func validateHtmlParams(p params) error {
+	if p.htmlTemplate != "" && p.htmlOutput == "" {
+		return errors.New("-html-output is required for -html-template")
+	}
+	return nil
+}
+
+// loadHtmlTemplate parses the -html-template file or the embedded template if fileName is empty.
+func loadHtmlTemplate(fileName string) (*template.Template, error) {
+	text, name := htmlOutputTemplate, "htmlOutput.html.tpl"
+	if fileName != "" {
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("read HTML template: %s", fileName))
+		}
+		text, name = string(data), fileName
+	}
+	t, err := template.New(name).Funcs(htmlFuncs).Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("parse HTML template: %s", name))
+	}
+	return t, nil
+}
+
+// createHtml writes the report of the whole run, also when no test failed.
+func (j junit2jira) createHtml(testSuites []junit.Suite, issues []*testIssue) error {
+	if j.htmlOutput == "" {
+		return nil
+	}
+	out := os.Stdout
+	if j.htmlOutput != "-" {
+		file, err := os.Create(j.htmlOutput)
+		if err != nil {
+			return fmt.Errorf("could not create file %q: %w", j.htmlOutput, err)
+		}
+		out = file
+		defer file.Close() //nolint:errcheck
+	}
+	return j.renderHtml(testSuites, issues, out)
+}
+
+func (j junit2jira) renderHtml(testSuites []junit.Suite, issues []*testIssue, out io.Writer) error {
+	t := j.htmlTmpl
+	if t == nil {
+		var err error
+		if t, err = loadHtmlTemplate(""); err != nil {
+			return err
+		}
+	}
+	if err := t.Execute(out, j.htmlReport(testSuites, issues)); err != nil {
+		return fmt.Errorf("could not render template: %w", err)
+	}
+	return nil
+}
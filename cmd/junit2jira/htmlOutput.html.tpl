@@ -1,22 +1,100 @@
+<!DOCTYPE html>
 <html>
 <head>
-<title>Possible Flake Tests</title>
+<meta charset="utf-8">
+<title>Test report{{ if .JobName }}: {{ .JobName }}{{ end }}</title>
 <style>
 body { color: #e8e8e8; background-color: #424242; font-family: "Roboto", "Helvetica", "Arial", sans-serif }
 a { color: #ff8caa }
 a:visited { color: #ff8caa }
+table { border-collapse: collapse; margin-bottom: 1em }
+th, td { padding: 2px 8px; text-align: left; vertical-align: top }
+tr:nth-child(even) { background-color: #4c4c4c }
+pre { white-space: pre-wrap; word-break: break-all; background-color: #303030; padding: 4px }
+summary { cursor: pointer }
+.duration { text-align: right; white-space: nowrap }
+.badge { border-radius: 4px; padding: 0 4px; font-size: smaller; color: #212121 }
+.passed { background-color: #81c784 }
+.failed, .error { background-color: #e57373 }
+.skipped { background-color: #bdbdbd }
+.new { background-color: #ffb74d }
+.existing { background-color: #90caf9 }
 </style>
 </head>
 <body>
+<h1>Test report</h1>
+{{- if .JobName }}
+<p>Job: <b>{{ .JobName }}</b>
+{{- if .BuildLink }}, build <a target=_blank href="{{ .BuildLink }}">{{ or .BuildId "link" }}</a>{{ else if .BuildId }}, build {{ .BuildId }}{{ end }}
+{{- if .BuildTag }}, tag {{ .BuildTag }}{{ end }}</p>
+{{- end }}
+<table>
+<tr><td>Total</td><td><b>{{ .Totals.Total }}</b></td></tr>
+<tr><td><span class="badge passed">passed</span></td><td>{{ .Totals.Passed }}</td></tr>
+<tr><td><span class="badge failed">failed</span></td><td>{{ .Totals.Failed }}</td></tr>
+<tr><td><span class="badge error">error</span></td><td>{{ .Totals.Error }}</td></tr>
+<tr><td><span class="badge skipped">skipped</span></td><td>{{ .Totals.Skipped }}</td></tr>
+<tr><td>Duration</td><td>{{ duration .Totals.Duration }}</td></tr>
+</table>
+{{- if .Issues }}
+<h2>Jira issues</h2>
 <ul>
-{{- $url := .JiraUrl -}}
-{{- range $issue := .Issues }}
-<li><a target=_blank href="{{ $url.Parse ( print "browse/" $issue.Key ) }}">
-{{- $issue.Key }}: {{ if $issue.Fields }}{{ $issue.Fields.Summary }}{{ end -}}
-</a>
+{{- range .Issues }}
+<li><a target=_blank href="{{ .URL }}">{{ .Key }}</a>{{ if .Summary }}: {{ .Summary }}{{ end }} {{ template "issueBadge" . }}</li>
 {{- end }}
 </ul>
+{{- end }}
+{{- if .Failures }}
+<h2>Failures</h2>
+{{- range .Failures }}
+<details>
+<summary><span class="badge {{ .Status }}">{{ .Status }}</span> {{ .Suite }}: <b>{{ .Name }}</b>
+{{- with .Issue }} <a target=_blank href="{{ .URL }}">{{ .Key }}</a> {{ template "issueBadge" . }}{{ end }}</summary>
+{{- if .Message }}
+<p>Message</p>
+<pre>{{ .Message }}</pre>
+{{- end }}
+{{- if .Error }}
+<p>Error</p>
+<pre>{{ .Error }}</pre>
+{{- end }}
+{{- if .Stdout }}
+<p>Standard output</p>
+<pre>{{ .Stdout }}</pre>
+{{- end }}
+{{- if .Stderr }}
+<p>Standard error</p>
+<pre>{{ .Stderr }}</pre>
+{{- end }}
+</details>
+{{- end }}
+{{- end }}
+{{- if .Slowest }}
+<h2>Slowest tests</h2>
+<table>
+{{- range .Slowest }}
+<tr><td class="duration">{{ duration .Duration }}</td><td>{{ .Suite }}: {{ .Name }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- if .Suites }}
+<h2>Suites</h2>
+{{- range .Suites }}
+<details{{ if or .Totals.Failed .Totals.Error }} open{{ end }}>
+<summary><b>{{ or .Name "No suite" }}</b>: total {{ .Totals.Total }}, passed {{ .Totals.Passed }}, failed {{ .Totals.Failed }}, error {{ .Totals.Error }}, skipped {{ .Totals.Skipped }}, {{ duration .Totals.Duration }}</summary>
+<table>
+{{- range .Tests }}
+<tr><td><span class="badge {{ .Status }}">{{ .Status }}</span></td><td>{{ .Name }}</td><td class="duration">{{ duration .Duration }}</td><td>
+{{- with .Issue }}<a target=_blank href="{{ .URL }}">{{ .Key }}</a> {{ template "issueBadge" . }}{{ end }}</td></tr>
+{{- end }}
+</table>
+</details>
+{{- end }}
+{{- else }}
+<p>No tests found.</p>
+{{- end }}
 <br />{{- /* Workaround for PROW iframe height calculation */ -}}
 <br />
 </body>
-</html>
\ No newline at end of file
+</html>
+{{- define "issueBadge" }}{{ if .New }}<span class="badge new">new</span>{{ else }}<span class="badge existing">existing</span>{{ end }}{{ end }}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joshdk/go-junit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHtmlReport(t *testing.T) {
+	r, err := newRedactor([]string{`cluster-[a-z0-9]{5}`})
+	require.NoError(t, err)
+	j := junit2jira{redactor: r}
+
+	var tests []junit.Test
+	for n := 1; n <= 12; n++ {
+		tests = append(tests, junit.Test{Name: fmt.Sprintf("Test%d", n), Status: junit.StatusPassed, Duration: time.Duration(n) * time.Second})
+	}
+	tests = append(tests, junit.Test{Name: "TestFailed", Status: junit.StatusFailed, Error: errors.New("cannot reach cluster-abcde"), SystemOut: "out"})
+	suites := []junit.Suite{{Name: "suite", Tests: tests}}
+	_, err = j.getMergedFailedTests(suites)
+	require.NoError(t, err)
+	report := j.htmlReport(suites, nil)
+	assert.Equal(t, 1, r.count)
+
+	assert.Equal(t, htmlTotals{Total: 13, Passed: 12, Failed: 1, Duration: 78 * time.Second}, report.Totals)
+	require.Len(t, report.Slowest, htmlSlowestTests)
+	assert.Equal(t, "Test12", report.Slowest[0].Name)
+	assert.Equal(t, "Test3", report.Slowest[htmlSlowestTests-1].Name)
+
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, "cannot reach [REDACTED]", report.Failures[0].Error)
+	assert.Equal(t, "out", report.Failures[0].Stdout)
+	assert.Nil(t, report.Failures[0].Issue)
+	assert.Empty(t, report.Suites[0].Tests[0].Stdout)
+}
+
+func TestLoadHtmlTemplate(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "report.html.tpl")
+	require.NoError(t, os.WriteFile(name, []byte(`<p>{{ .JobName }}: {{ .Totals.Failed }} failed in {{ duration .Totals.Duration }}</p>`), 0644))
+	tmpl, err := loadHtmlTemplate(name)
+	require.NoError(t, err)
+
+	j := junit2jira{params: params{JobName: "<job>"}, htmlTmpl: tmpl}
+	buf := bytes.NewBufferString("")
+	suites := []junit.Suite{{Tests: []junit.Test{{Name: "a", Status: junit.StatusFailed, Duration: 1500 * time.Millisecond}}}}
+	require.NoError(t, j.renderHtml(suites, nil, buf))
+	assert.Equal(t, "<p>&lt;job&gt;: 1 failed in 1.50s</p>", buf.String())
+
+	broken := filepath.Join(dir, "broken.html.tpl")
+	require.NoError(t, os.WriteFile(broken, []byte(`{{ .JobName }`), 0644))
+	_, err = loadHtmlTemplate(broken)
+	assert.ErrorContains(t, err, "parse HTML template")
+
+	_, err = loadHtmlTemplate(filepath.Join(dir, "missing.html.tpl"))
+	assert.ErrorContains(t, err, "read HTML template")
+}
@@ -12,7 +12,10 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
+	texttemplate "text/template"
 	"time"
 	"unicode"
 
@@ -24,7 +27,9 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/slack-go/slack"
+	"github.com/stackrox/junit2jira/pkg/history"
 	"github.com/stackrox/junit2jira/pkg/testcase"
+	"github.com/stackrox/junit2jira/pkg/transport"
 )
 
 const (
@@ -40,7 +45,9 @@ AND status = Closed
 AND labels = CI_Failure
 AND summary ~ %q
 ORDER BY updated DESC`
-	linkType = "Related" // link type may vary between jira versions and configurations
+	linkType       = "Related" // link type may vary between jira versions and configurations
+	issueTypeName  = "Bug"
+	ciFailureLabel = "CI_Failure"
 	// Slack has a 150-character limit for text header
 	slackHeaderTextLengthLimit = 150
 	// Slack has a 3000-character limit for (non-field) text objects
@@ -48,28 +55,120 @@ ORDER BY updated DESC`
 )
 
 func main() {
-	var debug bool
+	// Commands other than the default run are given as first argument, e.g. junit2jira doctor -jira-project ROX
+	command := ""
+	fs := flag.CommandLine
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		fs = flag.NewFlagSet("junit2jira "+command, flag.ExitOnError)
+		args = args[1:]
+	}
+
 	p := params{}
+	var err error
+	switch command {
+	case "":
+		parseFlags(fs, args, &p)
+		err = run(p)
+	case "doctor":
+		parseFlags(fs, args, &p)
+		err = runDoctor(p, os.Stdout)
+	case "explain":
+		e := explainParams{}
+		e.addFlags(fs)
+		parseFlags(fs, args, &p)
+		err = runExplain(p, e, os.Stdout)
+	case "serve-slack":
+		s := serveSlackParams{}
+		s.addFlags(fs)
+		parseFlags(fs, args, &p)
+		err = runServeSlack(p, s)
+	default:
+		log.Fatalf("unknown command %q", command)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseFlags registers flags shared by all commands, parses them and configures logging.
+// Commands can register additional flags on fs before.
+func parseFlags(fs *flag.FlagSet, args []string, p *params) {
+	var debug bool
 	var jiraUrl string
-	flag.StringVar(&p.slackOutput, "slack-output", "", "Generate JSON output in slack format (use dash [-] for stdout)")
-	flag.StringVar(&p.htmlOutput, "html-output", "", "Generate HTML report to this file (use dash [-] for stdout)")
-	flag.StringVar(&p.csvOutput, "csv-output", "", "Convert XML to a CSV file (use dash [-] for stdout)")
-	flag.StringVar(&p.summaryOutput, "summary-output", "", "Write a summary in JSON to this file (use dash [-] for stdout)")
-	flag.StringVar(&jiraUrl, "jira-url", "https://issues.redhat.com/", "Url of JIRA instance")
-	flag.StringVar(&p.jiraProject, "jira-project", "ROX", "The JIRA project for issues")
-	flag.StringVar(&p.junitReportsDir, "junit-reports-dir", os.Getenv("ARTIFACT_DIR"), "Dir that contains jUnit reports XML files")
-	flag.BoolVar(&p.dryRun, "dry-run", false, "When set to true issues will NOT be created.")
-	flag.IntVar(&p.threshold, "threshold", 10, "Number of reported failures that should cause single issue creation.")
-	flag.StringVar(&p.timestamp, "timestamp", time.Now().Format(time.RFC3339), "Timestamp of CI test.")
-	flag.StringVar(&p.BaseLink, "base-link", "", "Link to source code at the exact version under test.")
-	flag.StringVar(&p.BuildId, "build-id", "", "Build job run ID.")
-	flag.StringVar(&p.BuildLink, "build-link", "", "Link to build job.")
-	flag.StringVar(&p.BuildTag, "build-tag", "", "Built tag or revision.")
-	flag.StringVar(&p.JobName, "job-name", "", "Name of CI job.")
-	flag.StringVar(&p.Orchestrator, "orchestrator", "", "Orchestrator name (such as GKE or OpenShift), if any.")
-	flag.BoolVar(&debug, "debug", false, "Enable debug log level")
-	versioninfo.AddFlag(flag.CommandLine)
-	flag.Parse()
+	fs.StringVar(&p.slackOutput, "slack-output", "", "Generate JSON output in slack format (use dash [-] for stdout)")
+	fs.StringVar(&p.slackDelivery, "slack-delivery", slackDeliveryNone, "Post failures to Slack: to the incoming webhook from SLACK_WEBHOOK_URL, or with the bot token from SLACK_BOT_TOKEN to -slack-channel in a thread per run (none|webhook|bot)")
+	fs.BoolVar(&p.slackActions, "slack-actions", false, "Add buttons to triage the issue of each failure in Slack, handled by junit2jira serve-slack")
+	fs.StringVar(&p.slackRoutingFile, "slack-routing-file", "", "YAML file with rules choosing the Slack channel and mention per failed test")
+	fs.StringVar(&p.htmlReportLink, "html-report-link", "", "Link to the published HTML report, shown in chat messages when not all failures are listed")
+	fs.StringVar(&p.teamsOutput, "teams-output", "", "Generate JSON output as Microsoft Teams Adaptive Card (use dash [-] for stdout)")
+	fs.StringVar(&p.googleChatOutput, "google-chat-output", "", "Generate JSON output as Google Chat card (use dash [-] for stdout)")
+	fs.StringVar(&p.discordOutput, "discord-output", "", "Generate JSON output as Discord embeds (use dash [-] for stdout)")
+	fs.StringVar(&p.webhook, "webhook", "", "URL to post the run rendered with -webhook-template to, or file to write it to (use dash [-] for stdout)")
+	fs.StringVar(&p.webhookTemplate, "webhook-template", "", "Go text/template file rendering the run as body of -webhook")
+	fs.Var(&p.webhookHeaders, "webhook-header", "Header of -webhook requests as Name=SECRET_NAME, the value is read from the environment or -secrets-dir (can be repeated)")
+	fs.StringVar(&p.smtpServer, "smtp-server", "", "SMTP server as host:port to send an email digest of failures with, credentials are read from SMTP_USERNAME and SMTP_PASSWORD")
+	fs.StringVar(&p.emailFrom, "email-from", "", "Sender of the email digest")
+	fs.Var(&p.emailTo, "email-to", "Recipient of the email digest (can be repeated)")
+	fs.StringVar(&p.emailRoutingFile, "email-routing-file", "", "YAML file with rules choosing the email recipients per failed test")
+	fs.BoolVar(&p.emailOnlyNew, "email-only-new", false, "Send the email digest only if new Jira issues were created")
+	fs.Var(&p.chatWebhooks, "chat-webhook", "Post failures to the incoming webhook of a chat service from TEAMS_WEBHOOK_URL, GOOGLE_CHAT_WEBHOOK_URL or DISCORD_WEBHOOK_URL (teams|google-chat|discord, can be repeated)")
+	fs.StringVar(&p.slackChannel, "slack-channel", "", "Default Slack channel ID or name to post to with a bot token")
+	fs.StringVar(&p.htmlOutput, "html-output", "", "Generate HTML report to this file (use dash [-] for stdout)")
+	fs.StringVar(&p.markdownOutput, "markdown-output", "", "Generate a Markdown report for GitHub job summaries and PR comments to this file (use dash [-] for stdout)")
+	fs.BoolVar(&p.githubAnnotations, "github-annotations", false, "Print a GitHub Actions error annotation for each failed test, located with the file and line of the report or -git-dir")
+	fs.BoolVar(&p.github, "github", false, "Report the run on GitHub with GITHUB_TOKEN: update a sticky comment on -github-pr and create a check run with annotations on -github-sha")
+	fs.StringVar(&p.githubAPIURL, "github-api-url", orDefault(os.Getenv("GITHUB_API_URL"), "https://api.github.com"), "Base URL of the GitHub REST API, e.g. https://github.example.com/api/v3 for GitHub Enterprise Server")
+	fs.StringVar(&p.githubRepo, "github-repo", os.Getenv("GITHUB_REPOSITORY"), "GitHub repository as owner/name")
+	fs.IntVar(&p.githubPR, "github-pr", githubPullRequest(os.Getenv("GITHUB_REF")), "Number of the pull request to comment on")
+	fs.StringVar(&p.githubSHA, "github-sha", os.Getenv("GITHUB_SHA"), "Commit to create the check run on")
+	fs.StringVar(&p.githubCheckName, "github-check-name", "junit2jira", "Name of the check run")
+	fs.StringVar(&p.htmlTemplate, "html-template", "", "Go html/template file overriding the embedded template of -html-output")
+	fs.StringVar(&p.csvOutput, "csv-output", "", "Convert XML to a CSV file (use dash [-] for stdout)")
+	fs.StringVar(&p.summaryOutput, "summary-output", "", "Write a summary in JSON to this file (use dash [-] for stdout)")
+	fs.StringVar(&jiraUrl, "jira-url", "https://issues.redhat.com/", "Url of JIRA instance")
+	fs.StringVar(&p.jiraProject, "jira-project", "ROX", "The JIRA project for issues")
+	fs.StringVar(&p.jiraAuth, "jira-auth", authAuto, "Jira authentication method (auto|basic|bearer|oauth|netrc)")
+	fs.StringVar(&p.secretsDir, "secrets-dir", "", "Dir with the secrets of all integrations stored in files named like the environment variables (e.g. a mounted Kubernetes secret)")
+	fs.StringVar(&p.secretsDir, "jira-secrets-dir", "", "Alias of -secrets-dir")
+	fs.StringVar(&p.junitReportsDir, "junit-reports-dir", os.Getenv("ARTIFACT_DIR"), "Dir that contains jUnit reports XML files")
+	fs.BoolVar(&p.dryRun, "dry-run", false, "When set to true issues will NOT be created.")
+	fs.BoolVar(&p.offline, "offline", false, "Do not use Jira at all. Outputs are generated from the reports only, no credentials are required.")
+	fs.IntVar(&p.threshold, "threshold", 10, "Number of reported failures that should cause single issue creation.")
+	fs.StringVar(&p.timestamp, "timestamp", time.Now().Format(time.RFC3339), "Timestamp of CI test.")
+	fs.StringVar(&p.BaseLink, "base-link", "", "Link to source code at the exact version under test.")
+	fs.StringVar(&p.BuildId, "build-id", "", "Build job run ID.")
+	fs.StringVar(&p.BuildLink, "build-link", "", "Link to build job.")
+	fs.StringVar(&p.BuildTag, "build-tag", "", "Built tag or revision.")
+	fs.StringVar(&p.JobName, "job-name", "", "Name of CI job.")
+	fs.StringVar(&p.Orchestrator, "orchestrator", "", "Orchestrator name (such as GKE or OpenShift), if any.")
+	fs.StringVar(&p.policyFile, "policy-file", "", "YAML file with rules deciding per failed test whether to create-or-comment, comment-only-if-exists, report-only or ignore")
+	fs.Var(&p.redactPatterns, "redact-pattern", "Regular expression of additional secrets to redact from test output (can be repeated)")
+	fs.StringVar(&p.hookCommand, "hook", "", "Shell command that can modify or skip failed tests before filing. It gets JSON on stdin and answers with JSON on stdout.")
+	fs.StringVar(&p.hookMode, "hook-mode", hookModePerTest, "Run the hook once per failed test (per-test) or once for all failed tests (per-run)")
+	fs.DurationVar(&p.hookTimeout, "hook-timeout", 30*time.Second, "Timeout of a single hook execution")
+	fs.StringVar(&p.hookErrorPolicy, "hook-error-policy", hookErrorPolicyFail, "What to do when the hook fails: fail the run, ignore the hook result or skip filing the test (fail|ignore|skip)")
+	fs.BoolVar(&p.historyEnabled, "history", false, "Add the recent fail ratio of failed tests from BigQuery to issues")
+	fs.StringVar(&p.historyJobName, "history-job-name", "", "Job name used to look up the history (default -job-name)")
+	fs.IntVar(&p.historyMinRuns, "history-min-runs", 10, "Minimal number of recent runs to label a test flaky or broken")
+	fs.IntVar(&p.flakyThreshold, "flaky-threshold", 5, "Fail ratio in percent from which a test is labeled flaky")
+	fs.IntVar(&p.brokenThreshold, "broken-threshold", 90, "Fail ratio in percent from which a test is labeled broken instead of flaky")
+	fs.StringVar(&p.gitDir, "git-dir", "", "Local git checkout of the tested revision, used to link test sources and to list commits since the last green build (requires -build-tag)")
+	fs.Var(&p.projectPackages, "project-package", "Go package or Java package prefix of the tested code, used to tell its stack frames from dependencies when -git-dir is not set (can be repeated)")
+	fs.StringVar(&p.lastGreenTag, "last-green-tag", "", "Build tag of the last green build, used for tests not found in -green-history-file")
+	fs.StringVar(&p.greenHistoryFile, "green-history-file", "", "JSON file with the last build tag where each test passed. It is updated with the passed tests of this run.")
+	fs.BoolVar(&p.suspectPackageFilter, "suspect-package-filter", false, "List only commits touching the Go package of the failed test")
+	fs.IntVar(&p.suspectCommitsMax, "suspect-commits-max", 20, "Maximal number of suspect commits listed per failed test")
+	fs.Var(&p.excerptMarkers, "excerpt-marker", "Regular expression of lines kept when long output is shortened, in addition to Go, testify and Ginkgo failures (can be repeated)")
+	fs.IntVar(&p.excerptContext, "excerpt-context", 20, "Number of lines kept before each line of interest when long output is shortened")
+	fs.BoolVar(&p.attachFullOutput, "attach-full-output", false, "Attach the full text of shortened output to the Jira issue")
+	fs.BoolVar(&debug, "debug", false, "Enable debug log level")
+	p.transport.AddFlags(fs)
+	versioninfo.AddFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		log.Fatal(err)
+	}
 
 	var err error
 
@@ -85,47 +184,162 @@ func main() {
 	if debug {
 		log.SetLevel(log.DebugLevel)
 	}
-
-	err = run(p)
-	if err != nil {
-		log.Fatal(err)
-	}
 }
 
 type junit2jira struct {
 	params
-	jiraClient *jira.Client
+	jiraClient  *jira.Client
+	redactor    *redactor
+	excerpter   *excerpter
+	policies    []*filingPolicy
+	history     history.Client
+	locator     *sourceLocator
+	slackRoutes []*slackRoute
+	slackPosts  []slackPost
+	stats       runStats
+	// webhookTmpl renders the body of -webhook.
+	webhookTmpl *texttemplate.Template
+	// htmlTmpl renders -html-output.
+	htmlTmpl    *template.Template
+	emailRoutes []*emailRoute
 }
 
 type testIssue struct {
 	issue    *models.IssueScheme
 	newJIRA  bool
 	testCase j2jTestCase
+	// decision is how the failure was handled, see filingPolicyConfig.Decision.
+	decision string
+	// slackTs is the timestamp of the Slack reply with the failure, if posted.
+	slackTs string
 }
 
-func run(p params) error {
-	// Check for username (email) for Basic Auth
-	jiraUser := os.Getenv("JIRA_USER")
-	jiraToken := os.Getenv("JIRA_TOKEN")
-	if jiraToken == "" {
-		jiraToken = os.Getenv("JIRA_PASSWORD") // backward compatibility
+// validateStdoutParams rejects more than one output written to stdout, as they would be interleaved.
+func validateStdoutParams(p params) error {
+	var stdout []string
+	for flag, output := range map[string]string{
+		"-csv-output":         p.csvOutput,
+		"-discord-output":     p.discordOutput,
+		"-google-chat-output": p.googleChatOutput,
+		"-html-output":        p.htmlOutput,
+		"-markdown-output":    p.markdownOutput,
+		"-slack-output":       p.slackOutput,
+		"-summary-output":     p.summaryOutput,
+		"-teams-output":       p.teamsOutput,
+		"-webhook":            p.webhook,
+	} {
+		if output == "-" {
+			stdout = append(stdout, flag)
+		}
+	}
+	if p.githubAnnotations {
+		stdout = append(stdout, "-github-annotations")
 	}
+	if len(stdout) > 1 {
+		slices.Sort(stdout)
+		return fmt.Errorf("only one output can be written to stdout, got %s", strings.Join(stdout, ", "))
+	}
+	return nil
+}
 
-	if jiraUser == "" || jiraToken == "" {
-		log.Fatal("JIRA_USER (email) and JIRA_TOKEN are required for Jira Cloud authentication. Get your API token at https://id.atlassian.com/manage-profile/security/api-tokens")
+func run(p params) error {
+	if err := validateHookParams(p); err != nil {
+		return err
+	}
+	if err := validateHistoryParams(p); err != nil {
+		return err
+	}
+	if err := validateSlackParams(p); err != nil {
+		return err
+	}
+	if err := validateChatParams(p); err != nil {
+		return err
+	}
+	if err := validateWebhookParams(p); err != nil {
+		return err
+	}
+	if err := validateEmailParams(p); err != nil {
+		return err
+	}
+	if err := validateGitHubParams(p); err != nil {
+		return err
+	}
+	if err := validateStdoutParams(p); err != nil {
+		return err
+	}
+	if err := validateHtmlParams(p); err != nil {
+		return err
 	}
 
-	jiraClient, err := jira.New(nil, p.jiraUrl.String())
+	r, err := newRedactor(p.redactPatterns)
 	if err != nil {
-		return errors.Wrapf(err, "could not create client for %s", p.jiraUrl)
+		return errors.Wrap(err, "could not create redactor")
 	}
 
-	jiraClient.Auth.SetBasicAuth(jiraUser, jiraToken)
-	log.Info("Using Basic Auth (email + API token)")
+	e, err := newExcerpter(p.excerptMarkers, p.excerptContext)
+	if err != nil {
+		return err
+	}
 
 	j := &junit2jira{
-		params:     p,
-		jiraClient: jiraClient,
+		params:    p,
+		redactor:  r,
+		excerpter: e,
+	}
+
+	if p.offline {
+		log.Info("Offline mode: Jira will not be searched or updated")
+	} else {
+		j.jiraClient, err = newJiraClient(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.policyFile != "" {
+		j.policies, err = loadFilingPolicyFile(p.policyFile)
+		if err != nil {
+			return errors.Wrap(err, "could not load policy file")
+		}
+	}
+
+	if p.slackRoutingFile != "" {
+		j.slackRoutes, err = loadSlackRoutingFile(p.slackRoutingFile)
+		if err != nil {
+			return errors.Wrap(err, "could not load Slack routing file")
+		}
+	}
+
+	if p.emailRoutingFile != "" {
+		j.emailRoutes, err = loadEmailRoutingFile(p.emailRoutingFile)
+		if err != nil {
+			return errors.Wrap(err, "could not load email routing file")
+		}
+	}
+
+	if p.webhookTemplate != "" {
+		j.webhookTmpl, err = loadWebhookTemplate(p.webhookTemplate)
+		if err != nil {
+			return errors.Wrap(err, "could not load webhook template")
+		}
+	}
+
+	if p.htmlOutput != "" {
+		j.htmlTmpl, err = loadHtmlTemplate(p.htmlTemplate)
+		if err != nil {
+			return errors.Wrap(err, "could not load HTML template")
+		}
+	}
+
+	if p.gitDir != "" {
+		j.locator = newSourceLocator(p.gitDir)
+	}
+
+	if p.historyEnabled {
+		j.history, err = history.NewBigQueryClient(p.transport)
+		if err != nil {
+			return errors.Wrap(err, "could not create history client")
+		}
 	}
 
 	testSuites, err := testcase.LoadTestSuites(p.junitReportsDir)
@@ -133,6 +347,8 @@ func run(p params) error {
 		log.Fatalf("could not read files: %s", err)
 	}
 
+	j.stats = countTests(testSuites)
+
 	err = j.createCsv(testSuites)
 	if err != nil {
 		log.Fatalf("could not create CSV: %s", err)
@@ -143,19 +359,77 @@ func run(p params) error {
 		return errors.Wrap(err, "could not find failed tests")
 	}
 
+	failedTests = j.addHistory(failedTests)
+	failedTests = j.addSourceLinks(failedTests)
+	failedTests = j.addStackTraces(failedTests)
+
+	failedTests = j.addSuspectCommits(failedTests)
+
+	failedTests, err = j.runHooks(failedTests)
+	if err != nil {
+		return errors.Wrap(err, "could not run hooks")
+	}
+
+	// Hooks and suspect commits add text that was not in the reports, so it is redacted before any output.
+	if j.redactor != nil {
+		for i, tc := range failedTests {
+			failedTests[i] = j.redactor.redactTestCase(tc)
+		}
+		if j.redactor.count > 0 {
+			log.Warnf("Redacted %d secrets from test output", j.redactor.count)
+		}
+	}
+
 	issues, err := j.createIssuesOrComments(failedTests)
 	if err != nil {
 		return errors.Wrap(err, "could not create issues or comments")
 	}
 
-	err = j.createSlackMessage(issues)
+	err = j.createSlackMessage(reportedIssues(issues))
 	if err != nil {
 		return errors.Wrap(err, "could not convert to slack")
 	}
 
+	j.slackPosts, err = j.postSlackMessages(reportedIssues(issues))
+	if err != nil {
+		return errors.Wrap(err, "could not post to Slack")
+	}
+
+	err = j.notifyChats(reportedIssues(issues))
+	if err != nil {
+		return errors.Wrap(err, "could not notify chats")
+	}
+
+	err = j.createMarkdown(reportedIssues(issues))
+	if err != nil {
+		return errors.Wrap(err, "could not create Markdown report")
+	}
+
+	err = j.writeGitHubAnnotations(reportedIssues(issues))
+	if err != nil {
+		return errors.Wrap(err, "could not write GitHub annotations")
+	}
+
+	err = j.reportToGitHub(reportedIssues(issues))
+	if err != nil {
+		return errors.Wrap(err, "could not report to GitHub")
+	}
+
+	err = j.sendWebhook(reportedIssues(issues))
+	if err != nil {
+		return errors.Wrap(err, "could not send webhook")
+	}
+
+	err = j.sendEmails(reportedIssues(issues))
+	if err != nil {
+		return errors.Wrap(err, "could not send emails")
+	}
+
 	jiraIssues := make([]*models.IssueScheme, 0, len(issues))
 	for _, i := range issues {
-		jiraIssues = append(jiraIssues, i.issue)
+		if i.issue != nil {
+			jiraIssues = append(jiraIssues, i.issue)
+		}
 	}
 
 	err = j.linkIssues(jiraIssues)
@@ -168,10 +442,18 @@ func run(p params) error {
 		return errors.Wrap(err, "could not write summary")
 	}
 
-	return errors.Wrap(j.createHtml(jiraIssues), "could not create HTML report")
+	err = j.recordGreenTests(testSuites)
+	if err != nil {
+		return errors.Wrap(err, "could not record green tests")
+	}
+
+	return errors.Wrap(j.createHtml(testSuites, issues), "could not create HTML report")
 }
 
 func (j junit2jira) getMergedFailedTests(testSuites []junit.Suite) ([]j2jTestCase, error) {
+	if j.redactor != nil {
+		j.redactor.redactSuites(testSuites)
+	}
 	failedTests, err := testcase.GetFailedTests(testSuites)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not get failed tests")
@@ -180,7 +462,7 @@ func (j junit2jira) getMergedFailedTests(testSuites []junit.Suite) ([]j2jTestCas
 
 	failedJ2jTests := make([]j2jTestCase, 0, len(failedTests))
 	for _, failedTest := range failedTests {
-		failedJ2jTests = append(failedJ2jTests, newJ2jTestCase(failedTest, j.params))
+		failedJ2jTests = append(failedJ2jTests, j.newJ2jTestCase(failedTest))
 	}
 
 	if 0 < j.threshold && j.threshold < len(failedTests) {
@@ -193,72 +475,67 @@ func (j junit2jira) getMergedFailedTests(testSuites []junit.Suite) ([]j2jTestCas
 	return failedJ2jTests, nil
 }
 
-//go:embed htmlOutput.html.tpl
-var htmlOutputTemplate string
-
+// createSlackMessage writes the Slack messages as JSON. The first message is written to -slack-output and
+// further ones, if the failures do not fit in one, to files with a number added, e.g. slack-2.json.
+// Messages routed to other channels are written to files named after the channel, e.g. slack-scanner-ci.json.
+// On stdout the messages are written one per line, with routing as payloads with the channel.
 func (j junit2jira) createSlackMessage(tc []*testIssue) error {
 	if j.slackOutput == "" {
 		return nil
 	}
-	slackMsg := convertJunitToSlack(tc...)
-	if slackMsg == nil {
-		slackMsg = []slack.Attachment{}
+	destinations := routeSlack(j.slackRoutes, tc)
+	if len(destinations) == 0 {
+		destinations = []*slackDestination{{}}
 	}
 
-	b, err := json.Marshal(slackMsg)
-	if err != nil {
-		return fmt.Errorf("error while marshaling Slack message to json: %w", err)
-	}
-	out := os.Stdout
-	if j.slackOutput != "-" {
-		file, err := os.Create(j.slackOutput)
-		if err != nil {
-			return fmt.Errorf("could not create file %q: %w", j.slackOutput, err)
+	for _, d := range destinations {
+		messages := j.convertJunitToSlack(d.mentions, d.issues...)
+		if len(messages) == 0 {
+			messages = [][]slack.Attachment{{}}
 		}
-		out = file
-		defer file.Close() //nolint:errcheck
-	}
-	_, err = fmt.Fprintf(out, "%s", string(b))
-	if err != nil {
-		return fmt.Errorf("error while marshaling Slack message to json: %w", err)
-	}
-	return nil
-}
-
-func (j junit2jira) createHtml(issues []*models.IssueScheme) error {
-	if j.htmlOutput == "" || len(issues) == 0 {
-		return nil
-	}
-	out := os.Stdout
-	if j.htmlOutput != "-" {
-		file, err := os.Create(j.htmlOutput)
-		if err != nil {
-			return fmt.Errorf("could not create file %q: %w", j.htmlOutput, err)
+		for n, slackMsg := range messages {
+			var b []byte
+			var err error
+			if j.slackOutput == "-" && len(j.slackRoutes) > 0 {
+				b, err = json.Marshal(slackPayload{Channel: d.channel, Attachments: slackMsg})
+			} else {
+				b, err = json.Marshal(slackMsg)
+			}
+			if err != nil {
+				return fmt.Errorf("error while marshaling Slack message to json: %w", err)
+			}
+			if j.slackOutput == "-" {
+				if _, err := fmt.Fprintf(os.Stdout, "%s\n", b); err != nil {
+					return fmt.Errorf("could not write Slack message: %w", err)
+				}
+				continue
+			}
+			name := messageOutputName(j.slackOutput, d.outputName(), n)
+			if err := os.WriteFile(name, b, 0644); err != nil {
+				return fmt.Errorf("could not create file %q: %w", name, err)
+			}
 		}
-		out = file
-		defer file.Close() //nolint:errcheck
 	}
-	return j.renderHtml(issues, out)
+	return nil
 }
 
-type htmlData struct {
-	Issues  []*models.IssueScheme
-	JiraUrl *url.URL
+// slackPayload is a message with its channel, as posted to chat.postMessage.
+type slackPayload struct {
+	Channel     string             `json:"channel,omitempty"`
+	Attachments []slack.Attachment `json:"attachments"`
 }
 
-func (j junit2jira) renderHtml(issues []*models.IssueScheme, out io.Writer) error {
-	t, err := template.New(j.htmlOutput).Parse(htmlOutputTemplate)
-	if err != nil {
-		return fmt.Errorf("could parse template: %w", err)
+// messageOutputName adds the destination and the number of the message, if not the first, to the output file name.
+func messageOutputName(output, destination string, n int) string {
+	ext := filepath.Ext(output)
+	name := strings.TrimSuffix(output, ext)
+	if destination != "" {
+		name += "-" + destination
 	}
-	err = t.Execute(out, htmlData{
-		Issues:  issues,
-		JiraUrl: j.jiraUrl,
-	})
-	if err != nil {
-		return fmt.Errorf("could not render template: %w", err)
+	if n > 0 {
+		name += fmt.Sprintf("-%d", n+1)
 	}
-	return nil
+	return name + ext
 }
 
 func (j junit2jira) createCsv(testSuites []junit.Suite) error {
@@ -281,17 +558,44 @@ func (j junit2jira) createIssuesOrComments(failedTests []j2jTestCase) ([]*testIs
 	var result error
 	issues := make([]*testIssue, 0, len(failedTests))
 	for _, tc := range failedTests {
-		issue, err := j.createIssueOrComment(tc)
+		decision := decide(j.policies, tc)
+		if tc.skippedByHook {
+			decision = decisionSkippedByHook
+		}
+		if j.offline && decision != decisionIgnore && decision != decisionSkippedByHook {
+			decision = decisionReportOnly
+		}
+		var issue *testIssue
+		var err error
+		switch decision {
+		case decisionCreateOrComment, decisionCommentOnlyIfExists:
+			issue, err = j.createIssueOrComment(tc, decision == decisionCreateOrComment)
+		default:
+			logEntry("?", tc.Suite+" / "+tc.Name).Infof("Not filing in Jira: %s", decision)
+			issue = &testIssue{testCase: tc}
+		}
 		if err != nil {
 			result = multierror.Append(result, err)
 		}
 		if issue != nil {
+			issue.decision = decision
 			issues = append(issues, issue)
 		}
 	}
 	return issues, result
 }
 
+// reportedIssues filters out failures that should not be included in reports.
+func reportedIssues(issues []*testIssue) []*testIssue {
+	reported := make([]*testIssue, 0, len(issues))
+	for _, i := range issues {
+		if i.decision != decisionIgnore && i.decision != decisionSkippedByHook {
+			reported = append(reported, i)
+		}
+	}
+	return reported
+}
+
 func (j junit2jira) linkIssues(issues []*models.IssueScheme) error {
 	var result error
 	for x, issue := range issues {
@@ -343,7 +647,18 @@ func (j junit2jira) linkToClosedTicket(newIssue, closedIssue *models.IssueScheme
 	return nil
 }
 
-func (j junit2jira) createIssueOrComment(tc j2jTestCase) (*testIssue, error) {
+// updateDescription replaces the description of an issue.
+func (j junit2jira) updateDescription(issueKey string, description *models.CommentNodeScheme) error {
+	payload := &models.IssueScheme{Fields: &models.IssueFieldsScheme{Description: description}}
+	response, err := j.jiraClient.Issue.Update(context.TODO(), issueKey, false, payload, nil, nil)
+	if err != nil {
+		logError(err, response)
+		return fmt.Errorf("could not update description of %s: %w", issueKey, err)
+	}
+	return nil
+}
+
+func (j junit2jira) createIssueOrComment(tc j2jTestCase, allowCreate bool) (*testIssue, error) {
 	summary, err := tc.summary()
 	if err != nil {
 		return nil, fmt.Errorf("could not get summary: %w", err)
@@ -354,32 +669,29 @@ func (j junit2jira) createIssueOrComment(tc j2jTestCase) (*testIssue, error) {
 	}
 	const NA = "?"
 	logEntry(NA, summary).Debug("Searching for issue")
-	searchResult, response, err := j.jiraClient.Issue.Search.SearchJQL(
-		context.TODO(),
-		fmt.Sprintf(jql, j.jiraProject, summary),
-		[]string{"summary"}, // fields - request summary field
-		nil,                 // expand
-		50,                  // maxResults
-		"",                  // nextPageToken (empty for first page)
-	)
+	openIssues, err := j.searchOpenIssues(summary)
 	if err != nil {
-		logError(err, response)
-		return nil, fmt.Errorf("could not search: %w", err)
+		return nil, err
 	}
 
-	issue := findMatchingIssue(searchResult.Issues, summary)
+	issue := findMatchingIssue(openIssues, summary)
 	issueWithTestCase := testIssue{
 		issue:    issue,
 		testCase: tc,
 	}
 
+	if issue == nil && !allowCreate {
+		logEntry(NA, summary).Info("Issue not found. Not creating new issue because of policy.")
+		return &issueWithTestCase, nil
+	}
+
 	if issue == nil {
 		logEntry(NA, summary).Info("Issue not found. Creating new issue...")
 		if j.dryRun {
 			logEntry(NA, summary).Debug("Dry run: would create new issue")
 			return nil, nil
 		}
-		issue = newIssue(j.jiraProject, summary, description)
+		issue = newIssue(j.jiraProject, summary, description, tc.Labels...)
 		create, response, err := j.jiraClient.Issue.Create(context.TODO(), issue, nil)
 		if err != nil {
 			logError(err, response)
@@ -393,6 +705,16 @@ func (j junit2jira) createIssueOrComment(tc j2jTestCase) (*testIssue, error) {
 		issueWithTestCase.issue = issue
 		issueWithTestCase.newJIRA = true
 
+		if missing, err := j.attachFullOutput(issue.Key, tc); err != nil {
+			logEntry(issue.Key, summary).WithError(err).Warn("Failed to attach full output")
+			// The description must not point to attachments that do not exist.
+			tc = tc.withMissingAttachments(missing)
+			issueWithTestCase.testCase = tc
+			if err := j.updateDescription(issue.Key, tc.buildADFDescription()); err != nil {
+				logEntry(issue.Key, summary).WithError(err).Warn("Failed to update description")
+			}
+		}
+
 		closedIssue, err := j.findMostRecentClosedIssue(summary)
 		if err != nil {
 			logEntry(issue.Key, summary).WithError(err).Warn("Failed to search for closed tickets")
@@ -425,12 +747,38 @@ func (j junit2jira) createIssueOrComment(tc j2jTestCase) (*testIssue, error) {
 		return &issueWithTestCase, nil
 	}
 
+	// Attach first, so that the comment only points to attachments that exist.
+	if missing, err := j.attachFullOutput(issue.Key, tc); err != nil {
+		logEntry(issue.Key, summary).WithError(err).Warn("Failed to attach full output")
+		tc = tc.withMissingAttachments(missing)
+		issueWithTestCase.testCase = tc
+		description = tc.buildADFDescription()
+		comment.Body = description
+	}
+
+	comparison, err := j.compareWithPrevious(issue.Key, tc)
+	if err != nil {
+		logEntry(issue.Key, summary).WithError(err).Warn("Failed to compare with previous occurrence")
+	}
+	if len(comparison) > 0 {
+		comment.Body = &models.CommentNodeScheme{
+			Version: description.Version,
+			Type:    description.Type,
+			Content: append(comparison, description.Content...),
+		}
+	}
+
 	addComment, response, err := j.jiraClient.Issue.Comment.Add(context.TODO(), issue.Key, comment, nil)
 	if err != nil {
 		logError(err, response)
 		return nil, fmt.Errorf("could not comment on issue %s: %w", summary, err)
 	}
 	logEntry(issue.Key, summary).Infof("Created comment %s", addComment.ID)
+
+	err = j.updateLabels(issue, tc.Labels, tc.StaleLabels)
+	if err != nil {
+		logEntry(issue.Key, summary).WithError(err).Warn("Failed to update labels")
+	}
 	return &issueWithTestCase, nil
 }
 
@@ -448,23 +796,55 @@ func (j junit2jira) writeSummary(tc []*testIssue) error {
 		defer file.Close() //nolint:errcheck
 	}
 
-	return generateSummary(tc, out)
+	return j.generateSummary(tc, out)
 }
 
 type summary struct {
-	NewJIRAs int `json:"newJIRAs"`
+	NewJIRAs   int           `json:"newJIRAs"`
+	Redactions int           `json:"redactions,omitempty"`
+	Tests      []testSummary `json:"tests,omitempty"`
+	Slack      []slackPost   `json:"slack,omitempty"`
+}
+
+type testSummary struct {
+	Suite    string `json:"suite"`
+	Name     string `json:"name"`
+	Decision string `json:"decision"`
+	Issue    string `json:"issue,omitempty"`
+	NewJIRA  bool   `json:"newJIRA,omitempty"`
+	TopFrame string `json:"topFrame,omitempty"`
+	SlackTs  string `json:"slackTs,omitempty"`
 }
 
-func generateSummary(tc []*testIssue, output io.Writer) error {
+func (j junit2jira) generateSummary(tc []*testIssue, output io.Writer) error {
 	newJIRAs := 0
 
+	tests := make([]testSummary, 0, len(tc))
+
 	for _, testIssue := range tc {
 		if testIssue.newJIRA {
 			newJIRAs++
 		}
+		test := testSummary{
+			Suite:    testIssue.testCase.Suite,
+			Name:     testIssue.testCase.Name,
+			Decision: testIssue.decision,
+			NewJIRA:  testIssue.newJIRA,
+			TopFrame: testIssue.testCase.TopFrame,
+			SlackTs:  testIssue.slackTs,
+		}
+		if testIssue.issue != nil {
+			test.Issue = testIssue.issue.Key
+		}
+		tests = append(tests, test)
 	}
 	summary := summary{
 		NewJIRAs: newJIRAs,
+		Tests:    tests,
+		Slack:    j.slackPosts,
+	}
+	if j.redactor != nil {
+		summary.Redactions = j.redactor.count
 	}
 
 	json, err := json.Marshal(summary)
@@ -482,18 +862,18 @@ func logEntry(id, summary string) *log.Entry {
 	return log.WithField("ID", id).WithField("summary", summary)
 }
 
-func newIssue(project string, summary string, description *models.CommentNodeScheme) *models.IssueScheme {
+func newIssue(project string, summary string, description *models.CommentNodeScheme, labels ...string) *models.IssueScheme {
 	return &models.IssueScheme{
 		Fields: &models.IssueFieldsScheme{
 			IssueType: &models.IssueTypeScheme{
-				Name: "Bug",
+				Name: issueTypeName,
 			},
 			Project: &models.ProjectScheme{
 				Key: project,
 			},
 			Summary:     summary,
 			Description: description,
-			Labels:      []string{"CI_Failure"},
+			Labels:      append([]string{ciFailureLabel}, labels...),
 		},
 	}
 }
@@ -507,12 +887,29 @@ func findMatchingIssue(search []*models.IssueScheme, summary string) *models.Iss
 	return nil
 }
 
-func (j junit2jira) findMostRecentClosedIssue(summary string) (*models.IssueScheme, error) {
-	jqlQuery := fmt.Sprintf(jqlClosedTicketsQuery, j.jiraProject, summary)
+// searchOpenIssues returns open issues found by the JQL text search. The search is fuzzy, so the results
+// have to be filtered with findMatchingIssue.
+func (j junit2jira) searchOpenIssues(summary string) ([]*models.IssueScheme, error) {
+	searchResult, response, err := j.jiraClient.Issue.Search.SearchJQL(
+		context.TODO(),
+		fmt.Sprintf(jql, j.jiraProject, summary),
+		[]string{"summary"}, // fields - request summary field
+		nil,                 // expand
+		50,                  // maxResults
+		"",                  // nextPageToken (empty for first page)
+	)
+	if err != nil {
+		logError(err, response)
+		return nil, fmt.Errorf("could not search: %w", err)
+	}
+	return searchResult.Issues, nil
+}
 
+// searchClosedIssues returns the most recently updated closed issue found by the JQL text search, if any.
+func (j junit2jira) searchClosedIssues(summary string) ([]*models.IssueScheme, error) {
 	search, response, err := j.jiraClient.Issue.Search.SearchJQL(
 		context.Background(),
-		jqlQuery,
+		fmt.Sprintf(jqlClosedTicketsQuery, j.jiraProject, summary),
 		[]string{"summary", "updated"}, // fields
 		nil,                            // expand
 		1,                              // maxResults: only need the most recent
@@ -526,11 +923,18 @@ func (j junit2jira) findMostRecentClosedIssue(summary string) (*models.IssueSche
 		return nil, fmt.Errorf("search closed tickets: %w", err)
 	}
 
-	if search == nil || len(search.Issues) == 0 {
+	if search == nil {
 		return nil, nil
 	}
+	return search.Issues, nil
+}
 
-	return findMatchingIssue(search.Issues, summary), nil
+func (j junit2jira) findMostRecentClosedIssue(summary string) (*models.IssueScheme, error) {
+	issues, err := j.searchClosedIssues(summary)
+	if err != nil {
+		return nil, err
+	}
+	return findMatchingIssue(issues, summary), nil
 }
 
 func logError(e error, response *models.ResponseScheme) {
@@ -616,12 +1020,12 @@ func (j junit2jira) mergeFailedTests(failedTests []j2jTestCase) ([]j2jTestCase,
 		msg.WriteString(summary + "\n")
 	}
 
-	tc := newJ2jTestCase(
+	tc := j.newJ2jTestCase(
 		testcase.NewTestCase(
 			junit.Test{
 				Message:   msg.String(),
 				Classname: suite,
-			}), j.params)
+			}))
 
 	return []j2jTestCase{tc}, nil
 }
@@ -631,20 +1035,49 @@ const (
 )
 
 type j2jTestCase struct {
-	Name    string
-	Suite   string
-	Message string
-	Stdout  string
-	Stderr  string
-	Error   string
+	Name    string `json:"name"`
+	Suite   string `json:"suite"`
+	Message string `json:"message"`
+	Stdout  string `json:"stdout"`
+	Stderr  string `json:"stderr"`
+	Error   string `json:"error"`
 
 	// Additional fields for junit2jira
-	BuildId      string
-	JobName      string
-	Orchestrator string
-	BuildTag     string
-	BaseLink     string
-	BuildLink    string
+	BuildId      string `json:"buildId"`
+	JobName      string `json:"jobName"`
+	Orchestrator string `json:"orchestrator"`
+	BuildTag     string `json:"buildTag"`
+	BaseLink     string `json:"baseLink"`
+	BuildLink    string `json:"buildLink"`
+
+	// Labels are added to the Jira issue in addition to CI_Failure.
+	Labels []string `json:"labels,omitempty"`
+	// StaleLabels are removed from an existing Jira issue, e.g. flaky once the test is labeled broken.
+	StaleLabels []string `json:"staleLabels,omitempty"`
+	// Note is additional text shown at the top of the issue description.
+	Note string `json:"note,omitempty"`
+	// History is how often the test failed recently, if known.
+	History *testHistory `json:"history,omitempty"`
+	// File and Line are the location of the test as reported.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	// AttachFullOutput is set if shortened output is attached to the issue.
+	AttachFullOutput bool `json:"attachFullOutput,omitempty"`
+	// SourceLink is a link to the definition of the test, if found.
+	SourceLink string `json:"sourceLink,omitempty"`
+	// StackTrace are the frames parsed from the failure.
+	StackTrace []frame `json:"stackTrace,omitempty"`
+	// TopFrame is the first frame of the tested code in the stack trace, if any.
+	TopFrame string `json:"topFrame,omitempty"`
+	// SuspectCommits are the changes since the last build where the test passed, if known.
+	SuspectCommits *suspectCommits `json:"suspectCommits,omitempty"`
+
+	// excerpter shortens long output in the issue and in messages.
+	excerpter *excerpter
+	// missingAttachments are the fields whose full output could not be attached although AttachFullOutput is set.
+	missingAttachments []string
+	// skippedByHook is set if a hook vetoed filing the test. It is then only reported in the summary.
+	skippedByHook bool
 }
 
 type params struct {
@@ -655,19 +1088,85 @@ type params struct {
 	BaseLink     string
 	BuildLink    string
 
-	threshold       int
-	dryRun          bool
-	jiraUrl         *url.URL
-	jiraProject     string
-	junitReportsDir string
-	timestamp       string
-	csvOutput       string
-	htmlOutput      string
-	slackOutput     string
-	summaryOutput   string
+	threshold        int
+	dryRun           bool
+	offline          bool
+	jiraUrl          *url.URL
+	jiraProject      string
+	jiraAuth         string
+	secretsDir       string
+	junitReportsDir  string
+	timestamp        string
+	csvOutput        string
+	htmlOutput       string
+	htmlTemplate     string
+	markdownOutput   string
+	slackOutput      string
+	slackDelivery    string
+	slackChannel     string
+	htmlReportLink   string
+	slackRoutingFile string
+	slackActions     bool
+	teamsOutput      string
+	googleChatOutput string
+	discordOutput    string
+	chatWebhooks     stringList
+	webhook          string
+	webhookTemplate  string
+	webhookHeaders   stringList
+	smtpServer       string
+	emailFrom        string
+	emailTo          stringList
+	emailRoutingFile string
+	emailOnlyNew     bool
+	summaryOutput    string
+	redactPatterns   stringList
+	policyFile       string
+	transport        transport.Options
+	hookCommand      string
+	hookMode         string
+	hookTimeout      time.Duration
+	hookErrorPolicy  string
+	historyEnabled   bool
+	historyJobName   string
+	historyMinRuns   int
+	flakyThreshold   int
+	brokenThreshold  int
+
+	gitDir               string
+	lastGreenTag         string
+	greenHistoryFile     string
+	suspectPackageFilter bool
+	suspectCommitsMax    int
+	projectPackages      stringList
+
+	excerptMarkers   stringList
+	excerptContext   int
+	attachFullOutput bool
+
+	githubAnnotations bool
+	github            bool
+	githubAPIURL      string
+	githubRepo        string
+	githubPR          int
+	githubSHA         string
+	githubCheckName   string
+}
+
+// stringList is a flag.Value collecting all values of a repeated flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
 
-func newJ2jTestCase(testCase testcase.TestCase, p params) j2jTestCase {
+func (j junit2jira) newJ2jTestCase(testCase testcase.TestCase) j2jTestCase {
+	p := j.params
 	return j2jTestCase{
 		Name:         testCase.Name,
 		Suite:        testCase.Suite,
@@ -681,6 +1180,11 @@ func newJ2jTestCase(testCase testcase.TestCase, p params) j2jTestCase {
 		BuildTag:     p.BuildTag,
 		BaseLink:     p.BaseLink,
 		BuildLink:    p.BuildLink,
+		File:         testCase.File,
+		Line:         testCase.Line,
+		// Nothing can be attached without Jira.
+		AttachFullOutput: p.attachFullOutput && !p.offline,
+		excerpter:        j.excerpter,
 	}
 }
 
@@ -692,6 +1196,16 @@ func (tc *j2jTestCase) description() (*models.CommentNodeScheme, error) {
 func (tc *j2jTestCase) buildADFDescription() *models.CommentNodeScheme {
 	content := []*models.CommentNodeScheme{}
 
+	// Add Note section if present
+	if tc.Note != "" {
+		content = append(content, &models.CommentNodeScheme{
+			Type: "paragraph",
+			Content: []*models.CommentNodeScheme{
+				{Type: "text", Text: tc.Note},
+			},
+		})
+	}
+
 	// Add Message section if present
 	if tc.Message != "" {
 		content = append(content, &models.CommentNodeScheme{
@@ -709,9 +1223,12 @@ func (tc *j2jTestCase) buildADFDescription() *models.CommentNodeScheme {
 				"language": "text",
 			},
 			Content: []*models.CommentNodeScheme{
-				{Type: "text", Text: truncate(tc.Message)},
+				{Type: "text", Text: tc.excerpt(tc.Message, maxTextBlockLength)},
 			},
 		})
+		if note := tc.fullOutputNote("message", tc.Message); note != nil {
+			content = append(content, note)
+		}
 	}
 
 	if tc.Stderr != "" {
@@ -730,9 +1247,12 @@ func (tc *j2jTestCase) buildADFDescription() *models.CommentNodeScheme {
 				"language": "text",
 			},
 			Content: []*models.CommentNodeScheme{
-				{Type: "text", Text: truncate(tc.Stderr)},
+				{Type: "text", Text: tc.excerpt(tc.Stderr, maxTextBlockLength)},
 			},
 		})
+		if note := tc.fullOutputNote("stderr", tc.Stderr); note != nil {
+			content = append(content, note)
+		}
 	}
 
 	if tc.Stdout != "" {
@@ -751,9 +1271,12 @@ func (tc *j2jTestCase) buildADFDescription() *models.CommentNodeScheme {
 				"language": "text",
 			},
 			Content: []*models.CommentNodeScheme{
-				{Type: "text", Text: truncate(tc.Stdout)},
+				{Type: "text", Text: tc.excerpt(tc.Stdout, maxTextBlockLength)},
 			},
 		})
+		if note := tc.fullOutputNote("stdout", tc.Stdout); note != nil {
+			content = append(content, note)
+		}
 	}
 
 	if tc.Error != "" {
@@ -772,9 +1295,69 @@ func (tc *j2jTestCase) buildADFDescription() *models.CommentNodeScheme {
 				"language": "text",
 			},
 			Content: []*models.CommentNodeScheme{
-				{Type: "text", Text: truncate(tc.Error)},
+				{Type: "text", Text: tc.excerpt(tc.Error, maxTextBlockLength)},
 			},
 		})
+		if note := tc.fullOutputNote("error", tc.Error); note != nil {
+			content = append(content, note)
+		}
+	}
+
+	if len(tc.StackTrace) > 0 {
+		content = append(content, stackTraceADF(tc.StackTrace)...)
+	}
+
+	if tc.History != nil {
+		content = append(content, &models.CommentNodeScheme{
+			Type: "heading",
+			Attrs: map[string]any{
+				"level": 3,
+			},
+			Content: []*models.CommentNodeScheme{
+				{Type: "text", Text: "History"},
+			},
+		})
+		content = append(content, &models.CommentNodeScheme{
+			Type: "paragraph",
+			Content: []*models.CommentNodeScheme{
+				{Type: "text", Text: tc.History.String()},
+			},
+		})
+	}
+
+	if tc.SuspectCommits != nil {
+		content = append(content, &models.CommentNodeScheme{
+			Type: "heading",
+			Attrs: map[string]any{
+				"level": 3,
+			},
+			Content: []*models.CommentNodeScheme{
+				{Type: "text", Text: "Suspect Commits"},
+			},
+		})
+		content = append(content, &models.CommentNodeScheme{
+			Type: "paragraph",
+			Content: []*models.CommentNodeScheme{
+				{Type: "text", Text: tc.SuspectCommits.title(tc.BuildTag)},
+			},
+		})
+		items := []*models.CommentNodeScheme{}
+		for _, c := range tc.SuspectCommits.Commits {
+			items = append(items, &models.CommentNodeScheme{
+				Type: "listItem",
+				Content: []*models.CommentNodeScheme{
+					{Type: "paragraph", Content: []*models.CommentNodeScheme{
+						{Type: "text", Text: c.String()},
+					}},
+				},
+			})
+		}
+		if len(items) > 0 {
+			content = append(content, &models.CommentNodeScheme{
+				Type:    "bulletList",
+				Content: items,
+			})
+		}
 	}
 
 	// Add Build Information table
@@ -947,6 +1530,40 @@ func (tc *j2jTestCase) buildADFDescription() *models.CommentNodeScheme {
 		},
 	})
 
+	// Source row with link
+	if tc.SourceLink != "" {
+		tableRows = append(tableRows, &models.CommentNodeScheme{
+			Type: "tableRow",
+			Content: []*models.CommentNodeScheme{
+				{
+					Type: "tableCell",
+					Content: []*models.CommentNodeScheme{
+						{Type: "paragraph", Content: []*models.CommentNodeScheme{
+							{Type: "text", Text: "SOURCE"},
+						}},
+					},
+				},
+				{
+					Type: "tableCell",
+					Content: []*models.CommentNodeScheme{
+						{Type: "paragraph", Content: []*models.CommentNodeScheme{
+							{
+								Type: "text",
+								Text: tc.Name,
+								Marks: []*models.MarkScheme{{
+									Type: "link",
+									Attrs: map[string]any{
+										"href": tc.SourceLink,
+									},
+								}},
+							},
+						}},
+					},
+				},
+			},
+		})
+	}
+
 	content = append(content, &models.CommentNodeScheme{
 		Type:    "table",
 		Content: tableRows,
@@ -1017,77 +1634,42 @@ func truncateSummary(s string) string {
 	return s
 }
 
-func convertJunitToSlack(issues ...*testIssue) []slack.Attachment {
-	var failedTestsBlocks []slack.Block
-	var attachments []slack.Attachment
-
-	for _, i := range issues {
-		var title string
-		tc := i.testCase
-		if tc.Suite == "" {
-			title = tc.Name
-		} else {
-			title = fmt.Sprintf("%s: %s", tc.Suite, tc.Name)
-		}
-
-		issue := i.issue
-		if issue != nil {
-			title = fmt.Sprintf("%s: %s", issue.Key, title)
-		}
-		title = crop(title, slackHeaderTextLengthLimit)
+// convertJunitToSlack builds a digest of all failures followed by the details of the first ones. It is split into
+// as many messages as needed to stay within the limits of Slack.
+func (j junit2jira) convertJunitToSlack(mentions []string, issues ...*testIssue) [][]slack.Attachment {
+	if len(issues) == 0 {
+		return nil
+	}
 
-		titleTextBlock := slack.NewTextBlockObject("plain_text", title, false, false)
-		titleSectionBlock := slack.NewSectionBlock(titleTextBlock, nil, nil)
-		failedTestsBlocks = append(failedTestsBlocks, titleSectionBlock)
+	var attachments []slack.Attachment
+	for _, blocks := range splitBySize(j.slackDigest(issues, mentions), slackMaxMessageSize, slackMaxBlocks) {
+		attachments = append(attachments, slack.Attachment{
+			Color:  "#bb2124",
+			Blocks: slack.Blocks{BlockSet: blocks},
+		})
+	}
 
-		failureAttachment, err := failureToAttachment(title, tc)
+	for _, f := range j.slackChatDigest(issues).details {
+		failureAttachment, err := failureToAttachment(crop(f.title(), slackHeaderTextLengthLimit), f.testCase)
 		if err != nil {
-			log.Printf("skipping %s: %v", tc.Name, err)
+			log.Printf("skipping %s: %v", f.testCase.Name, err)
 			continue
 		}
-
-		attachments = append(attachments, failureAttachment)
-
-		// We've reached the desired message limit. We need to break out of all the loops
-		if len(attachments) > 3 {
-			break
+		if j.slackActions && f.issueKey != "" {
+			failureAttachment.Blocks.BlockSet = append(failureAttachment.Blocks.BlockSet, j.slackActionsBlock(f.issueKey))
 		}
+		attachments = append(attachments, failureAttachment)
 	}
 
-	if len(failedTestsBlocks) == 0 {
-		return nil
-	}
-
-	headerTextBlock := slack.NewTextBlockObject("plain_text", "Failed tests", false, false)
-	headerBlock := slack.NewHeaderBlock(headerTextBlock)
-	// Push this block to the beginning of the slice
-	failedTestsBlocks = append([]slack.Block{headerBlock}, failedTestsBlocks...)
-
-	failedTestsAttachment := slack.Attachment{
-		Color:  "#bb2124",
-		Blocks: slack.Blocks{BlockSet: failedTestsBlocks},
-	}
-	// Push this block to the beginning of the slice
-	attachments = append([]slack.Attachment{failedTestsAttachment}, attachments...)
-
-	return attachments
+	return splitSlackAttachments(attachments)
 }
 
 func failureToAttachment(title string, tc j2jTestCase) (slack.Attachment, error) {
-
-	failureMessage := tc.Message
-	failureValue := tc.Error
-	if tc.Error == tc.Message {
-		failureValue = ""
-	}
-
+	failureMessage, failureValue := failureTexts(tc, slackTextLengthLimit)
 	if failureMessage == "" && failureValue == "" {
 		return slack.Attachment{}, fmt.Errorf("no junit failure message or error for %s", title)
 	}
 
-	failureMessage = crop(failureMessage, slackTextLengthLimit)
-	failureValue = crop(failureValue, slackTextLengthLimit)
-
 	// Add some formatting to the failure title
 	failureTitleTextBlock := slack.NewTextBlockObject("plain_text", title, false, false)
 	failureTitleHeaderBlock := slack.NewHeaderBlock(failureTitleTextBlock)
@@ -1096,6 +1678,13 @@ func failureToAttachment(title string, tc j2jTestCase) (slack.Attachment, error)
 		Color:  "#bb2124",
 		Blocks: failureToBlocks(failureTitleHeaderBlock, failureMessage, failureValue),
 	}
+	if tc.SourceLink != "" {
+		sourceTextBlock := slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*Source:* <%s|%s>", tc.SourceLink, tc.Name), false, false)
+		failureAttachment.Blocks.BlockSet = append(failureAttachment.Blocks.BlockSet, slack.NewSectionBlock(sourceTextBlock, nil, nil))
+	}
+	if tc.SuspectCommits != nil {
+		failureAttachment.Blocks.BlockSet = append(failureAttachment.Blocks.BlockSet, suspectCommitsBlocks(tc)...)
+	}
 	return failureAttachment, nil
 }
 
@@ -1147,9 +1736,26 @@ func failureToBlocks(failureTitleHeaderBlock *slack.HeaderBlock, messageText, va
 	}}
 }
 
+func suspectCommitsBlocks(tc j2jTestCase) []slack.Block {
+	suspectsTextBlock := slack.NewTextBlockObject("mrkdwn", "*Suspect Commits*", false, false)
+	suspectsSectionBlock := slack.NewSectionBlock(suspectsTextBlock, nil, nil)
+
+	var text strings.Builder
+	text.WriteString(tc.SuspectCommits.title(tc.BuildTag))
+	for _, c := range tc.SuspectCommits.Commits {
+		text.WriteString("\n• " + c.String())
+	}
+	commitsTextBlock := slack.NewTextBlockObject("plain_text", crop(text.String(), slackTextLengthLimit), false, false)
+	commitsSectionBlock := slack.NewSectionBlock(commitsTextBlock, nil, nil)
+
+	return []slack.Block{suspectsSectionBlock, commitsSectionBlock}
+}
+
+// crop shortens s to l runes, so that multibyte characters are never cut.
 func crop(s string, l int) string {
-	if len(s) < l {
+	runes := []rune(s)
+	if len(runes) < l {
 		return s
 	}
-	return s[:l-1] + "…"
+	return string(runes[:l-1]) + "…"
 }
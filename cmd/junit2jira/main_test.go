@@ -3,10 +3,15 @@ package main
 import (
 	"bytes"
 	_ "embed"
+	"errors"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/joshdk/go-junit"
 	"github.com/stackrox/junit2jira/pkg/testcase"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -409,18 +414,29 @@ var expectedHtmlOutput string
 func TestHtmlOutput(t *testing.T) {
 	u, err := url.Parse("https://issues.redhat.com")
 	assert.NoError(t, err)
-	j := junit2jira{params: params{jiraUrl: u}}
+	j := junit2jira{params: params{jiraUrl: u, JobName: "job", BuildId: "1", BuildLink: "https://prow/1"}}
 
 	buf := bytes.NewBufferString("")
-	require.NoError(t, j.renderHtml(nil, buf))
+	require.NoError(t, j.renderHtml(nil, nil, buf))
+	assert.Contains(t, buf.String(), "No tests found.")
 
-	issues := []*models.IssueScheme{
-		{Key: "ROX-1", Fields: &models.IssueFieldsScheme{Summary: "abc"}},
-		{Key: "ROX-2", Fields: &models.IssueFieldsScheme{Summary: "def"}},
-		{Key: "ROX-3"},
+	suites := []junit.Suite{
+		{Name: "suite", Tests: []junit.Test{
+			{Name: "a", Classname: "pkg", Status: junit.StatusPassed, Duration: 2 * time.Second},
+			{Name: "b", Classname: "pkg", Status: junit.StatusFailed, Duration: 90 * time.Second, Message: "expected <1>", Error: errors.New("b failed"), SystemOut: "log line"},
+			{Name: "b/sub", Classname: "pkg", Status: junit.StatusFailed, Error: errors.New("sub failed")},
+			{Name: "c", Classname: "pkg", Status: junit.StatusSkipped},
+		}},
+		{Name: "e2e", Suites: []junit.Suite{{Name: "nested", Tests: []junit.Test{
+			{Name: "d", Classname: "e2e", Status: junit.StatusError, Duration: 500 * time.Millisecond, Error: errors.New("timeout")},
+		}}}},
+	}
+	issues := []*testIssue{
+		{issue: &models.IssueScheme{Key: "ROX-1", Fields: &models.IssueFieldsScheme{Summary: "pkg / b FAILED"}}, testCase: j2jTestCase{Suite: "pkg", Name: "b"}},
+		{issue: &models.IssueScheme{Key: "ROX-2"}, newJIRA: true, testCase: j2jTestCase{Suite: "e2e", Name: "d"}},
 	}
 	buf = bytes.NewBufferString("")
-	require.NoError(t, j.renderHtml(issues, buf))
+	require.NoError(t, j.renderHtml(suites, issues, buf))
 
 	assert.Equal(t, expectedHtmlOutput, buf.String())
 }
@@ -428,31 +444,82 @@ func TestHtmlOutput(t *testing.T) {
 func TestSummaryNoNewJIRAs(t *testing.T) {
 	expectedSummaryNoNewJIRAs := `{"newJIRAs":0}`
 	buf := bytes.NewBufferString("")
-	require.NoError(t, generateSummary(nil, buf))
+	require.NoError(t, junit2jira{}.generateSummary(nil, buf))
 	assert.Equal(t, expectedSummaryNoNewJIRAs, buf.String())
 }
 
 func TestSummaryNoFailures(t *testing.T) {
-	expectedSummarySomeNewJIRAs := `{"newJIRAs":2}`
+	expectedSummarySomeNewJIRAs := `{"newJIRAs":2,"tests":[` +
+		`{"suite":"suite","name":"a","decision":"create-or-comment","issue":"ROX-1"},` +
+		`{"suite":"suite","name":"b","decision":"create-or-comment","issue":"ROX-2","newJIRA":true},` +
+		`{"suite":"suite","name":"c","decision":"create-or-comment","issue":"ROX-3","newJIRA":true},` +
+		`{"suite":"suite","name":"d","decision":"report-only"}]}`
 	tc := []*testIssue{
 		{
 			issue:    &models.IssueScheme{Key: "ROX-1"},
 			newJIRA:  false,
-			testCase: j2jTestCase{},
+			testCase: j2jTestCase{Suite: "suite", Name: "a"},
+			decision: decisionCreateOrComment,
 		},
 		{
 			issue:    &models.IssueScheme{Key: "ROX-2"},
 			newJIRA:  true,
-			testCase: j2jTestCase{},
+			testCase: j2jTestCase{Suite: "suite", Name: "b"},
+			decision: decisionCreateOrComment,
 		},
 		{
 			issue:    &models.IssueScheme{Key: "ROX-3"},
 			newJIRA:  true,
-			testCase: j2jTestCase{},
+			testCase: j2jTestCase{Suite: "suite", Name: "c"},
+			decision: decisionCreateOrComment,
+		},
+		{
+			testCase: j2jTestCase{Suite: "suite", Name: "d"},
+			decision: decisionReportOnly,
 		},
 	}
 
 	buf := bytes.NewBufferString("")
-	require.NoError(t, generateSummary(tc, buf))
+	require.NoError(t, junit2jira{}.generateSummary(tc, buf))
 	assert.Equal(t, expectedSummarySomeNewJIRAs, buf.String())
 }
+
+func TestRunOffline(t *testing.T) {
+	dir := t.TempDir()
+	p := params{
+		offline:         true,
+		junitReportsDir: "testdata/jira/report.xml",
+		JobName:         "job-name",
+		csvOutput:       filepath.Join(dir, "report.csv"),
+		slackOutput:     filepath.Join(dir, "slack.json"),
+		summaryOutput:   filepath.Join(dir, "summary.json"),
+		htmlOutput:      filepath.Join(dir, "report.html"),
+	}
+	require.NoError(t, run(p))
+
+	summary, err := os.ReadFile(p.summaryOutput)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"newJIRAs":0,"tests":[
+		{"suite":"github.com/stackrox/rox/pkg/booleanpolicy/evaluator","name":"TestDifferentBaseTypes","decision":"report-only"},
+		{"suite":"github.com/stackrox/rox/sensor/kubernetes/localscanner","name":"TestLocalScannerTLSIssuerIntegrationTests","decision":"report-only","topFrame":"tls_issuer_test.go:377"}
+	]}`, string(summary))
+
+	slackMsg, err := os.ReadFile(p.slackOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(slackMsg), "TestDifferentBaseTypes")
+
+	csvOutput, err := os.ReadFile(p.csvOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(csvOutput), ",TestDifferentBaseTypes,")
+
+	htmlOutput, err := os.ReadFile(p.htmlOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(htmlOutput), "TestDifferentBaseTypes")
+}
+
+func TestValidateStdoutParams(t *testing.T) {
+	assert.NoError(t, validateStdoutParams(params{csvOutput: "-", htmlOutput: "report.html"}))
+	assert.NoError(t, validateStdoutParams(params{githubAnnotations: true, markdownOutput: "summary.md"}))
+	assert.EqualError(t, validateStdoutParams(params{githubAnnotations: true, markdownOutput: "-", summaryOutput: "-"}),
+		"only one output can be written to stdout, got -github-annotations, -markdown-output, -summary-output")
+}
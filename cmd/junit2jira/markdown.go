@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// markdownOutputLimit is the length of the message and the error shown for each failure.
+	markdownOutputLimit = 1000
+	// markdownMoreReserve is left for the line counting the failures that are not listed.
+	markdownMoreReserve = 200
+	// markdownMaxSize keeps the report below the 65536 characters of a GitHub comment, which is also well within
+	// the 1 MiB of a job summary.
+	markdownMaxSize = 60000
+)
+
+// createMarkdown writes the Markdown report of the run to -markdown-output, also when no test failed.
+func (j junit2jira) createMarkdown(issues []*testIssue) error {
+	if j.markdownOutput == "" {
+		return nil
+	}
+	report := j.markdownReport(issues, markdownMaxSize)
+	if j.markdownOutput == "-" {
+		_, err := os.Stdout.WriteString(report)
+		return errors.Wrap(err, "could not write Markdown report")
+	}
+	if err := os.WriteFile(j.markdownOutput, []byte(report), 0644); err != nil {
+		return fmt.Errorf("could not create file %q: %w", j.markdownOutput, err)
+	}
+	return nil
+}
+
+// markdownReport renders the run in GitHub flavored Markdown with the failures grouped by suite in collapsed
+// sections. Failures that do not fit in maxSize bytes are only counted.
+func (j junit2jira) markdownReport(issues []*testIssue, maxSize int) string {
+	d := j.chatDigest(issues)
+	var b strings.Builder
+	if d.failed == 0 {
+		b.WriteString("### All tests passed\n\n")
+	} else {
+		b.WriteString("### Failed tests\n\n")
+	}
+	if context := d.buildContext(markdownEscape, markdownLink); context != "" {
+		b.WriteString(context + "\n\n")
+	}
+
+	var header, separator, values []string
+	if d.total > 0 {
+		header, separator, values = append(header, "Total"), append(separator, "---:"), append(values, fmt.Sprint(d.total))
+	}
+	header = append(header, "Failed", "New issues", "Existing issues")
+	separator = append(separator, "---:", "---:", "---:")
+	values = append(values, fmt.Sprint(d.failed), fmt.Sprint(d.newIssues), fmt.Sprint(d.existingIssues))
+	for _, row := range [][]string{header, separator, values} {
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+	b.WriteString("\n")
+	if d.reportLink != "" {
+		b.WriteString("See the " + markdownLink(d.reportLink, "HTML report") + " for all tests.\n\n")
+	}
+
+	const sectionEnd = "</details>\n\n"
+	listed := 0
+	full := false
+	for _, suite := range j.chatSuites(issues) {
+		section := fmt.Sprintf("<details>\n<summary><b>%s</b> (%d failed)</summary>\n\n",
+			html.EscapeString(orDefault(suite.name, "No suite")), len(suite.failures))
+		size := b.Len() + len(section) + len(sectionEnd) + markdownMoreReserve
+		var entries []string
+		for _, f := range suite.failures {
+			entry := markdownFailure(f)
+			if size+len(entry) > maxSize {
+				full = true
+				break
+			}
+			size += len(entry)
+			entries = append(entries, entry)
+		}
+		if len(entries) > 0 {
+			b.WriteString(section + strings.Join(entries, "") + "\n" + sectionEnd)
+			listed += len(entries)
+		}
+		if full {
+			break
+		}
+	}
+
+	d.more = len(issues) - listed
+	if d.more > 0 {
+		b.WriteString(d.moreText(markdownLink) + "\n")
+	}
+	return b.String()
+}
+
+// markdownFailure is a list item with the test, its issue and its output.
+func markdownFailure(f chatFailure) string {
+	entry := "- " + f.line(markdownEscape, markdownLink) + "\n"
+	message, value := failureTexts(f.testCase, markdownOutputLimit)
+	for _, text := range []string{message, value} {
+		if text != "" {
+			entry += "\n  " + strings.ReplaceAll(markdownCodeBlock(text), "\n", "\n  ") + "\n"
+		}
+	}
+	return entry
+}
+
+// markdownCodeBlock shows text as is in a fence longer than any run of backticks in the text.
+func markdownCodeBlock(text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence + "\n" + text + "\n" + fence
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarkdownReport(t *testing.T) {
+	report := chatTestJira(t).markdownReport(chatTestIssues(), markdownMaxSize)
+	assert.Equal(t, "### Failed tests\n\n"+
+		"nightly · [42](https://ci/42)\n\n"+
+		"| Total | Failed | New issues | Existing issues |\n"+
+		"| ---: | ---: | ---: | ---: |\n"+
+		"| 120 | 3 | 1 | 1 |\n\n"+
+		"See the [HTML report](https://ci/42/report.html) for all tests.\n\n"+
+		"<details>\n<summary><b>a</b> (2 failed)</summary>\n\n"+
+		"- [ROX-1](https://jira.example.com/browse/ROX-1) TestA (new)\n\n"+
+		"  ```\n  boom\n  ```\n"+
+		"- Test\\_C\\*\n\n"+
+		"  ```\n  crash\n  ```\n\n"+
+		"  ````\n  ```stack```\n  ````\n"+
+		"\n</details>\n\n"+
+		"<details>\n<summary><b>b</b> (1 failed)</summary>\n\n"+
+		"- [ROX-2](https://jira.example.com/browse/ROX-2) TestB (existing)\n\n"+
+		"  ```\n  bang\n  ```\n"+
+		"\n</details>\n\n", report)
+}
+
+func TestMarkdownReportPassed(t *testing.T) {
+	j := chatTestJira(t)
+	j.stats.Failed = 0
+	j.htmlReportLink = ""
+	assert.Equal(t, "### All tests passed\n\n"+
+		"nightly · [42](https://ci/42)\n\n"+
+		"| Total | Failed | New issues | Existing issues |\n"+
+		"| ---: | ---: | ---: | ---: |\n"+
+		"| 120 | 0 | 0 | 0 |\n\n", j.markdownReport(nil, markdownMaxSize))
+}
+
+func TestMarkdownReportLimit(t *testing.T) {
+	issues := manyChatTestIssues(100)
+	report := chatTestJira(t).markdownReport(issues, 20000)
+
+	assert.LessOrEqual(t, len(report), 20000)
+	listed := strings.Count(report, "\n- ")
+	assert.Greater(t, listed, 0)
+	assert.Less(t, listed, len(issues))
+	assert.Equal(t, strings.Count(report, "<details>"), strings.Count(report, "</details>"))
+	assert.True(t, strings.HasSuffix(report, "more failures, see the [HTML report](https://ci/42/report.html).\n"), report[len(report)-200:])
+}
+
+func TestCreateMarkdown(t *testing.T) {
+	j := chatTestJira(t)
+	j.markdownOutput = filepath.Join(t.TempDir(), "summary.md")
+	require.NoError(t, j.createMarkdown(chatTestIssues()))
+
+	report, err := os.ReadFile(j.markdownOutput)
+	require.NoError(t, err)
+	assert.Contains(t, string(report), "TestB (existing)")
+}
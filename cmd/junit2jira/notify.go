@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// digestLimit is the number of failures listed in a digest, the others are only counted.
+	digestLimit = 50
+	// digestDetailsLimit is the number of failures whose output follows the digest.
+	digestDetailsLimit = 10
+)
+
+// notifier renders the failures of a run as messages of a chat service. The messages are written to a file
+// for a script to post, or posted to the incoming webhook of the service. Slack is not a notifier as it
+// also posts threads with a bot token and routes failures to several channels.
+type notifier interface {
+	// name is the value of -chat-webhook posting to the service.
+	name() string
+	// webhookEnv is the secret with the URL of the incoming webhook.
+	webhookEnv() string
+	// render returns the messages for the digest, split so that each one fits the limits of the service.
+	render(d chatDigest) []any
+}
+
+var notifiers = []notifier{teamsNotifier{}, googleChatNotifier{}, discordNotifier{}}
+
+func notifierNames() []string {
+	names := make([]string, 0, len(notifiers))
+	for _, n := range notifiers {
+		names = append(names, n.name())
+	}
+	return names
+}
+
+func validateChatParams(p params) error {
+	for _, name := range p.chatWebhooks {
+		if !slices.Contains(notifierNames(), name) {
+			return fmt.Errorf("unknown chat webhook %q, expected one of %s", name, strings.Join(notifierNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// chatOutput is the file a notifier writes its messages to.
+func (p params) chatOutput(n notifier) string {
+	switch n.(type) {
+	case teamsNotifier:
+		return p.teamsOutput
+	case googleChatNotifier:
+		return p.googleChatOutput
+	case discordNotifier:
+		return p.discordOutput
+	}
+	return ""
+}
+
+// chatDigest is what a digest of the run shows, shared by the renderers of all chat services.
+type chatDigest struct {
+	jobName   string
+	buildId   string
+	buildLink string
+	buildTag  string
+	// reportLink is the published HTML report.
+	reportLink string
+	// total is 0 if the number of tests is not known.
+	total          int
+	failed         int
+	newIssues      int
+	existingIssues int
+	// suites group the listed failures, in the order of the reports.
+	suites []chatSuite
+	// more is the number of failures that are not listed.
+	more int
+	// details are the failures whose output is shown after the digest.
+	details []chatFailure
+}
+
+type chatSuite struct {
+	name     string
+	failures []chatFailure
+}
+
+type chatFailure struct {
+	testCase j2jTestCase
+	// issueKey and issueURL are empty if no issue was filed.
+	issueKey string
+	issueURL string
+	newIssue bool
+}
+
+// status tells whether the issue of the failure is new or existing.
+func (f chatFailure) status() string {
+	switch {
+	case f.issueKey == "":
+		return ""
+	case f.newIssue:
+		return "new"
+	default:
+		return "existing"
+	}
+}
+
+// title is the failure with its suite and issue, as shown above its output.
+func (f chatFailure) title() string {
+	if f.issueKey == "" {
+		return slackTitle(f.testCase)
+	}
+	return fmt.Sprintf("%s: %s", f.issueKey, slackTitle(f.testCase))
+}
+
+func (j junit2jira) chatFailure(i *testIssue) chatFailure {
+	f := chatFailure{testCase: i.testCase, newIssue: i.newJIRA}
+	if i.issue != nil {
+		f.issueKey = i.issue.Key
+		f.issueURL = j.issueURL(i.issue.Key)
+	}
+	return f
+}
+
+// chatDigest counts the failures and issues and groups the first digestLimit failures by suite.
+func (j junit2jira) chatDigest(issues []*testIssue) chatDigest {
+	d := chatDigest{
+		jobName:    j.JobName,
+		buildId:    j.BuildId,
+		buildLink:  j.BuildLink,
+		buildTag:   j.BuildTag,
+		reportLink: j.htmlReportLink,
+		total:      j.stats.Total,
+		failed:     max(j.stats.Failed, len(issues)),
+	}
+	for _, i := range issues {
+		switch {
+		case i.newJIRA:
+			d.newIssues++
+		case i.issue != nil:
+			d.existingIssues++
+		}
+	}
+
+	listed := issues[:min(len(issues), digestLimit)]
+	d.suites = j.chatSuites(listed)
+	d.more = len(issues) - len(listed)
+
+	for _, i := range issues[:min(len(issues), digestDetailsLimit)] {
+		d.details = append(d.details, j.chatFailure(i))
+	}
+	return d
+}
+
+// chatSuites groups failures by suite, in the order of the reports.
+func (j junit2jira) chatSuites(issues []*testIssue) []chatSuite {
+	var suites []chatSuite
+	for _, i := range issues {
+		k := slices.IndexFunc(suites, func(s chatSuite) bool { return s.name == i.testCase.Suite })
+		if k < 0 {
+			suites = append(suites, chatSuite{name: i.testCase.Suite})
+			k = len(suites) - 1
+		}
+		suites[k].failures = append(suites[k].failures, j.chatFailure(i))
+	}
+	return suites
+}
+
+// text is the plain text of the digest, shown in notifications.
+func (d chatDigest) text() string {
+	text := fmt.Sprintf("%d failed tests, %d new issues", d.failed, d.newIssues)
+	if d.jobName != "" {
+		text = fmt.Sprintf("%s: %s", d.jobName, text)
+	}
+	return text
+}
+
+// buildContext joins the job, build and tag with a link to the build formatted by link.
+func (d chatDigest) buildContext(escape func(string) string, link func(url, text string) string) string {
+	var parts []string
+	if d.jobName != "" {
+		parts = append(parts, escape(d.jobName))
+	}
+	switch {
+	case d.buildLink != "":
+		parts = append(parts, link(d.buildLink, escape(orDefault(d.buildId, "build"))))
+	case d.buildId != "":
+		parts = append(parts, escape(d.buildId))
+	}
+	if d.buildTag != "" {
+		parts = append(parts, escape(d.buildTag))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// moreText counts the failures that are not listed with a link formatted by link to the HTML report or the build.
+func (d chatDigest) moreText(link func(url, text string) string) string {
+	switch {
+	case d.reportLink != "":
+		return fmt.Sprintf("…and %d more failures, see the %s.", d.more, link(d.reportLink, "HTML report"))
+	case d.buildLink != "":
+		return fmt.Sprintf("…and %d more failures, see the %s.", d.more, link(d.buildLink, "build"))
+	default:
+		return fmt.Sprintf("…and %d more failures.", d.more)
+	}
+}
+
+// line is the test name with a link to its issue formatted by link and whether the issue is new.
+func (f chatFailure) line(escape func(string) string, link func(url, text string) string) string {
+	name := escape(f.testCase.Name)
+	if f.issueKey == "" {
+		return name
+	}
+	return fmt.Sprintf("%s %s (%s)", link(f.issueURL, f.issueKey), name, f.status())
+}
+
+// failureTexts returns the message and the error of a failure shortened to limit. The error is left out if it
+// repeats the message.
+func failureTexts(tc j2jTestCase, limit int) (string, string) {
+	message := tc.Message
+	value := tc.Error
+	if tc.Error == tc.Message {
+		value = ""
+	}
+	return crop(tc.excerpt(message, limit-1), limit), crop(tc.excerpt(value, limit-1), limit)
+}
+
+// joinLines joins lines into as few texts as possible that are not longer than limit.
+func joinLines(lines []string, limit int) []string {
+	var texts []string
+	current := ""
+	for _, line := range lines {
+		line = crop(line, limit)
+		if current != "" && utf8.RuneCountInString(current)+1+utf8.RuneCountInString(line) > limit {
+			texts = append(texts, current)
+			current = ""
+		}
+		if current != "" {
+			current += "\n"
+		}
+		current += line
+	}
+	if current != "" {
+		texts = append(texts, current)
+	}
+	return texts
+}
+
+// splitBySize distributes items over parts whose JSON is not larger than maxSize and that have at most
+// maxItems items.
+func splitBySize[T any](items []T, maxSize, maxItems int) [][]T {
+	var parts [][]T
+	var current []T
+	size := 0
+	for _, item := range items {
+		n := jsonSize(item)
+		if len(current) > 0 && (len(current) >= maxItems || size+n > maxSize) {
+			parts = append(parts, current)
+			current, size = nil, 0
+		}
+		current = append(current, item)
+		size += n
+	}
+	if len(current) > 0 {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+func jsonSize(v any) int {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// markdownEscape escapes the characters with a meaning in the Markdown of Teams, Discord and GitHub.
+func markdownEscape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+	).Replace(s)
+}
+
+func markdownLink(url, text string) string {
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
+// notifyChats writes the messages of each chat service with an output and posts them to the webhooks of
+// -chat-webhook.
+func (j junit2jira) notifyChats(issues []*testIssue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+	for _, n := range notifiers {
+		output := j.chatOutput(n)
+		post := slices.Contains(j.chatWebhooks, n.name())
+		if output == "" && !post {
+			continue
+		}
+
+		messages := n.render(j.chatDigest(issues))
+		if output != "" {
+			if err := writeChatMessages(output, messages); err != nil {
+				return errors.Wrapf(err, "could not write %s messages", n.name())
+			}
+		}
+		if !post {
+			continue
+		}
+		if j.dryRun {
+			log.Infof("Dry run: would post %d failures to %s", len(issues), n.name())
+			continue
+		}
+		if err := j.postChatMessages(n, messages); err != nil {
+			return errors.Wrapf(err, "could not post to %s", n.name())
+		}
+		log.Infof("Posted %d failures to %s", len(issues), n.name())
+	}
+	return nil
+}
+
+// writeChatMessages writes the first message to output and the others next to it with their number.
+// On stdout they are written one per line.
+func writeChatMessages(output string, messages []any) error {
+	for n, message := range messages {
+		b, err := json.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("error while marshaling message to json: %w", err)
+		}
+		if output == "-" {
+			if _, err := fmt.Fprintf(os.Stdout, "%s\n", b); err != nil {
+				return fmt.Errorf("could not write message: %w", err)
+			}
+			continue
+		}
+		name := messageOutputName(output, "", n)
+		if err := os.WriteFile(name, b, 0644); err != nil {
+			return fmt.Errorf("could not create file %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (j junit2jira) postChatMessages(n notifier, messages []any) error {
+	webhook, err := secret(n.webhookEnv(), j.secretsDir)
+	if err != nil {
+		return err
+	}
+	if webhook == "" {
+		return fmt.Errorf("%s is required to post to %s", n.webhookEnv(), n.name())
+	}
+	httpClient, err := j.transport.NewClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create HTTP client")
+	}
+	for _, message := range messages {
+		body, err := json.Marshal(message)
+		if err != nil {
+			return errors.Wrap(err, "could not marshal message")
+		}
+		if err := postWebhook(httpClient, webhook, body, http.Header{"Content-Type": {"application/json"}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chatTestJira(t *testing.T) junit2jira {
+	jiraUrl, err := url.Parse("https://jira.example.com/")
+	require.NoError(t, err)
+	return junit2jira{
+		params: params{jiraUrl: jiraUrl, JobName: "nightly", BuildId: "42", BuildLink: "https://ci/42", htmlReportLink: "https://ci/42/report.html"},
+		stats:  runStats{Total: 120, Failed: 3},
+	}
+}
+
+func chatTestIssues() []*testIssue {
+	return []*testIssue{
+		{issue: &models.IssueScheme{Key: "ROX-1"}, newJIRA: true, testCase: j2jTestCase{Suite: "a", Name: "TestA", Message: "boom"}},
+		{issue: &models.IssueScheme{Key: "ROX-2"}, testCase: j2jTestCase{Suite: "b", Name: "TestB", Error: "bang"}},
+		{testCase: j2jTestCase{Suite: "a", Name: "Test_C*", Message: "crash", Error: "```stack```"}},
+	}
+}
+
+// manyChatTestIssues returns failures with long output that do not fit in a single message.
+func manyChatTestIssues(n int) []*testIssue {
+	var issues []*testIssue
+	for i := 0; i < n; i++ {
+		issues = append(issues, &testIssue{
+			issue:    &models.IssueScheme{Key: fmt.Sprintf("ROX-%d", i)},
+			testCase: j2jTestCase{Suite: fmt.Sprintf("suite%d", i%7), Name: fmt.Sprintf("Test%d", i), Message: strings.Repeat("x", 5000), Error: "error"},
+		})
+	}
+	return issues
+}
+
+func TestChatDigest(t *testing.T) {
+	defer func(l int) { digestLimit = l }(digestLimit)
+	digestLimit = 2
+
+	d := chatTestJira(t).chatDigest(chatTestIssues())
+
+	assert.Equal(t, 120, d.total)
+	assert.Equal(t, 3, d.failed)
+	assert.Equal(t, 1, d.newIssues)
+	assert.Equal(t, 1, d.existingIssues)
+	assert.Equal(t, 1, d.more)
+	require.Len(t, d.suites, 2)
+	assert.Equal(t, "a", d.suites[0].name)
+	assert.Equal(t, "https://jira.example.com/browse/ROX-1", d.suites[0].failures[0].issueURL)
+	assert.Equal(t, "b", d.suites[1].name)
+	assert.Len(t, d.details, 3)
+	assert.Equal(t, "nightly: 3 failed tests, 1 new issues", d.text())
+	assert.Equal(t, "nightly · [42](https://ci/42)", d.buildContext(markdownEscape, markdownLink))
+	assert.Equal(t, "…and 1 more failures, see the [HTML report](https://ci/42/report.html).", d.moreText(markdownLink))
+	assert.Equal(t, `[ROX-1](https://jira.example.com/browse/ROX-1) TestA (new)`, d.suites[0].failures[0].line(markdownEscape, markdownLink))
+}
+
+func TestTeamsNotifier(t *testing.T) {
+	messages := teamsNotifier{}.render(chatTestJira(t).chatDigest(chatTestIssues()))
+	require.Len(t, messages, 1)
+	card := messages[0].(teamsMessage).Attachments[0].Content
+	assert.Equal(t, "AdaptiveCard", card.Type)
+
+	var texts []string
+	for _, e := range card.Body {
+		if e.Type == "FactSet" {
+			assert.Equal(t, []teamsFact{{"Total", "120"}, {"Failed", "3"}, {"New issues", "1"}, {"Existing issues", "1"}}, e.Facts)
+			continue
+		}
+		texts = append(texts, e.Text)
+	}
+	assert.Equal(t, []string{
+		"Failed tests",
+		"nightly · [42](https://ci/42)",
+		"a",
+		"- [ROX-1](https://jira.example.com/browse/ROX-1) TestA (new)\n- Test\\_C\\*",
+		"b",
+		"- [ROX-2](https://jira.example.com/browse/ROX-2) TestB (existing)",
+		"[ROX-1: a: TestA](https://jira.example.com/browse/ROX-1)", "boom",
+		"[ROX-2: b: TestB](https://jira.example.com/browse/ROX-2)", "bang",
+		"a: Test\\_C\\*", "crash", "\\`\\`\\`stack\\`\\`\\`",
+	}, texts)
+	assert.Equal(t, []teamsAction{
+		{Type: "Action.OpenUrl", Title: "Open build", URL: "https://ci/42"},
+		{Type: "Action.OpenUrl", Title: "Open HTML report", URL: "https://ci/42/report.html"},
+	}, card.Actions)
+
+	messages = teamsNotifier{}.render(chatTestJira(t).chatDigest(manyChatTestIssues(30)))
+	require.Greater(t, len(messages), 1)
+	for _, m := range messages {
+		assert.LessOrEqual(t, jsonSize(m), teamsMaxMessageSize)
+	}
+}
+
+func TestGoogleChatNotifier(t *testing.T) {
+	messages := googleChatNotifier{}.render(chatTestJira(t).chatDigest(chatTestIssues()))
+	require.Len(t, messages, 1)
+	message := messages[0].(googleChatMessage)
+	assert.Equal(t, "nightly: 3 failed tests, 1 new issues", message.Text)
+	card := message.CardsV2[0].Card
+	assert.Equal(t, &googleChatHeader{Title: "Failed tests", Subtitle: "nightly · 42"}, card.Header)
+
+	require.Len(t, card.Sections, 6)
+	assert.Equal(t, "Total", card.Sections[0].Widgets[0].DecoratedText.TopLabel)
+	assert.Equal(t, "https://ci/42", card.Sections[0].Widgets[4].ButtonList.Buttons[0].OnClick.OpenLink.URL)
+	assert.Equal(t, "a", card.Sections[1].Header)
+	assert.Equal(t, `• <a href="https://jira.example.com/browse/ROX-1">ROX-1</a> TestA (new)<br>• Test_C*`, card.Sections[1].Widgets[0].TextParagraph.Text)
+	details := card.Sections[5]
+	assert.True(t, details.Collapsible)
+	assert.Equal(t, 1, details.UncollapsibleWidgetsCount)
+	assert.Equal(t, "<b>a: Test_C*</b>", details.Widgets[0].TextParagraph.Text)
+	assert.Len(t, details.Widgets, 3)
+
+	messages = googleChatNotifier{}.render(chatTestJira(t).chatDigest(manyChatTestIssues(30)))
+	require.Greater(t, len(messages), 1)
+	for _, m := range messages {
+		assert.LessOrEqual(t, jsonSize(m), googleChatMaxMessageSize)
+	}
+}
+
+func TestDiscordNotifier(t *testing.T) {
+	messages := discordNotifier{}.render(chatTestJira(t).chatDigest(chatTestIssues()))
+	require.Len(t, messages, 1)
+	message := messages[0].(discordMessage)
+	assert.Equal(t, "nightly: 3 failed tests, 1 new issues", message.Content)
+	assert.Equal(t, []string{}, message.AllowedMentions.Parse)
+	require.Len(t, message.Embeds, 4)
+	digest := message.Embeds[0]
+	assert.Equal(t, "Failed tests", digest.Title)
+	assert.Equal(t, "nightly · [42](https://ci/42)", digest.Description)
+	assert.Equal(t, discordField{Name: "a", Value: "• [ROX-1](https://jira.example.com/browse/ROX-1) TestA (new)\n• Test\\_C\\*"}, digest.Fields[4])
+	assert.Equal(t, "https://jira.example.com/browse/ROX-2", message.Embeds[2].URL)
+	assert.Equal(t, "```\ncrash\n```\n```\n`\u200b``stack`\u200b``\n```", message.Embeds[3].Description)
+
+	messages = discordNotifier{}.render(chatTestJira(t).chatDigest(manyChatTestIssues(80)))
+	require.Greater(t, len(messages), 1)
+	for _, m := range messages {
+		size := 0
+		for _, e := range m.(discordMessage).Embeds {
+			size += e.size()
+			assert.LessOrEqual(t, len(e.Fields), discordMaxFields)
+			assert.LessOrEqual(t, len(e.Description), discordDescriptionLimit)
+		}
+		assert.LessOrEqual(t, len(m.(discordMessage).Embeds), discordMaxEmbeds)
+		assert.LessOrEqual(t, size, discordMaxMessageSize)
+	}
+}
+
+func TestNotifyChats(t *testing.T) {
+	var posted []teamsMessage
+	rateLimited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		if !rateLimited {
+			rateLimited = true
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		var m teamsMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&m))
+		posted = append(posted, m)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	t.Setenv(teamsWebhookEnv, server.URL)
+
+	dir := t.TempDir()
+	j := chatTestJira(t)
+	j.teamsOutput = filepath.Join(dir, "teams.json")
+	j.discordOutput = filepath.Join(dir, "discord.json")
+	j.chatWebhooks = stringList{"teams"}
+	require.NoError(t, j.notifyChats(chatTestIssues()))
+
+	require.Len(t, posted, 1)
+	assert.Equal(t, "Failed tests", posted[0].Attachments[0].Content.Body[0].Text)
+	for _, name := range []string{j.teamsOutput, j.discordOutput} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "ROX-1")
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "google-chat.json"))
+
+	t.Run("missing webhook", func(t *testing.T) {
+		j := chatTestJira(t)
+		j.chatWebhooks = stringList{"discord"}
+		t.Setenv(discordWebhookEnv, "")
+		assert.ErrorContains(t, j.notifyChats(chatTestIssues()), "DISCORD_WEBHOOK_URL is required")
+	})
+	t.Run("failed post", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+		}))
+		defer server.Close()
+		t.Setenv(googleChatWebhookEnv, server.URL)
+		j := chatTestJira(t)
+		j.chatWebhooks = stringList{"google-chat"}
+		assert.ErrorContains(t, j.notifyChats(chatTestIssues()), "webhook answered 400 Bad Request: invalid payload")
+	})
+	t.Run("connection error hides the webhook URL", func(t *testing.T) {
+		defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+		webhookRetryDelay = time.Millisecond
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		t.Setenv(teamsWebhookEnv, server.URL+"/webhookb2/secret-id?sig=secret-sig")
+		j := chatTestJira(t)
+		j.chatWebhooks = stringList{"teams"}
+		err := j.notifyChats(chatTestIssues())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `"`+server.URL+`"`)
+		assert.NotContains(t, err.Error(), "secret")
+	})
+}
+
+func TestValidateChatParams(t *testing.T) {
+	assert.NoError(t, validateChatParams(params{chatWebhooks: stringList{"teams", "discord"}}))
+	assert.ErrorContains(t, validateChatParams(params{chatWebhooks: stringList{"irc"}}), `unknown chat webhook "irc", expected one of teams, google-chat, discord`)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// decisionCreateOrComment creates a new issue or comments on an existing one. This is the default.
+	decisionCreateOrComment = "create-or-comment"
+	// decisionCommentOnlyIfExists comments on an existing issue, but never creates a new one.
+	decisionCommentOnlyIfExists = "comment-only-if-exists"
+	// decisionReportOnly does not touch Jira, the failure is only included in Slack and HTML outputs.
+	decisionReportOnly = "report-only"
+	// decisionIgnore drops the failure from all outputs except the summary.
+	decisionIgnore = "ignore"
+	// decisionSkippedByHook is set for failures a hook skipped. Like ignore, they are only in the summary.
+	// It cannot be used in policy files.
+	decisionSkippedByHook = "skipped-by-hook"
+)
+
+// filingPolicyConfig is a single rule deciding how a failed test is reported.
+// All set regular expressions must match for the rule to apply. Name regular expressions must match the whole value,
+// FailureRegex is searched for in the message, error, stdout and stderr.
+type filingPolicyConfig struct {
+	// Name identifies the rule in logs.
+	Name              string `yaml:"name"`
+	JobNameRegex      string `yaml:"jobNameRegex"`
+	BuildTagRegex     string `yaml:"buildTagRegex"`
+	OrchestratorRegex string `yaml:"orchestratorRegex"`
+	SuiteRegex        string `yaml:"suiteRegex"`
+	TestNameRegex     string `yaml:"testNameRegex"`
+	FailureRegex      string `yaml:"failureRegex"`
+	// Decision is one of create-or-comment, comment-only-if-exists, report-only or ignore.
+	Decision string `yaml:"decision"`
+}
+
+type filingPolicy struct {
+	config filingPolicyConfig
+	testMatcher
+}
+
+// testMatcher selects failed tests by the regular expressions of a rule. Unset ones match everything.
+type testMatcher struct {
+	jobName      *regexp.Regexp
+	buildTag     *regexp.Regexp
+	orchestrator *regexp.Regexp
+	suite        *regexp.Regexp
+	testName     *regexp.Regexp
+	failure      *regexp.Regexp
+}
+
+func compileOptional(expr string, anchored bool) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	if anchored {
+		expr = fmt.Sprintf("^%s$", expr)
+	}
+	return regexp.Compile(expr)
+}
+
+func newFilingPolicy(config filingPolicyConfig) (*filingPolicy, error) {
+	switch config.Decision {
+	case decisionCreateOrComment, decisionCommentOnlyIfExists, decisionReportOnly, decisionIgnore:
+	default:
+		return nil, fmt.Errorf("invalid decision %q in rule %q", config.Decision, config.Name)
+	}
+
+	m, err := newTestMatcher(config.Name, config.JobNameRegex, config.BuildTagRegex, config.OrchestratorRegex,
+		config.SuiteRegex, config.TestNameRegex, config.FailureRegex)
+	if err != nil {
+		return nil, err
+	}
+	return &filingPolicy{config: config, testMatcher: m}, nil
+}
+
+func newTestMatcher(rule, jobNameRegex, buildTagRegex, orchestratorRegex, suiteRegex, testNameRegex, failureRegex string) (testMatcher, error) {
+	m := testMatcher{}
+	var err error
+	for _, r := range []struct {
+		field    string
+		expr     string
+		anchored bool
+		target   **regexp.Regexp
+	}{
+		{"jobNameRegex", jobNameRegex, true, &m.jobName},
+		{"buildTagRegex", buildTagRegex, true, &m.buildTag},
+		{"orchestratorRegex", orchestratorRegex, true, &m.orchestrator},
+		{"suiteRegex", suiteRegex, true, &m.suite},
+		{"testNameRegex", testNameRegex, true, &m.testName},
+		{"failureRegex", failureRegex, false, &m.failure},
+	} {
+		*r.target, err = compileOptional(r.expr, r.anchored)
+		if err != nil {
+			return m, errors.Wrapf(err, "invalid %s in rule %q: %v", r.field, rule, r.expr)
+		}
+	}
+	return m, nil
+}
+
+func matchOptional(re *regexp.Regexp, values ...string) bool {
+	if re == nil {
+		return true
+	}
+	for _, v := range values {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m testMatcher) match(tc j2jTestCase) bool {
+	return matchOptional(m.jobName, tc.JobName) &&
+		matchOptional(m.buildTag, tc.BuildTag) &&
+		matchOptional(m.orchestrator, tc.Orchestrator) &&
+		matchOptional(m.suite, tc.Suite) &&
+		matchOptional(m.testName, tc.Name) &&
+		matchOptional(m.failure, tc.Message, tc.Error, tc.Stdout, tc.Stderr)
+}
+
+// decide returns the decision of the first matching rule, or create-or-comment if none matches.
+func decide(policies []*filingPolicy, tc j2jTestCase) string {
+	for _, p := range policies {
+		if p.match(tc) {
+			logEntry("?", tc.Suite+" / "+tc.Name).Debugf("Matched rule %q: %s", p.config.Name, p.config.Decision)
+			return p.config.Decision
+		}
+	}
+	return decisionCreateOrComment
+}
+
+func loadFilingPolicyFile(fileName string) ([]*filingPolicy, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("read policy file: %s", fileName))
+	}
+
+	configs := make([]filingPolicyConfig, 0)
+	err = yaml.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("parse policy file: %s", fileName))
+	}
+
+	policies := make([]*filingPolicy, 0, len(configs))
+	for _, config := range configs {
+		policy, err := newFilingPolicy(config)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("create policy from file: %s", fileName))
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFilingPolicyFile(t *testing.T) {
+	_, err := loadFilingPolicyFile("testdata/policy/missing.yml")
+	assert.ErrorContains(t, err, "read policy file: testdata/policy/missing.yml")
+
+	policies, err := loadFilingPolicyFile("testdata/policy/policy.yml")
+	require.NoError(t, err)
+	require.Len(t, policies, 3)
+
+	samples := map[string]struct {
+		tc       j2jTestCase
+		expected string
+	}{
+		"no rule matches": {
+			tc:       j2jTestCase{JobName: "main-e2e", Suite: "suite", Name: "test"},
+			expected: decisionCreateOrComment,
+		},
+		"failure text": {
+			tc:       j2jTestCase{JobName: "main-e2e", Stdout: "pod is in ImagePullBackOff state"},
+			expected: decisionIgnore,
+		},
+		"first rule wins": {
+			tc:       j2jTestCase{JobName: "pull-e2e", Error: "ImagePullBackOff"},
+			expected: decisionIgnore,
+		},
+		"job name": {
+			tc:       j2jTestCase{JobName: "pull-e2e"},
+			expected: decisionCommentOnlyIfExists,
+		},
+		"job name must match fully": {
+			tc:       j2jTestCase{JobName: "main-pull-e2e"},
+			expected: decisionCreateOrComment,
+		},
+		"all conditions match": {
+			tc:       j2jTestCase{JobName: "nightly-e2e", Orchestrator: "openshift", Suite: "github.com/stackrox/rox/pkg/grpc"},
+			expected: decisionReportOnly,
+		},
+		"one condition does not match": {
+			tc:       j2jTestCase{JobName: "nightly-e2e", Orchestrator: "gke", Suite: "github.com/stackrox/rox/pkg/grpc"},
+			expected: decisionCreateOrComment,
+		},
+	}
+	for name, sample := range samples {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, sample.expected, decide(policies, sample.tc))
+		})
+	}
+}
+
+func TestNewFilingPolicy(t *testing.T) {
+	_, err := newFilingPolicy(filingPolicyConfig{Name: "bad", Decision: "close"})
+	assert.EqualError(t, err, `invalid decision "close" in rule "bad"`)
+
+	_, err = newFilingPolicy(filingPolicyConfig{Name: "bad", Decision: decisionIgnore, SuiteRegex: "("})
+	assert.ErrorContains(t, err, `invalid suiteRegex in rule "bad"`)
+}
+
+func TestCreateIssuesOrCommentsWithoutJira(t *testing.T) {
+	policy, err := newFilingPolicy(filingPolicyConfig{Decision: decisionReportOnly, TestNameRegex: "report"})
+	require.NoError(t, err)
+	ignore, err := newFilingPolicy(filingPolicyConfig{Decision: decisionIgnore})
+	require.NoError(t, err)
+	j := junit2jira{policies: []*filingPolicy{policy, ignore}}
+
+	issues, err := j.createIssuesOrComments([]j2jTestCase{{Name: "report"}, {Name: "other"}})
+	require.NoError(t, err)
+	assert.Equal(t, []*testIssue{
+		{testCase: j2jTestCase{Name: "report"}, decision: decisionReportOnly},
+		{testCase: j2jTestCase{Name: "other"}, decision: decisionIgnore},
+	}, issues)
+	assert.Equal(t, issues[:1], reportedIssues(issues))
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/pkg/errors"
+)
+
+const (
+	// previousCommentsLimit is the number of recent comments searched for the previous occurrence.
+	previousCommentsLimit = 50
+	maxDiffLines          = 20
+	sameAsPreviousText    = "Same failure as the previous occurrence."
+	// maxDiffInputLines bounds the lines of each side compared after the common start and end are removed, which
+	// keeps the table of the longest common subsequence small.
+	maxDiffInputLines = 500
+)
+
+// failureNormalizers replace parts of failures that differ between runs of the same failure.
+var failureNormalizers = []struct {
+	regex       *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`), "<TIME>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<UUID>"},
+	{regexp.MustCompile(`\b0x[0-9a-fA-F]+\b`), "<HEX>"},
+	{regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`), "<IP>"},
+	{regexp.MustCompile(`\b\d+(?:\.\d+)?(?:ns|µs|us|ms|s|m|h)\b`), "<DURATION>"},
+	{regexp.MustCompile(`\b\d{4,}\b`), "<N>"},
+}
+
+// normalizeFailure returns the non-empty lines of a failure with run specific values replaced.
+func normalizeFailure(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		for _, n := range failureNormalizers {
+			line = n.regex.ReplaceAllString(line, n.replacement)
+		}
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// shownFailure is the failure text as it is shown in the description.
+func (tc j2jTestCase) shownFailure() string {
+	if tc.Message != "" {
+		return tc.excerpt(tc.Message, maxTextBlockLength)
+	}
+	return tc.excerpt(tc.Error, maxTextBlockLength)
+}
+
+// previousFailure returns the failure text of a description created by junit2jira.
+func previousFailure(body *models.CommentNodeScheme) (string, bool) {
+	if body == nil {
+		return "", false
+	}
+	failure := ""
+	heading := ""
+	fromJunit2jira := false
+	for _, node := range body.Content {
+		switch node.Type {
+		case "heading":
+			heading = nodeText(node)
+			if heading == "Build Information" {
+				fromJunit2jira = true
+			}
+		case "codeBlock":
+			if heading == "Message" || (heading == "ERROR" && failure == "") {
+				failure = nodeText(node)
+			}
+		}
+	}
+	return failure, fromJunit2jira
+}
+
+func nodeText(node *models.CommentNodeScheme) string {
+	var b strings.Builder
+	b.WriteString(node.Text)
+	for _, c := range node.Content {
+		b.WriteString(nodeText(c))
+	}
+	return b.String()
+}
+
+// lineDiff returns removed and added lines between a and b, based on their longest common subsequence.
+// Only the first maxDiffInputLines lines of each side that differ are compared.
+func lineDiff(a, b []string) []string {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	uncompared := max(len(a)-maxDiffInputLines, 0) + max(len(b)-maxDiffInputLines, 0)
+	a, b = a[:min(len(a), maxDiffInputLines)], b[:min(len(b), maxDiffInputLines)]
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for k := len(b) - 1; k >= 0; k-- {
+			if a[i] == b[k] {
+				lcs[i][k] = lcs[i+1][k+1] + 1
+			} else {
+				lcs[i][k] = max(lcs[i+1][k], lcs[i][k+1])
+			}
+		}
+	}
+
+	var diff []string
+	i, k := 0, 0
+	for i < len(a) || k < len(b) {
+		switch {
+		case i < len(a) && k < len(b) && a[i] == b[k]:
+			i++
+			k++
+		case i < len(a) && (k == len(b) || lcs[i+1][k] >= lcs[i][k+1]):
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[k])
+			k++
+		}
+	}
+	if len(diff) > maxDiffLines {
+		diff = append(diff[:maxDiffLines], fmt.Sprintf("… %d more changed lines", len(diff)-maxDiffLines))
+	}
+	if uncompared > 0 {
+		diff = append(diff, fmt.Sprintf("… %d more lines not compared", uncompared))
+	}
+	return diff
+}
+
+// previousOccurrence returns the failure text of the last comment of junit2jira on the issue, or of the
+// description if there is no such comment.
+func (j junit2jira) previousOccurrence(issueKey string) (string, bool, error) {
+	comments, response, err := j.jiraClient.Issue.Comment.Gets(context.TODO(), issueKey, "-created", nil, 0, previousCommentsLimit)
+	if err != nil {
+		logError(err, response)
+		return "", false, errors.Wrap(err, "could not get comments")
+	}
+	for _, c := range comments.Comments {
+		if previous, ok := previousFailure(c.Body); ok {
+			return previous, true, nil
+		}
+	}
+
+	issue, response, err := j.jiraClient.Issue.Get(context.TODO(), issueKey, []string{"description"}, nil)
+	if err != nil {
+		logError(err, response)
+		return "", false, errors.Wrap(err, "could not get description")
+	}
+	if issue.Fields == nil {
+		return "", false, nil
+	}
+	previous, ok := previousFailure(issue.Fields.Description)
+	return previous, ok, nil
+}
+
+// compareWithPrevious returns nodes telling how the failure differs from the previous occurrence.
+// Nothing is returned if there is no previous occurrence.
+func (j junit2jira) compareWithPrevious(issueKey string, tc j2jTestCase) ([]*models.CommentNodeScheme, error) {
+	previous, ok, err := j.previousOccurrence(issueKey)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	diff := lineDiff(normalizeFailure(previous), normalizeFailure(tc.shownFailure()))
+	if len(diff) == 0 {
+		return []*models.CommentNodeScheme{{
+			Type: "paragraph",
+			Content: []*models.CommentNodeScheme{
+				{Type: "text", Text: sameAsPreviousText, Marks: []*models.MarkScheme{{Type: "strong"}}},
+			},
+		}}, nil
+	}
+	return []*models.CommentNodeScheme{
+		{
+			Type: "heading",
+			Attrs: map[string]any{
+				"level": 3,
+			},
+			Content: []*models.CommentNodeScheme{
+				{Type: "text", Text: "Changes Since Previous Occurrence"},
+			},
+		},
+		{
+			Type: "codeBlock",
+			Attrs: map[string]any{
+				"language": "diff",
+			},
+			Content: []*models.CommentNodeScheme{
+				{Type: "text", Text: strings.Join(diff, "\n")},
+			},
+		},
+	}, nil
+}
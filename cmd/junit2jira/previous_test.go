@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	jira "github.com/ctreminiom/go-atlassian/v2/jira/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeFailure(t *testing.T) {
+	assert.Equal(t, []string{
+		"<TIME> dial tcp <IP>: connection refused after <DURATION>",
+		"pod <UUID> at <HEX> restarted <N> times",
+	}, normalizeFailure(`2024-05-02T10:11:12.345Z dial tcp 10.0.0.1:8443: connection refused after 1.5s
+
+    pod 123e4567-e89b-12d3-a456-426614174000 at 0xc000123 restarted 12345 times
+`))
+	assert.Equal(t, []string{"expected 3, got 4"}, normalizeFailure("expected 3, got 4"))
+}
+
+func TestLineDiff(t *testing.T) {
+	assert.Empty(t, lineDiff([]string{"a", "b"}, []string{"a", "b"}))
+	assert.Equal(t, []string{"- b", "+ c", "+ d"}, lineDiff([]string{"a", "b"}, []string{"a", "c", "d"}))
+
+	var many []string
+	for i := 0; i < 25; i++ {
+		many = append(many, fmt.Sprintf("line %d", i))
+	}
+	diff := lineDiff(nil, many)
+	assert.Len(t, diff, maxDiffLines+1)
+	assert.Equal(t, "… 5 more changed lines", diff[maxDiffLines])
+}
+
+func TestLineDiffLargeInput(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20000; i++ {
+		a = append(a, fmt.Sprintf("line %d", i))
+		b = append(b, fmt.Sprintf("line %d", i))
+	}
+	b[10000] = "changed"
+	assert.Equal(t, []string{"- line 10000", "+ changed"}, lineDiff(a, b))
+
+	var other []string
+	for i := 0; i < 20000; i++ {
+		other = append(other, fmt.Sprintf("other %d", i))
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	diff := lineDiff(a, other)
+	runtime.ReadMemStats(&after)
+	assert.Len(t, diff, maxDiffLines+2)
+	assert.Equal(t, "… 39000 more lines not compared", diff[maxDiffLines+1])
+	// A full table of both sides would take more than 3 GB.
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(10<<20))
+}
+
+func adfWithMessage(message string) string {
+	return fmt.Sprintf(`{"type":"doc","version":1,"content":[
+		{"type":"heading","content":[{"type":"text","text":"Message"}]},
+		{"type":"codeBlock","content":[{"type":"text","text":%q}]},
+		{"type":"heading","content":[{"type":"text","text":"Build Information"}]}
+	]}`, message)
+}
+
+func TestCompareWithPrevious(t *testing.T) {
+	comments := fmt.Sprintf(`{"comments":[
+		{"body":{"type":"doc","version":1,"content":[{"type":"paragraph","content":[{"type":"text","text":"Looking into it"}]}]}},
+		{"body":%s}
+	]}`, adfWithMessage("2024-05-01T10:00:00Z timeout after 30s\nexpected 3 replicas"))
+
+	compare := func(t *testing.T, routes map[string]string, message string) string {
+		u := newFakeJira(t, "", routes)
+		client, err := jira.New(nil, u.String())
+		require.NoError(t, err)
+		nodes, err := junit2jira{jiraClient: client}.compareWithPrevious("ROX-1", j2jTestCase{Name: "TestA", Message: message})
+		require.NoError(t, err)
+		if len(nodes) == 0 {
+			return ""
+		}
+		return nodeText(nodes[len(nodes)-1])
+	}
+
+	t.Run("same", func(t *testing.T) {
+		routes := map[string]string{"GET /rest/api/3/issue/ROX-1/comment": comments}
+		assert.Equal(t, sameAsPreviousText, compare(t, routes, "2024-05-02T11:00:00Z timeout after 45s\nexpected 3 replicas"))
+	})
+	t.Run("changed", func(t *testing.T) {
+		routes := map[string]string{"GET /rest/api/3/issue/ROX-1/comment": comments}
+		assert.Equal(t, "- expected 3 replicas\n+ expected 2 replicas", compare(t, routes, "2024-05-02T11:00:00Z timeout after 45s\nexpected 2 replicas"))
+	})
+	t.Run("description", func(t *testing.T) {
+		routes := map[string]string{
+			"GET /rest/api/3/issue/ROX-1/comment": `{"comments":[]}`,
+			"GET /rest/api/3/issue/ROX-1":         fmt.Sprintf(`{"key":"ROX-1","fields":{"description":%s}}`, adfWithMessage("expected 3 replicas")),
+		}
+		assert.Equal(t, sameAsPreviousText, compare(t, routes, "expected 3 replicas"))
+	})
+	t.Run("not created by junit2jira", func(t *testing.T) {
+		routes := map[string]string{
+			"GET /rest/api/3/issue/ROX-1/comment": `{"comments":[]}`,
+			"GET /rest/api/3/issue/ROX-1":         `{"key":"ROX-1","fields":{"description":{"type":"doc","version":1,"content":[]}}}`,
+		}
+		assert.Empty(t, compare(t, routes, "expected 3 replicas"))
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const redactedText = "[REDACTED]"
+
+// secretDetector matches a kind of secret. Replacement is expanded like in regexp.Regexp.ReplaceAllString,
+// so detectors can keep a non-sensitive prefix (e.g. the key in key=value pairs) readable.
+type secretDetector struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+}
+
+var builtinSecretDetectors = []secretDetector{
+	{
+		name:        "pem",
+		re:          regexp.MustCompile(`(?s)-----BEGIN [A-Z0-9 ]+-----.*?-----END [A-Z0-9 ]+-----`),
+		replacement: redactedText,
+	},
+	{
+		name:        "jwt",
+		re:          regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		replacement: redactedText,
+	},
+	{
+		name:        "aws-access-key",
+		re:          regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+		replacement: redactedText,
+	},
+	{
+		name:        "gcp-api-key",
+		re:          regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+		replacement: redactedText,
+	},
+	{
+		// Kubeconfig embedded certificates and keys.
+		name:        "kubeconfig-data",
+		re:          regexp.MustCompile(`\b((?:certificate-authority|client-certificate|client-key)-data\s*:\s*)\S+`),
+		replacement: "${1}" + redactedText,
+	},
+	{
+		// Image pull secrets (.dockerconfigjson) and GCP service account keys.
+		name:        "json-secret",
+		re:          regexp.MustCompile(`("(?:auth|password|private_key|private_key_id|client_secret|token)"\s*:\s*)"(?:[^"\\]|\\.)*"`),
+		replacement: "${1}\"" + redactedText + "\"",
+	},
+	{
+		name:        "basic-auth-url",
+		re:          regexp.MustCompile(`\b([a-zA-Z][a-zA-Z0-9+.-]*://)[^/\s:@]+:[^/\s@]+@`),
+		replacement: "${1}" + redactedText + "@",
+	},
+	{
+		name:        "password-pair",
+		re:          regexp.MustCompile(`(?i)\b((?:[a-z0-9]+[_-])*(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|secret[_-]?access[_-]?key|client[_-]?secret)\s*[=:]\s*)(?:"[^"\s]*"|'[^'\s]*'|[^\s"',;&]+)`),
+		replacement: "${1}" + redactedText,
+	},
+}
+
+// redactor removes secrets from test output before it is published to Jira, Slack or any other output.
+type redactor struct {
+	detectors []secretDetector
+	count     int
+}
+
+func newRedactor(patterns []string) (*redactor, error) {
+	detectors := make([]secretDetector, 0, len(builtinSecretDetectors)+len(patterns))
+	detectors = append(detectors, builtinSecretDetectors...)
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid redaction pattern %q", pattern)
+		}
+		detectors = append(detectors, secretDetector{
+			name:        fmt.Sprintf("custom-%d", i),
+			re:          re,
+			replacement: redactedText,
+		})
+	}
+	return &redactor{detectors: detectors}, nil
+}
+
+func (r *redactor) redact(s string) string {
+	if s == "" {
+		return s
+	}
+	for _, d := range r.detectors {
+		s = d.re.ReplaceAllStringFunc(s, func(match string) string {
+			replaced := d.re.ReplaceAllString(match, d.replacement)
+			// Do not count secrets again that were already redacted by a previous detector.
+			if replaced != match && !strings.Contains(match, redactedText) {
+				log.Debugf("Redacted %s secret", d.name)
+				r.count++
+			}
+			return replaced
+		})
+	}
+	return s
+}
+
+// redactSuites redacts the output of failed tests in place, so that every output built from the reports,
+// including the HTML report, sees the same redacted text and each secret is counted once.
+func (r *redactor) redactSuites(suites []junit.Suite) {
+	for i := range suites {
+		r.redactSuites(suites[i].Suites)
+		for k := range suites[i].Tests {
+			t := &suites[i].Tests[k]
+			if t.Error == nil {
+				continue
+			}
+			t.Message = r.redact(t.Message)
+			t.SystemOut = r.redact(t.SystemOut)
+			t.SystemErr = r.redact(t.SystemErr)
+			if msg := r.redact(t.Error.Error()); msg != t.Error.Error() {
+				t.Error = errors.New(msg)
+			}
+		}
+	}
+}
+
+// redactTestCase redacts the text of a test case that is published. Text that is already redacted
+// is not counted again, so it is safe to call after hooks changed the test case.
+func (r *redactor) redactTestCase(tc j2jTestCase) j2jTestCase {
+	tc.Message = r.redact(tc.Message)
+	tc.Stdout = r.redact(tc.Stdout)
+	tc.Stderr = r.redact(tc.Stderr)
+	tc.Error = r.redact(tc.Error)
+	tc.Note = r.redact(tc.Note)
+	if tc.SuspectCommits != nil {
+		suspects := *tc.SuspectCommits
+		suspects.Commits = make([]commit, len(tc.SuspectCommits.Commits))
+		for i, c := range tc.SuspectCommits.Commits {
+			c.Subject = r.redact(c.Subject)
+			suspects.Commits[i] = c
+		}
+		tc.SuspectCommits = &suspects
+	}
+	return tc
+}
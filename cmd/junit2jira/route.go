@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// slackRouteConfig is a rule choosing where a failed test is reported in Slack and who is mentioned.
+// As for filing policies, all set regular expressions must match the whole value for the rule to apply.
+type slackRouteConfig struct {
+	// Name identifies the rule in logs.
+	Name              string `yaml:"name"`
+	JobNameRegex      string `yaml:"jobNameRegex"`
+	OrchestratorRegex string `yaml:"orchestratorRegex"`
+	SuiteRegex        string `yaml:"suiteRegex"`
+	TestNameRegex     string `yaml:"testNameRegex"`
+	// Channel is posted to with a bot token. Without it the default channel is used.
+	Channel string `yaml:"channel"`
+	// WebhookSecret is the name of the secret with the incoming webhook of the channel, SLACK_WEBHOOK_URL by default.
+	WebhookSecret string `yaml:"webhookSecret"`
+	// Mention is added to the message, e.g. <!subteam^S0123> for a user group or <@U0123> for a user.
+	Mention string `yaml:"mention"`
+}
+
+type slackRoute struct {
+	config slackRouteConfig
+	testMatcher
+}
+
+// slackDestination collects the failures posted to the same channel.
+type slackDestination struct {
+	// channel and webhookSecret are empty for the default destination.
+	channel       string
+	webhookSecret string
+	mentions      []string
+	issues        []*testIssue
+}
+
+var outputNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// outputName is the suffix of the output file with messages for the destination.
+func (d *slackDestination) outputName() string {
+	name := strings.ToLower(orDefault(strings.TrimPrefix(d.channel, "#"), d.webhookSecret))
+	return strings.Trim(outputNameRegex.ReplaceAllString(name, "-"), "-")
+}
+
+func newSlackRoute(config slackRouteConfig) (*slackRoute, error) {
+	if config.Channel == "" && config.WebhookSecret == "" && config.Mention == "" {
+		return nil, fmt.Errorf("rule %q has no channel, webhookSecret or mention", config.Name)
+	}
+	m, err := newTestMatcher(config.Name, config.JobNameRegex, "", config.OrchestratorRegex, config.SuiteRegex, config.TestNameRegex, "")
+	if err != nil {
+		return nil, err
+	}
+	return &slackRoute{config: config, testMatcher: m}, nil
+}
+
+// routeSlack groups failures by the destination of the first matching rule. Failures without a matching
+// rule go to the default destination, which comes first.
+func routeSlack(routes []*slackRoute, issues []*testIssue) []*slackDestination {
+	destinations := []*slackDestination{{}}
+	find := func(channel, webhookSecret string) *slackDestination {
+		for _, d := range destinations {
+			if d.channel == channel && d.webhookSecret == webhookSecret {
+				return d
+			}
+		}
+		d := &slackDestination{channel: channel, webhookSecret: webhookSecret}
+		destinations = append(destinations, d)
+		return d
+	}
+
+	for _, i := range issues {
+		d := destinations[0]
+		for _, r := range routes {
+			if !r.match(i.testCase) {
+				continue
+			}
+			logEntry("?", i.testCase.Suite+" / "+i.testCase.Name).Debugf("Matched Slack rule %q", r.config.Name)
+			d = find(r.config.Channel, r.config.WebhookSecret)
+			if r.config.Mention != "" && !slices.Contains(d.mentions, r.config.Mention) {
+				d.mentions = append(d.mentions, r.config.Mention)
+			}
+			break
+		}
+		d.issues = append(d.issues, i)
+	}
+
+	routed := make([]*slackDestination, 0, len(destinations))
+	for _, d := range destinations {
+		if len(d.issues) > 0 {
+			routed = append(routed, d)
+		}
+	}
+	return routed
+}
+
+func loadSlackRoutingFile(fileName string) ([]*slackRoute, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("read Slack routing file: %s", fileName))
+	}
+
+	configs := make([]slackRouteConfig, 0)
+	err = yaml.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("parse Slack routing file: %s", fileName))
+	}
+
+	routes := make([]*slackRoute, 0, len(configs))
+	for _, config := range configs {
+		route, err := newSlackRoute(config)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("create Slack route from file: %s", fileName))
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSlackRoutingFile(t *testing.T) {
+	_, err := loadSlackRoutingFile("testdata/routing/missing.yml")
+	assert.ErrorContains(t, err, "read Slack routing file: testdata/routing/missing.yml")
+
+	routes, err := loadSlackRoutingFile("testdata/routing/routing.yml")
+	require.NoError(t, err)
+	require.Len(t, routes, 3)
+
+	_, err = newSlackRoute(slackRouteConfig{Name: "empty", SuiteRegex: "suite"})
+	assert.EqualError(t, err, `rule "empty" has no channel, webhookSecret or mention`)
+	_, err = newSlackRoute(slackRouteConfig{Name: "bad", SuiteRegex: "(", Channel: "#ci"})
+	assert.ErrorContains(t, err, `invalid suiteRegex in rule "bad"`)
+}
+
+func TestRouteSlack(t *testing.T) {
+	routes, err := loadSlackRoutingFile("testdata/routing/routing.yml")
+	require.NoError(t, err)
+
+	scanner := &testIssue{testCase: j2jTestCase{JobName: "nightly", Orchestrator: "openshift", Suite: "github.com/stackrox/rox/scanner/api", Name: "TestA"}}
+	openshift := &testIssue{testCase: j2jTestCase{JobName: "nightly", Orchestrator: "openshift", Suite: "github.com/stackrox/rox/central", Name: "TestB"}}
+	other := &testIssue{testCase: j2jTestCase{JobName: "nightly", Orchestrator: "gke", Suite: "github.com/stackrox/rox/central", Name: "TestC"}}
+	ui := &testIssue{testCase: j2jTestCase{JobName: "ui-e2e", Suite: "ui", Name: "TestD"}}
+
+	destinations := routeSlack(routes, []*testIssue{scanner, openshift, other, ui})
+	require.Len(t, destinations, 3)
+
+	assert.Empty(t, destinations[0].channel)
+	assert.Equal(t, []string{"<@U0OPENSHIFT>"}, destinations[0].mentions)
+	assert.Equal(t, []*testIssue{openshift, other}, destinations[0].issues)
+	assert.Empty(t, destinations[0].outputName())
+
+	assert.Equal(t, "#scanner-ci", destinations[1].channel)
+	assert.Equal(t, []string{"<!subteam^S0SCANNER>"}, destinations[1].mentions)
+	assert.Equal(t, []*testIssue{scanner}, destinations[1].issues)
+	assert.Equal(t, "scanner-ci", destinations[1].outputName())
+
+	assert.Equal(t, "SLACK_WEBHOOK_URL_UI", destinations[2].webhookSecret)
+	assert.Equal(t, []*testIssue{ui}, destinations[2].issues)
+	assert.Equal(t, "slack_webhook_url_ui", destinations[2].outputName())
+
+	assert.Empty(t, routeSlack(routes, nil))
+	assert.Len(t, routeSlack(nil, []*testIssue{scanner, ui}), 1)
+}
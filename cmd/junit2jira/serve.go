@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	jira "github.com/ctreminiom/go-atlassian/v2/jira/v3"
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+const (
+	slackSigningSecretEnv = "SLACK_SIGNING_SECRET"
+
+	slackActionOpen   = "open_jira"
+	slackActionFlaky  = "mark_flaky"
+	slackActionAssign = "assign_to_me"
+
+	// Slack expects an answer within 3 seconds, the result is sent later to the response URL.
+	slackActionTimeout = 30 * time.Second
+	maxSlackBodySize   = 1 << 20
+)
+
+var issueKeyRegex = regexp.MustCompile(`^([A-Z][A-Z0-9_]*)-\d+$`)
+
+// slackActionsBlock are the buttons to triage the issue of a failure, handled by serve-slack.
+func (j junit2jira) slackActionsBlock(key string) slack.Block {
+	return slack.NewActionBlock("junit2jira:"+key,
+		slack.NewButtonBlockElement(slackActionOpen, key, slack.NewTextBlockObject("plain_text", "Open Jira", false, false)).WithURL(j.issueURL(key)),
+		slack.NewButtonBlockElement(slackActionFlaky, key, slack.NewTextBlockObject("plain_text", "Mark as flaky", false, false)),
+		slack.NewButtonBlockElement(slackActionAssign, key, slack.NewTextBlockObject("plain_text", "Assign to me", false, false)).WithStyle(slack.StylePrimary),
+	)
+}
+
+type serveSlackParams struct {
+	listen string
+}
+
+func (s *serveSlackParams) addFlags(fs *flag.FlagSet) {
+	fs.StringVar(&s.listen, "listen", ":8080", "Address to listen on for Slack interactions")
+}
+
+// runServeSlack serves the interactivity request URL of the Slack app.
+func runServeSlack(p params, s serveSlackParams) error {
+	h, err := newSlackActionHandler(p)
+	if err != nil {
+		return err
+	}
+	log.Infof("Listening for Slack interactions on %s", s.listen)
+	server := &http.Server{
+		Addr:              s.listen,
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+// slackActionHandler performs the Jira actions of buttons pressed in Slack.
+type slackActionHandler struct {
+	signingSecret string
+	projects      []string
+	jiraClient    *jira.Client
+	// slackClient looks up the email of the user pressing a button.
+	slackClient *slack.Client
+	httpClient  *http.Client
+	// pending are the actions still running after Slack got its answer.
+	pending sync.WaitGroup
+}
+
+func newSlackActionHandler(p params) (*slackActionHandler, error) {
+	signingSecret, err := secret(slackSigningSecretEnv, p.secretsDir)
+	if err != nil {
+		return nil, err
+	}
+	if signingSecret == "" {
+		return nil, fmt.Errorf("%s is required to verify Slack requests", slackSigningSecretEnv)
+	}
+	token, err := secret(slackBotTokenEnv, p.secretsDir)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%s is required to look up Slack users", slackBotTokenEnv)
+	}
+	httpClient, err := p.transport.NewClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create HTTP client")
+	}
+	jiraClient, err := newJiraClient(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return &slackActionHandler{
+		signingSecret: signingSecret,
+		projects:      strings.Split(p.jiraProject, ","),
+		jiraClient:    jiraClient,
+		slackClient:   slack.New(token, slack.OptionHTTPClient(httpClient), slack.OptionAPIURL(slackAPIURL)),
+		httpClient:    httpClient,
+	}, nil
+}
+
+func (h *slackActionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSlackBodySize))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	verifier, err := slack.NewSecretsVerifier(r.Header, h.signingSecret)
+	if err == nil {
+		_, _ = verifier.Write(body)
+		err = verifier.Ensure()
+	}
+	if err != nil {
+		log.WithError(err).Warn("Rejected Slack request")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(r.FormValue("payload")), &callback); err != nil {
+		log.WithError(err).Warn("Could not parse Slack payload")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	h.pending.Add(1)
+	go func() {
+		defer h.pending.Done()
+		for _, action := range callback.ActionCallback.BlockActions {
+			result, err := h.perform(action.ActionID, action.Value, callback.User.ID)
+			if err != nil {
+				log.WithError(err).Warnf("Slack action %s on %s by %s failed", action.ActionID, action.Value, callback.User.ID)
+				result = fmt.Sprintf("Could not update %s: %s", action.Value, err)
+			}
+			if result != "" {
+				h.respond(callback.ResponseURL, result)
+			}
+		}
+	}()
+}
+
+// perform runs a Slack action on an issue and returns a message for the user.
+func (h *slackActionHandler) perform(actionID, key, userID string) (string, error) {
+	if actionID == slackActionOpen {
+		// The button only opens the link.
+		return "", nil
+	}
+	m := issueKeyRegex.FindStringSubmatch(key)
+	if m == nil || !slices.Contains(h.projects, m[1]) {
+		return "", fmt.Errorf("%q is not an issue of %s", key, strings.Join(h.projects, ", "))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), slackActionTimeout)
+	defer cancel()
+
+	switch actionID {
+	case slackActionFlaky:
+		operations := &models.UpdateOperations{}
+		if err := operations.AddArrayOperation("labels", map[string]string{flakyLabel: "add"}); err != nil {
+			return "", err
+		}
+		response, err := h.jiraClient.Issue.Update(ctx, key, false, &models.IssueScheme{}, nil, operations)
+		if err != nil {
+			logError(err, response)
+			return "", errors.Wrap(err, "could not add label")
+		}
+		logEntry(key, "").Infof("Labeled %s by Slack user %s", flakyLabel, userID)
+		return fmt.Sprintf("Labeled %s as %s.", key, flakyLabel), nil
+	case slackActionAssign:
+		user, err := h.slackClient.GetUserInfoContext(ctx, userID)
+		if err != nil {
+			return "", errors.Wrap(err, "could not get Slack user")
+		}
+		if user.Profile.Email == "" {
+			return "", errors.New("the Slack app cannot read your email, it needs the users:read.email scope")
+		}
+		users, response, err := h.jiraClient.User.Search.Do(ctx, "", user.Profile.Email, 0, 1)
+		if err != nil {
+			logError(err, response)
+			return "", errors.Wrap(err, "could not search Jira users")
+		}
+		if len(users) == 0 {
+			return "", fmt.Errorf("no Jira user with email %s", user.Profile.Email)
+		}
+		response, err = h.jiraClient.Issue.Assign(ctx, key, users[0].AccountID)
+		if err != nil {
+			logError(err, response)
+			return "", errors.Wrap(err, "could not assign")
+		}
+		logEntry(key, "").Infof("Assigned to %s by Slack user %s", users[0].DisplayName, userID)
+		return fmt.Sprintf("Assigned %s to %s.", key, users[0].DisplayName), nil
+	default:
+		return "", fmt.Errorf("unknown action %q", actionID)
+	}
+}
+
+// respond shows the result only to the user who pressed the button.
+func (h *slackActionHandler) respond(responseURL, text string) {
+	if responseURL == "" {
+		return
+	}
+	err := withSlackRetries(func(ctx context.Context) error {
+		return slack.PostWebhookCustomHTTPContext(ctx, responseURL, h.httpClient, &slack.WebhookMessage{
+			Text:         text,
+			ResponseType: slack.ResponseTypeEphemeral,
+		})
+	})
+	if err != nil {
+		log.WithError(err).Warn("Could not respond to Slack")
+	}
+}
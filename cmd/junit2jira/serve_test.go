@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	jira "github.com/ctreminiom/go-atlassian/v2/jira/v3"
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slackRequest returns a request signed like Slack does with the payload of a pressed button.
+func slackRequest(t *testing.T, secret, actionID, key, responseURL string) *http.Request {
+	payload, err := json.Marshal(map[string]any{
+		"type":         "block_actions",
+		"user":         map[string]string{"id": "U1"},
+		"response_url": responseURL,
+		"actions":      []map[string]string{{"block_id": "junit2jira:" + key, "action_id": actionID, "value": key, "type": "button"}},
+	})
+	require.NoError(t, err)
+	body := url.Values{"payload": {string(payload)}}.Encode()
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestSlackActionHandler(t *testing.T) {
+	var jiraRequests []string
+	jiraServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		jiraRequests = append(jiraRequests, fmt.Sprintf("%s %s %s", r.Method, r.URL.RequestURI(), strings.TrimSpace(string(body))))
+		switch r.URL.Path {
+		case "/rest/api/3/user/search":
+			_, _ = w.Write([]byte(`[{"accountId":"a1","displayName":"Jane Doe"}]`))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer jiraServer.Close()
+	jiraClient, err := jira.New(jiraServer.Client(), jiraServer.URL)
+	require.NoError(t, err)
+
+	slackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/users.info", r.URL.Path)
+		_, _ = w.Write([]byte(`{"ok":true,"user":{"id":"U1","profile":{"email":"jane@example.com"}}}`))
+	}))
+	defer slackServer.Close()
+
+	var responses []string
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		assert.Equal(t, slack.ResponseTypeEphemeral, msg.ResponseType)
+		responses = append(responses, msg.Text)
+	}))
+	defer responseServer.Close()
+
+	h := &slackActionHandler{
+		signingSecret: "signing-secret",
+		projects:      []string{"ROX"},
+		jiraClient:    jiraClient,
+		slackClient:   slack.New("xoxb-token", slack.OptionAPIURL(slackServer.URL+"/")),
+		httpClient:    http.DefaultClient,
+	}
+	serve := func(r *http.Request) int {
+		jiraRequests, responses = nil, nil
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		h.pending.Wait()
+		return w.Code
+	}
+
+	t.Run("mark as flaky", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(slackRequest(t, "signing-secret", slackActionFlaky, "ROX-1", responseServer.URL)))
+		assert.Equal(t, []string{`PUT /rest/api/3/issue/ROX-1?notifyUsers=false {"update":{"labels":[{"add":"flaky"}]}}`}, jiraRequests)
+		assert.Equal(t, []string{"Labeled ROX-1 as flaky."}, responses)
+	})
+	t.Run("assign to me", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(slackRequest(t, "signing-secret", slackActionAssign, "ROX-1", responseServer.URL)))
+		assert.Equal(t, []string{
+			`GET /rest/api/3/user/search?maxResults=1&query=jane%40example.com&startAt=0 `,
+			`PUT /rest/api/3/issue/ROX-1/assignee {"accountId":"a1"}`,
+		}, jiraRequests)
+		assert.Equal(t, []string{"Assigned ROX-1 to Jane Doe."}, responses)
+	})
+	t.Run("open Jira", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(slackRequest(t, "signing-secret", slackActionOpen, "ROX-1", responseServer.URL)))
+		assert.Empty(t, jiraRequests)
+		assert.Empty(t, responses)
+	})
+	t.Run("other project", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve(slackRequest(t, "signing-secret", slackActionFlaky, "OTHER-1", responseServer.URL)))
+		assert.Empty(t, jiraRequests)
+		assert.Equal(t, []string{`Could not update OTHER-1: "OTHER-1" is not an issue of ROX`}, responses)
+	})
+	t.Run("wrong signature", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve(slackRequest(t, "other-secret", slackActionFlaky, "ROX-1", responseServer.URL)))
+		assert.Empty(t, jiraRequests)
+	})
+}
+
+func TestSlackActionsBlock(t *testing.T) {
+	jiraUrl, err := url.Parse("https://jira.example.com/")
+	require.NoError(t, err)
+	j := junit2jira{params: params{jiraUrl: jiraUrl, slackActions: true}}
+	issues := []*testIssue{
+		{issue: &models.IssueScheme{Key: "ROX-1"}, testCase: j2jTestCase{Name: "TestA", Message: "boom"}},
+		{testCase: j2jTestCase{Name: "TestB", Message: "bang"}},
+	}
+
+	messages := j.convertJunitToSlack(nil, issues...)
+	require.Len(t, messages, 1)
+	require.Len(t, messages[0], 3)
+	actions, ok := messages[0][1].Blocks.BlockSet[len(messages[0][1].Blocks.BlockSet)-1].(*slack.ActionBlock)
+	require.True(t, ok)
+	require.Len(t, actions.Elements.ElementSet, 3)
+	assert.Equal(t, "https://jira.example.com/browse/ROX-1", actions.Elements.ElementSet[0].(*slack.ButtonBlockElement).URL)
+	assert.Equal(t, slackActionFlaky, actions.Elements.ElementSet[1].(*slack.ButtonBlockElement).ActionID)
+	assert.Equal(t, "ROX-1", actions.Elements.ElementSet[2].(*slack.ButtonBlockElement).Value)
+
+	_, ok = messages[0][2].Blocks.BlockSet[len(messages[0][2].Blocks.BlockSet)-1].(*slack.ActionBlock)
+	assert.False(t, ok, "failures without an issue have no buttons")
+}
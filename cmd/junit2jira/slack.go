@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/slack-go/slack"
+)
+
+const (
+	slackDeliveryNone    = "none"
+	slackDeliveryWebhook = "webhook"
+	slackDeliveryBot     = "bot"
+
+	slackWebhookEnv  = "SLACK_WEBHOOK_URL"
+	slackBotTokenEnv = "SLACK_BOT_TOKEN"
+
+	// slackMaxRetries is the number of times a message is retried after Slack rate limited it.
+	slackMaxRetries = 5
+	slackTimeout    = time.Minute
+	// Slack accepts up to 50 blocks per message, attachments included.
+	slackMaxBlocks = 50
+	// slackMaxMessageSize keeps messages well below the size where Slack starts to truncate them.
+	slackMaxMessageSize = 40000
+)
+
+// slackAPIURL is the Slack Web API used with a bot token, it is replaced in tests.
+var slackAPIURL = slack.APIURL
+
+// runStats are the totals of all tests in the reports.
+type runStats struct {
+	Total  int
+	Failed int
+}
+
+func countTests(suites []junit.Suite) runStats {
+	stats := runStats{}
+	for _, suite := range suites {
+		nested := countTests(suite.Suites)
+		stats.Total += nested.Total + len(suite.Tests)
+		stats.Failed += nested.Failed
+		for _, t := range suite.Tests {
+			if t.Status == junit.StatusFailed || t.Status == junit.StatusError {
+				stats.Failed++
+			}
+		}
+	}
+	return stats
+}
+
+// slackPost is a message posted to Slack, reported in the summary output.
+type slackPost struct {
+	Channel string `json:"channel,omitempty"`
+	// Ts is the timestamp of the message, which identifies it in the channel. It is not known for webhooks.
+	Ts string `json:"ts,omitempty"`
+}
+
+func validateSlackParams(p params) error {
+	switch p.slackDelivery {
+	case "", slackDeliveryNone, slackDeliveryWebhook:
+	case slackDeliveryBot:
+		if p.slackChannel == "" && p.slackRoutingFile == "" {
+			return errors.New("-slack-channel is required to post with a bot token")
+		}
+	default:
+		return fmt.Errorf("unknown Slack delivery %q, expected %q, %q or %q", p.slackDelivery, slackDeliveryNone, slackDeliveryWebhook, slackDeliveryBot)
+	}
+	return nil
+}
+
+// slackPoster posts messages either to incoming webhooks or with a bot token to channels.
+type slackPoster struct {
+	httpClient *http.Client
+	// client is set when posting with a bot token.
+	client     *slack.Client
+	secretsDir string
+}
+
+func newSlackPoster(p params) (*slackPoster, error) {
+	httpClient, err := p.transport.NewClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create HTTP client")
+	}
+	poster := &slackPoster{httpClient: httpClient, secretsDir: p.secretsDir}
+
+	if p.slackDelivery == slackDeliveryBot {
+		token, err := secret(slackBotTokenEnv, p.secretsDir)
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			return nil, fmt.Errorf("%s is required to post with a Slack bot token", slackBotTokenEnv)
+		}
+		poster.client = slack.New(token, slack.OptionHTTPClient(httpClient), slack.OptionAPIURL(slackAPIURL))
+	}
+	return poster, nil
+}
+
+// slackTarget is a destination resolved for posting: the channel, and the webhook URL if posting to webhooks.
+type slackTarget struct {
+	channel string
+	webhook string
+}
+
+func (t slackTarget) String() string {
+	if t.channel == "" {
+		return "webhook"
+	}
+	return t.channel
+}
+
+func (s *slackPoster) target(d *slackDestination, defaultChannel string) (slackTarget, error) {
+	if s.client != nil {
+		return slackTarget{channel: orDefault(d.channel, defaultChannel)}, nil
+	}
+	name := orDefault(d.webhookSecret, slackWebhookEnv)
+	webhook, err := secret(name, s.secretsDir)
+	if err == nil && webhook == "" {
+		err = fmt.Errorf("%s is required to post to a Slack webhook", name)
+	}
+	return slackTarget{channel: d.channel, webhook: webhook}, err
+}
+
+// post sends a message, as a reply if threadTs is set. Webhooks cannot reply in threads, so for them
+// threadTs is ignored and no timestamp is returned.
+func (s *slackPoster) post(t slackTarget, text string, blocks []slack.Block, attachments []slack.Attachment, threadTs string) (string, error) {
+	var ts string
+	err := withSlackRetries(func(ctx context.Context) error {
+		if s.client == nil {
+			msg := &slack.WebhookMessage{Channel: t.channel, Text: text, Attachments: attachments}
+			if len(blocks) > 0 {
+				msg.Blocks = &slack.Blocks{BlockSet: blocks}
+			}
+			return slack.PostWebhookCustomHTTPContext(ctx, t.webhook, s.httpClient, msg)
+		}
+		options := []slack.MsgOption{slack.MsgOptionText(text, false), slack.MsgOptionDisableLinkUnfurl()}
+		if len(blocks) > 0 {
+			options = append(options, slack.MsgOptionBlocks(blocks...))
+		}
+		if len(attachments) > 0 {
+			options = append(options, slack.MsgOptionAttachments(attachments...))
+		}
+		if threadTs != "" {
+			options = append(options, slack.MsgOptionTS(threadTs))
+		}
+		var err error
+		_, ts, err = s.client.PostMessageContext(ctx, t.channel, options...)
+		return err
+	})
+	return ts, err
+}
+
+// withSlackRetries calls post again after the delay requested by Slack when it was rate limited.
+func withSlackRetries(post func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), slackTimeout)
+		err := post(ctx)
+		cancel()
+		var rateLimited *slack.RateLimitedError
+		if !errors.As(err, &rateLimited) || attempt >= slackMaxRetries {
+			return err
+		}
+		log.Warnf("Rate limited by Slack, retrying in %s", rateLimited.RetryAfter)
+		time.Sleep(rateLimited.RetryAfter)
+	}
+}
+
+// postSlackMessages posts a digest to each destination and replies with each failure in its thread.
+// The timestamps of the messages are recorded in the issues and returned for the summary.
+func (j junit2jira) postSlackMessages(issues []*testIssue) ([]slackPost, error) {
+	if j.slackDelivery == "" || j.slackDelivery == slackDeliveryNone || len(issues) == 0 {
+		return nil, nil
+	}
+	if j.dryRun {
+		log.Infof("Dry run: would post %d failures to Slack", len(issues))
+		return nil, nil
+	}
+	poster, err := newSlackPoster(j.params)
+	if err != nil {
+		return nil, err
+	}
+
+	var posts []slackPost
+	for _, d := range routeSlack(j.slackRoutes, issues) {
+		t, err := poster.target(d, j.slackChannel)
+		if err != nil {
+			return nil, err
+		}
+		if t.channel == "" && t.webhook == "" {
+			log.Warnf("Not posting %d failures to Slack: no rule routes them to a channel and -slack-channel is not set", len(d.issues))
+			continue
+		}
+		post, err := j.postSlackDestination(poster, t, d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not post to Slack %s", t)
+		}
+		log.Infof("Posted %d failures to Slack %s", len(d.issues), t)
+		if post != nil {
+			posts = append(posts, *post)
+		}
+	}
+	return posts, nil
+}
+
+func (j junit2jira) postSlackDestination(poster *slackPoster, t slackTarget, d *slackDestination) (*slackPost, error) {
+	text := j.slackText(d.issues, d.mentions)
+	if poster.client == nil {
+		// Webhooks cannot reply in threads, so the messages of the JSON output are posted one after another.
+		for n, attachments := range j.convertJunitToSlack(d.mentions, d.issues...) {
+			if n > 0 {
+				text = ""
+			}
+			if _, err := poster.post(t, text, nil, attachments, ""); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	// The digest is the header of the thread, parts that do not fit are the first replies.
+	ts := ""
+	for _, blocks := range splitBySize(j.slackDigest(d.issues, d.mentions), slackMaxMessageSize, slackMaxBlocks) {
+		posted, err := poster.post(t, text, blocks, nil, ts)
+		if err != nil {
+			return nil, err
+		}
+		if ts == "" {
+			ts = posted
+		}
+	}
+
+	for _, i := range d.issues {
+		replyText, replyAttachments := j.slackReply(i)
+		var err error
+		i.slackTs, err = poster.post(t, replyText, nil, replyAttachments, ts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not reply with %s", i.testCase.Name)
+		}
+	}
+	return &slackPost{Channel: t.channel, Ts: ts}, nil
+}
+
+// slackChatDigest is the digest of failures posted to one destination.
+func (j junit2jira) slackChatDigest(issues []*testIssue) chatDigest {
+	d := j.chatDigest(issues)
+	// With routing, the failures of the run are spread over several digests.
+	if len(j.slackRoutes) > 0 {
+		d.failed = len(issues)
+	}
+	return d
+}
+
+// slackText is the plain text of the digest, shown in notifications.
+func (j junit2jira) slackText(issues []*testIssue, mentions []string) string {
+	text := j.slackChatDigest(issues).text()
+	if len(mentions) > 0 {
+		text = strings.Join(mentions, " ") + " " + text
+	}
+	return text
+}
+
+// slackDigest lists failures grouped by suite with their issues, after the totals of the run and the mentions
+// of the teams owning the failures.
+func (j junit2jira) slackDigest(issues []*testIssue, mentions []string) []slack.Block {
+	d := j.slackChatDigest(issues)
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject("plain_text", "Failed tests", false, false)),
+	}
+	if context := d.buildContext(slackEscape, slackLink); context != "" {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", context, false, false)))
+	}
+	if len(mentions) > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", strings.Join(mentions, " "), false, false), nil, nil))
+	}
+	fields := []*slack.TextBlockObject{
+		slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*Failed:*\n%d", d.failed), false, false),
+		slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*New issues:*\n%d", d.newIssues), false, false),
+		slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*Existing issues:*\n%d", d.existingIssues), false, false),
+	}
+	if d.total > 0 {
+		fields = append([]*slack.TextBlockObject{slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*Total:*\n%d", d.total), false, false)}, fields...)
+	}
+	blocks = append(blocks, slack.NewSectionBlock(nil, fields, nil))
+
+	for _, suite := range d.suites {
+		lines := []string{"*" + slackEscape(orDefault(suite.name, "No suite")) + "*"}
+		for _, f := range suite.failures {
+			lines = append(lines, "• "+f.line(slackEscape, slackLink))
+		}
+		for _, text := range joinLines(lines, slackTextLengthLimit) {
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil))
+		}
+	}
+
+	if d.more > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", d.moreText(slackLink), false, false), nil, nil))
+	}
+	return blocks
+}
+
+func slackLink(url, text string) string {
+	return fmt.Sprintf("<%s|%s>", url, text)
+}
+
+// splitSlackAttachments distributes attachments over messages so that each stays within the limits of Slack.
+func splitSlackAttachments(attachments []slack.Attachment) [][]slack.Attachment {
+	var messages [][]slack.Attachment
+	var current []slack.Attachment
+	blocks, size := 0, 0
+	for _, a := range attachments {
+		n := jsonSize(a)
+		if len(current) > 0 && (blocks+len(a.Blocks.BlockSet) > slackMaxBlocks || size+n > slackMaxMessageSize) {
+			messages = append(messages, current)
+			current, blocks, size = nil, 0, 0
+		}
+		current = append(current, a)
+		blocks += len(a.Blocks.BlockSet)
+		size += n
+	}
+	if len(current) > 0 {
+		messages = append(messages, current)
+	}
+	return messages
+}
+
+// slackEscape escapes the characters with a meaning in Slack's mrkdwn.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// slackReply is the reply for a failure with a link to its issue.
+func (j junit2jira) slackReply(i *testIssue) (string, []slack.Attachment) {
+	tc := i.testCase
+	title := slackTitle(tc)
+	text := title
+	if i.issue != nil {
+		status := "existing issue"
+		if i.newJIRA {
+			status = "new issue"
+		}
+		text = fmt.Sprintf("<%s|%s> (%s) %s", j.issueURL(i.issue.Key), i.issue.Key, status, title)
+	}
+
+	attachment, err := failureToAttachment(crop(title, slackHeaderTextLengthLimit), tc)
+	if err != nil {
+		log.Debugf("No failure details for %s: %v", tc.Name, err)
+		return text, nil
+	}
+	if j.slackActions && i.issue != nil {
+		attachment.Blocks.BlockSet = append(attachment.Blocks.BlockSet, j.slackActionsBlock(i.issue.Key))
+	}
+	return text, []slack.Attachment{attachment}
+}
+
+func slackTitle(tc j2jTestCase) string {
+	if tc.Suite == "" {
+		return tc.Name
+	}
+	return fmt.Sprintf("%s: %s", tc.Suite, tc.Name)
+}
+
+func (j junit2jira) issueURL(key string) string {
+	if j.jiraUrl == nil {
+		return key
+	}
+	return j.jiraUrl.JoinPath("browse", key).String()
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
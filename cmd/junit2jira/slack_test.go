@@ -4,11 +4,19 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
 	"github.com/joshdk/go-junit"
+	"github.com/slack-go/slack"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -33,7 +41,9 @@ func TestConstructSlackMessage(t *testing.T) {
 
 	assert.Len(t, samples, len(expectations), "There are different amounts of samples and expected files. This a problem with the test rather than the code")
 
-	j := junit2jira{}
+	jiraUrl, err := url.Parse("https://issues.redhat.com/")
+	require.NoError(t, err)
+	j := junit2jira{params: params{jiraUrl: jiraUrl}}
 
 	for i, sample := range samples {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
@@ -56,11 +66,246 @@ func TestConstructSlackMessage(t *testing.T) {
 				Key:  "FOO-1",
 			}
 
-			blocks := convertJunitToSlack(issues...)
-			b, err := json.MarshalIndent(blocks, "", "  ")
+			messages := j.convertJunitToSlack(nil, issues...)
+			require.Len(t, messages, 1)
+			b, err := json.MarshalIndent(messages[0], "", "  ")
 			assert.NoError(t, err)
 			assert.JSONEq(t, string(expectations[i]), string(b))
 		})
 
 	}
 }
+
+func TestPostSlackMessages(t *testing.T) {
+	issues := func() []*testIssue {
+		return []*testIssue{
+			{issue: &models.IssueScheme{Key: "ROX-1"}, newJIRA: true, testCase: j2jTestCase{Suite: "suite", Name: "TestA", Message: "boom"}},
+			{testCase: j2jTestCase{Suite: "suite", Name: "TestB", Error: "bang"}},
+		}
+	}
+	jiraUrl, err := url.Parse("https://jira.example.com/")
+	require.NoError(t, err)
+
+	t.Run("bot", func(t *testing.T) {
+		var posts []url.Values
+		rateLimited := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/chat.postMessage", r.URL.Path)
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "xoxb-token", r.PostForm.Get("token"))
+			if !rateLimited {
+				rateLimited = true
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			posts = append(posts, r.PostForm)
+			_, _ = fmt.Fprintf(w, `{"ok":true,"channel":"C1","ts":"1700000000.00000%d"}`, len(posts))
+		}))
+		defer server.Close()
+		defer func(u string) { slackAPIURL = u }(slackAPIURL)
+		slackAPIURL = server.URL + "/"
+		t.Setenv(slackBotTokenEnv, "xoxb-token")
+
+		j := junit2jira{params: params{slackDelivery: slackDeliveryBot, slackChannel: "C1", JobName: "nightly", jiraUrl: jiraUrl}}
+		reported := issues()
+		posted, err := j.postSlackMessages(reported)
+		require.NoError(t, err)
+
+		assert.Equal(t, []slackPost{{Channel: "C1", Ts: "1700000000.000001"}}, posted)
+		require.Len(t, posts, 3)
+		assert.Equal(t, "nightly: 2 failed tests, 1 new issues", posts[0].Get("text"))
+		assert.Empty(t, posts[0].Get("thread_ts"))
+		assert.Equal(t, "<https://jira.example.com/browse/ROX-1|ROX-1> (new issue) suite: TestA", posts[1].Get("text"))
+		assert.Equal(t, "1700000000.000001", posts[1].Get("thread_ts"))
+		assert.Equal(t, "suite: TestB", posts[2].Get("text"))
+		assert.Equal(t, "1700000000.000001", posts[2].Get("thread_ts"))
+		assert.Equal(t, "1700000000.000002", reported[0].slackTs)
+		assert.Equal(t, "1700000000.000003", reported[1].slackTs)
+	})
+	t.Run("webhook", func(t *testing.T) {
+		var messages []slack.WebhookMessage
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var msg slack.WebhookMessage
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+			messages = append(messages, msg)
+		}))
+		defer server.Close()
+		t.Setenv(slackWebhookEnv, server.URL)
+
+		j := junit2jira{params: params{slackDelivery: slackDeliveryWebhook, jiraUrl: jiraUrl}}
+		posted, err := j.postSlackMessages(issues())
+		require.NoError(t, err)
+
+		assert.Empty(t, posted)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "2 failed tests, 1 new issues", messages[0].Text)
+		assert.Len(t, messages[0].Attachments, 3)
+	})
+	t.Run("missing token", func(t *testing.T) {
+		t.Setenv(slackBotTokenEnv, "")
+		j := junit2jira{params: params{slackDelivery: slackDeliveryBot, slackChannel: "C1"}}
+		_, err := j.postSlackMessages(issues())
+		assert.ErrorContains(t, err, "SLACK_BOT_TOKEN is required")
+	})
+}
+
+func TestValidateSlackParams(t *testing.T) {
+	assert.NoError(t, validateSlackParams(params{slackDelivery: slackDeliveryNone}))
+	assert.ErrorContains(t, validateSlackParams(params{slackDelivery: slackDeliveryBot}), "-slack-channel is required")
+	assert.ErrorContains(t, validateSlackParams(params{slackDelivery: "email"}), `unknown Slack delivery "email"`)
+}
+
+func TestSlackDigest(t *testing.T) {
+	defer func(l int) { digestLimit = l }(digestLimit)
+	digestLimit = 3
+
+	issues := []*testIssue{
+		{issue: &models.IssueScheme{Key: "ROX-1"}, newJIRA: true, testCase: j2jTestCase{Suite: "a", Name: "TestA"}},
+		{issue: &models.IssueScheme{Key: "ROX-2"}, testCase: j2jTestCase{Suite: "b", Name: "TestB"}},
+		{testCase: j2jTestCase{Suite: "a", Name: "Test<C>"}},
+		{testCase: j2jTestCase{Suite: "b", Name: "TestD"}},
+	}
+	jiraUrl, err := url.Parse("https://jira.example.com/")
+	require.NoError(t, err)
+	j := junit2jira{
+		params: params{jiraUrl: jiraUrl, JobName: "nightly", BuildId: "42", BuildLink: "https://ci/42", htmlReportLink: "https://ci/42/report.html"},
+		stats:  runStats{Total: 120, Failed: 4},
+	}
+
+	var texts []string
+	for _, b := range j.slackDigest(issues, nil) {
+		switch b := b.(type) {
+		case *slack.ContextBlock:
+			texts = append(texts, b.ContextElements.Elements[0].(*slack.TextBlockObject).Text)
+		case *slack.SectionBlock:
+			if b.Text != nil {
+				texts = append(texts, b.Text.Text)
+			}
+			for _, f := range b.Fields {
+				texts = append(texts, f.Text)
+			}
+		}
+	}
+	assert.Equal(t, []string{
+		"nightly · <https://ci/42|42>",
+		"*Total:*\n120", "*Failed:*\n4", "*New issues:*\n1", "*Existing issues:*\n1",
+		"*a*\n• <https://jira.example.com/browse/ROX-1|ROX-1> TestA (new)\n• Test&lt;C&gt;",
+		"*b*\n• <https://jira.example.com/browse/ROX-2|ROX-2> TestB (existing)",
+		"…and 1 more failures, see the <https://ci/42/report.html|HTML report>.",
+	}, texts)
+}
+
+func TestConvertJunitToSlackSplits(t *testing.T) {
+	defer func(l int) { digestDetailsLimit = l }(digestDetailsLimit)
+	digestDetailsLimit = 100
+
+	var issues []*testIssue
+	for i := 0; i < 80; i++ {
+		issues = append(issues, &testIssue{testCase: j2jTestCase{Suite: fmt.Sprintf("suite%d", i), Name: "TestA", Message: strings.Repeat("x", 2000), Error: "error"}})
+	}
+	messages := junit2jira{}.convertJunitToSlack(nil, issues...)
+	require.Greater(t, len(messages), 1)
+
+	details := 0
+	for _, m := range messages {
+		blocks := 0
+		for _, a := range m {
+			blocks += len(a.Blocks.BlockSet)
+			if h, ok := a.Blocks.BlockSet[0].(*slack.HeaderBlock); ok && h.Text.Text != "Failed tests" {
+				details++
+			}
+		}
+		assert.LessOrEqual(t, blocks, slackMaxBlocks)
+		assert.LessOrEqual(t, jsonSize(m), slackMaxMessageSize)
+	}
+	assert.Equal(t, 80, details)
+}
+
+func TestCreateSlackMessageFiles(t *testing.T) {
+	defer func(l int) { digestLimit = l }(digestLimit)
+	digestLimit = 200
+
+	var issues []*testIssue
+	for i := 0; i < 60; i++ {
+		issues = append(issues, &testIssue{testCase: j2jTestCase{Suite: fmt.Sprintf("suite%d", i), Name: "TestA", Message: "boom"}})
+	}
+	output := filepath.Join(t.TempDir(), "slack.json")
+	require.NoError(t, junit2jira{params: params{slackOutput: output}}.createSlackMessage(issues))
+
+	for _, name := range []string{output, strings.TrimSuffix(output, ".json") + "-2.json"} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		var attachments []slack.Attachment
+		require.NoError(t, json.Unmarshal(data, &attachments))
+		assert.NotEmpty(t, attachments)
+	}
+}
+
+func TestCountTests(t *testing.T) {
+	suites := []junit.Suite{{
+		Tests: []junit.Test{{Status: junit.StatusPassed}, {Status: junit.StatusFailed}},
+		Suites: []junit.Suite{{
+			Tests: []junit.Test{{Status: junit.StatusError}, {Status: junit.StatusSkipped}},
+		}},
+	}}
+	assert.Equal(t, runStats{Total: 4, Failed: 2}, countTests(suites))
+}
+
+func TestPostSlackMessagesRouted(t *testing.T) {
+	channels := map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		channel := r.PostForm.Get("channel")
+		channels[channel] = append(channels[channel], r.PostForm.Get("text"))
+		_, _ = fmt.Fprintf(w, `{"ok":true,"channel":%q,"ts":"1.%d"}`, channel, len(channels[channel]))
+	}))
+	defer server.Close()
+	defer func(u string) { slackAPIURL = u }(slackAPIURL)
+	slackAPIURL = server.URL + "/"
+	t.Setenv(slackBotTokenEnv, "xoxb-token")
+
+	routes, err := loadSlackRoutingFile("testdata/routing/routing.yml")
+	require.NoError(t, err)
+	issues := []*testIssue{
+		{testCase: j2jTestCase{Suite: "github.com/stackrox/rox/scanner/api", Name: "TestA", Message: "boom"}},
+		{testCase: j2jTestCase{Suite: "github.com/stackrox/rox/central", Name: "TestB", Message: "bang"}},
+	}
+
+	j := junit2jira{params: params{slackDelivery: slackDeliveryBot, slackChannel: "#ci"}, slackRoutes: routes}
+	posted, err := j.postSlackMessages(issues)
+	require.NoError(t, err)
+
+	assert.Equal(t, []slackPost{{Channel: "#ci", Ts: "1.1"}, {Channel: "#scanner-ci", Ts: "1.1"}}, posted)
+	assert.Equal(t, []string{"1 failed tests, 0 new issues", "github.com/stackrox/rox/central: TestB"}, channels["#ci"])
+	assert.Equal(t, []string{"<!subteam^S0SCANNER> 1 failed tests, 0 new issues", "github.com/stackrox/rox/scanner/api: TestA"}, channels["#scanner-ci"])
+
+	t.Run("without default channel", func(t *testing.T) {
+		channels = map[string][]string{}
+		j.slackChannel = ""
+		posted, err := j.postSlackMessages(issues)
+		require.NoError(t, err)
+		assert.Equal(t, []slackPost{{Channel: "#scanner-ci", Ts: "1.1"}}, posted)
+	})
+}
+
+func TestCreateSlackMessageRouted(t *testing.T) {
+	routes, err := loadSlackRoutingFile("testdata/routing/routing.yml")
+	require.NoError(t, err)
+	issues := []*testIssue{
+		{testCase: j2jTestCase{Suite: "github.com/stackrox/rox/scanner/api", Name: "TestA", Message: "boom"}},
+		{testCase: j2jTestCase{Suite: "github.com/stackrox/rox/central", Name: "TestB", Message: "bang"}},
+	}
+	dir := t.TempDir()
+	j := junit2jira{params: params{slackOutput: filepath.Join(dir, "slack.json")}, slackRoutes: routes}
+	require.NoError(t, j.createSlackMessage(issues))
+
+	for _, name := range []string{"slack.json", "slack-scanner-ci.json"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		var attachments []slack.Attachment
+		require.NoError(t, json.Unmarshal(data, &attachments))
+		assert.Len(t, attachments, 2, name)
+	}
+	assert.Equal(t, "out-scanner-ci-2.json", messageOutputName("out.json", "scanner-ci", 1))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// spockFeatureRegex matches Spock feature methods, e.g. def "Verify #policy is triggered"() {
+var spockFeatureRegex = regexp.MustCompile(`^\s*def\s+(?:"([^"]+)"|'([^']+)')\s*\(`)
+
+// spockPlaceholderRegex matches data variables in unrolled Spock feature names, e.g. #policy or #data.name
+var spockPlaceholderRegex = regexp.MustCompile(`#[\w.]+`)
+
+// sourceLocator finds test definitions in a local checkout.
+type sourceLocator struct {
+	dir    string
+	module string
+	// files maps file names to their paths in the checkout, it is filled on first use.
+	files map[string][]string
+}
+
+func newSourceLocator(dir string) *sourceLocator {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return &sourceLocator{dir: dir, module: goModulePath(dir)}
+}
+
+// addSourceLinks adds a link to the definition of each failed test, either from the location in the report
+// or found in the local checkout.
+func (j junit2jira) addSourceLinks(tests []j2jTestCase) []j2jTestCase {
+	if j.BaseLink == "" {
+		return tests
+	}
+	for i, tc := range tests {
+		path, line := j.sourceLocation(tc)
+		if path == "" {
+			log.Debugf("Could not locate source of %s / %s", tc.Suite, tc.Name)
+			continue
+		}
+		tests[i].SourceLink = sourceLink(j.BaseLink, path, line)
+	}
+	return tests
+}
+
+// sourceLocation returns the path relative to the checkout and the line of the definition of a test, either from
+// the location in the report or found in the local checkout. The path is empty if it is not known.
+func (j junit2jira) sourceLocation(tc j2jTestCase) (string, int) {
+	locator := j.locator
+	path, line := tc.File, tc.Line
+	if path != "" && locator != nil {
+		path = locator.relative(path)
+		if line == 0 {
+			line = locator.findInFile(path, tc.Name)
+		}
+	}
+	if path == "" && locator != nil {
+		path, line = locator.locate(tc.Suite, tc.Name)
+	}
+	if path == "" || filepath.IsAbs(path) {
+		return "", 0
+	}
+	return path, line
+}
+
+func sourceLink(baseLink, path string, line int) string {
+	link := strings.TrimSuffix(baseLink, "/") + "/" + filepath.ToSlash(path)
+	if line > 0 {
+		link += fmt.Sprintf("#L%d", line)
+	}
+	return link
+}
+
+// relative returns the path relative to the checkout, reporters often use absolute paths of the build machine.
+func (l *sourceLocator) relative(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	if rel, err := filepath.Rel(l.dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// existing returns the path relative to the checkout of a file reported from another checkout of the same
+// repository, e.g. on the build machine. The longest suffix of the path that exists in the checkout is used.
+func (l *sourceLocator) existing(file string) string {
+	if rel := l.relative(file); !filepath.IsAbs(rel) {
+		return rel
+	}
+	parts := strings.Split(filepath.ToSlash(file), "/")
+	for i := 1; i < len(parts)-1; i++ {
+		rel := strings.Join(parts[i:], "/")
+		if _, err := os.Stat(filepath.Join(l.dir, rel)); err == nil {
+			return rel
+		}
+	}
+	return ""
+}
+
+// locate returns the file and line of a Go test or a Spock feature.
+func (l *sourceLocator) locate(suite, name string) (string, int) {
+	if dir := goPackageDir(l.module, suite); dir != "" {
+		return l.locateGoTest(dir, name)
+	}
+	return l.locateSpockFeature(suite, name)
+}
+
+func (l *sourceLocator) locateGoTest(dir, name string) (string, int) {
+	files, err := filepath.Glob(filepath.Join(l.dir, dir, "*_test.go"))
+	if err != nil {
+		return "", 0
+	}
+	for _, file := range files {
+		if line := l.findInFile(l.relative(file), name); line > 0 {
+			return l.relative(file), line
+		}
+	}
+	return "", 0
+}
+
+func (l *sourceLocator) locateSpockFeature(suite, name string) (string, int) {
+	// Classnames may be fully qualified.
+	class := suite[strings.LastIndex(suite, ".")+1:]
+	file := l.find(class + ".groovy")
+	if file == "" {
+		return "", 0
+	}
+	return file, l.findInFile(file, name)
+}
+
+// find returns the path relative to the checkout of a file ending with suffix, e.g. a file name or
+// a path derived from a Java package.
+func (l *sourceLocator) find(suffix string) string {
+	if l.files == nil {
+		l.files = map[string][]string{}
+		_ = filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && (d.Name() == ".git" || d.Name() == "vendor" || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() {
+				l.files[d.Name()] = append(l.files[d.Name()], l.relative(path))
+			}
+			return nil
+		})
+	}
+	for _, path := range l.files[filepath.Base(suffix)] {
+		if path == suffix || strings.HasSuffix(path, "/"+suffix) {
+			return path
+		}
+	}
+	return ""
+}
+
+// findInFile returns the line of the test definition in a file relative to the checkout.
+func (l *sourceLocator) findInFile(path, name string) int {
+	file := filepath.Join(l.dir, path)
+	if strings.HasSuffix(path, ".go") {
+		// Subtests are defined inside the top level test.
+		name, _, _ = strings.Cut(name, "/")
+		definition := regexp.MustCompile(`^func\s+` + regexp.QuoteMeta(name) + `\s*\(`)
+		return findLine(file, definition.MatchString)
+	}
+	return findLine(file, func(line string) bool {
+		return spockFeatureMatches(line, name)
+	})
+}
+
+// spockFeatureMatches checks if the line defines the feature. Names of unrolled features have their
+// placeholders replaced with data, so placeholders match anything.
+func spockFeatureMatches(line, name string) bool {
+	m := spockFeatureRegex.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	feature := m[1] + m[2]
+	if feature == name {
+		return true
+	}
+	if !strings.Contains(feature, "#") {
+		return false
+	}
+	parts := spockPlaceholderRegex.Split(feature, -1)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	r, err := regexp.Compile("^" + strings.Join(parts, ".*") + "$")
+	return err == nil && r.MatchString(name)
+}
+
+// findLine returns the first line number for which match is true, or 0.
+func findLine(file string, match func(string) bool) int {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close() //nolint:errcheck
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if match(scanner.Text()) {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddSourceLinks(t *testing.T) {
+	dir := t.TempDir()
+	for file, content := range map[string]string{
+		"go.mod":                      "module github.com/stackrox/rox\n",
+		"pkg/grpc/server_test.go":     "package grpc\n\nimport \"testing\"\n\nfunc TestServer(t *testing.T) {\n}\n",
+		"pkg/grpc/api_test.go":        "package grpc\n\nfunc Test_APIServerSuite(t *testing.T) {\n}\n",
+		"qa/groovy/PolicyTest.groovy": "class PolicyTest extends Specification {\n  def \"Verify policy #policyName is triggered\"() {\n  }\n  def 'simple feature'() {\n  }\n}\n",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(content), 0644))
+	}
+
+	j := junit2jira{params: params{BaseLink: "https://github.com/stackrox/stackrox/blob/abc/"}, locator: newSourceLocator(dir)}
+	tests := j.addSourceLinks([]j2jTestCase{
+		{Suite: "github.com/stackrox/rox/pkg/grpc", Name: "TestServer"},
+		{Suite: "github.com/stackrox/rox/pkg/grpc", Name: "Test_APIServerSuite/Test_TwoTestsStartingAPIs"},
+		{Suite: "PolicyTest", Name: "Verify policy Apache Struts: CVE-2017-5638 is triggered"},
+		{Suite: "com.example.PolicyTest", Name: "simple feature"},
+		{Suite: "PolicyTest", Name: "unknown", File: filepath.Join(dir, "qa/groovy/PolicyTest.groovy"), Line: 7},
+		{Suite: "Other", Name: "reported", File: "/build/elsewhere/Other.java", Line: 3},
+		{Suite: "github.com/stackrox/rox/pkg/grpc", Name: "TestMissing"},
+	})
+
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/pkg/grpc/server_test.go#L5", tests[0].SourceLink)
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/pkg/grpc/api_test.go#L3", tests[1].SourceLink)
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/qa/groovy/PolicyTest.groovy#L2", tests[2].SourceLink)
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/qa/groovy/PolicyTest.groovy#L4", tests[3].SourceLink)
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/qa/groovy/PolicyTest.groovy#L7", tests[4].SourceLink)
+	assert.Empty(t, tests[5].SourceLink)
+	assert.Empty(t, tests[6].SourceLink)
+
+	attachment, err := failureToAttachment("title", j2jTestCase{Name: "TestServer", Message: "failed", SourceLink: tests[0].SourceLink})
+	require.NoError(t, err)
+	assert.Len(t, attachment.Blocks.BlockSet, 4)
+
+	// Without a checkout only locations from the report are used.
+	j.locator = nil
+	tests = j.addSourceLinks([]j2jTestCase{
+		{Suite: "Other", Name: "reported", File: "src/Other.java", Line: 3},
+		{Suite: "github.com/stackrox/rox/pkg/grpc", Name: "TestServer"},
+	})
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/src/Other.java#L3", tests[0].SourceLink)
+	assert.Empty(t, tests[1].SourceLink)
+}
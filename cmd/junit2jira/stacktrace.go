@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+)
+
+// maxStackFrames limits the frames kept per test, goroutine dumps of Go panics can be huge.
+const maxStackFrames = 100
+
+var (
+	// goFileLineRegex matches the location following a function in Go panics, e.g. "\t/src/server.go:12 +0x1d"
+	goFileLineRegex = regexp.MustCompile(`^\t(\S+\.go):(\d+)(?: \+0x[0-9a-f]+)?\s*$`)
+	// testifyTraceRegex matches the first location of a testify failure, the following ones are on separate lines.
+	testifyTraceRegex        = regexp.MustCompile(`^\s*Error Trace:\s+(\S+\.go):(\d+)\s*$`)
+	testifyContinuationRegex = regexp.MustCompile(`^\s+(\S+\.go):(\d+)\s*$`)
+	// javaFrameRegex matches Java and Groovy frames, e.g. "\tat com.example.Spec.test(Spec.groovy:12)"
+	javaFrameRegex      = regexp.MustCompile(`^\s*at ([\w$.<>/]+)\((?:([^:()]+):(\d+)|[^()]*)\)\s*$`)
+	goroutineRegex      = regexp.MustCompile(` in goroutine \d+$`)
+	javaLibraryPrefixes = []string{
+		"java.", "javax.", "jdk.", "sun.", "com.sun.", "kotlin.",
+		"groovy.", "org.codehaus.groovy.", "org.spockframework.",
+		"org.junit.", "junit.", "org.gradle.", "worker.org.gradle.",
+	}
+)
+
+// frame is a single entry of a stack trace.
+type frame struct {
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	// Project is set for frames of the tested code. Other frames are from the runtime or dependencies.
+	Project bool   `json:"project"`
+	Link    string `json:"link,omitempty"`
+}
+
+func (f frame) location() string {
+	if f.File == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", path.Base(f.File), f.Line)
+}
+
+func (f frame) String() string {
+	switch {
+	case f.Function == "":
+		return f.location()
+	case f.File == "":
+		return f.Function
+	default:
+		return fmt.Sprintf("%s (%s)", f.Function, f.location())
+	}
+}
+
+// parseStackTrace returns frames of Go panics, testify failures and Java or Groovy exceptions found in text.
+func parseStackTrace(text string) []frame {
+	var frames []frame
+	lines := strings.Split(text, "\n")
+	inTestify := false
+	for i, line := range lines {
+		if len(frames) >= maxStackFrames {
+			break
+		}
+		if m := testifyTraceRegex.FindStringSubmatch(line); m != nil {
+			frames = append(frames, newFrame("", m[1], m[2]))
+			inTestify = true
+			continue
+		}
+		if inTestify {
+			if m := testifyContinuationRegex.FindStringSubmatch(line); m != nil {
+				frames = append(frames, newFrame("", m[1], m[2]))
+				continue
+			}
+			inTestify = false
+		}
+		if m := goFileLineRegex.FindStringSubmatch(line); m != nil && i > 0 {
+			frames = append(frames, newFrame(goFunction(lines[i-1]), m[1], m[2]))
+			continue
+		}
+		if m := javaFrameRegex.FindStringSubmatch(line); m != nil {
+			frames = append(frames, newFrame(m[1], m[2], m[3]))
+		}
+	}
+	return frames
+}
+
+func newFrame(function, file, line string) frame {
+	n, _ := strconv.Atoi(line)
+	return frame{Function: function, File: file, Line: n}
+}
+
+// goFunction returns the function name from a line of a Go panic, e.g. "pkg.(*T).Run(0xc0001, {0x2})"
+func goFunction(line string) string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "created by ")
+	line = goroutineRegex.ReplaceAllString(line, "")
+	if strings.HasSuffix(line, ")") {
+		if i := strings.LastIndex(line, "("); i > 0 {
+			line = line[:i]
+		}
+	}
+	return line
+}
+
+// goPackage returns the import path of the package of a Go function, e.g. "github.com/a/b" for "github.com/a/b.(*T).Run"
+func goPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return function
+	}
+	return function[:slash+1+dot]
+}
+
+// addStackTraces parses the stack trace of each failed test, marks and links project frames and
+// sets the first project frame as the top frame.
+func (j junit2jira) addStackTraces(tests []j2jTestCase) []j2jTestCase {
+	for i, tc := range tests {
+		var frames []frame
+		for _, text := range []string{tc.Error, tc.Message, tc.Stderr, tc.Stdout} {
+			if frames = parseStackTrace(text); len(frames) > 0 {
+				break
+			}
+		}
+		for k := range frames {
+			j.classifyFrame(&frames[k])
+			if frames[k].Project && tests[i].TopFrame == "" {
+				tests[i].TopFrame = frames[k].String()
+			}
+		}
+		tests[i].StackTrace = frames
+	}
+	return tests
+}
+
+// classifyFrame marks frames of the tested code as project frames and links them to -base-link. With -git-dir
+// a frame is from the project only if its file is found in the checkout, otherwise only if its package matches
+// -project-package.
+func (j junit2jira) classifyFrame(f *frame) {
+	var relative string
+	if strings.HasSuffix(f.File, ".go") {
+		if strings.Contains(f.File, "/vendor/") || strings.Contains(f.File, "/pkg/mod/") {
+			return
+		}
+		pkg := ""
+		if f.Function != "" {
+			pkg = goPackage(f.Function)
+			first, _, _ := strings.Cut(pkg, "/")
+			// Packages of the standard library have no domain.
+			if !strings.Contains(first, ".") || strings.HasPrefix(pkg, "github.com/stretchr/testify") {
+				return
+			}
+		}
+		if j.locator == nil {
+			if pkg == "" {
+				// Testify only lists the callers of the assertion, mostly test code.
+				f.Project = !strings.Contains(f.File, "/src/testing/") && !strings.Contains(f.File, "/src/runtime/")
+			} else {
+				f.Project = j.isProjectPackage(pkg)
+			}
+			return
+		}
+		module := j.locator.module
+		if dir := goPackageDir(module, pkg); dir != "" {
+			relative = path.Join(dir, path.Base(f.File))
+		} else if pkg != "" && module != "" {
+			// A package outside of the module of the checkout is a dependency.
+			return
+		} else if _, after, ok := strings.Cut(f.File, "/"+module+"/"); ok && module != "" {
+			relative = after
+		} else {
+			relative = j.locator.existing(f.File)
+		}
+		f.Project = relative != ""
+	} else {
+		for _, prefix := range javaLibraryPrefixes {
+			if strings.HasPrefix(f.Function, prefix) {
+				return
+			}
+		}
+		if f.File == "" {
+			return
+		}
+		if j.locator == nil {
+			f.Project = j.isProjectPackage(f.Function)
+			return
+		}
+		class := f.Function[:max(strings.LastIndex(f.Function, "."), 0)]
+		if pkg := class[:max(strings.LastIndex(class, "."), 0)]; pkg != "" {
+			relative = j.locator.find(strings.ReplaceAll(pkg, ".", "/") + "/" + f.File)
+		} else {
+			// Classes of the default package, as common for Spock specifications.
+			relative = j.locator.find(f.File)
+		}
+		f.Project = relative != ""
+	}
+
+	if relative != "" && j.BaseLink != "" {
+		f.Link = sourceLink(j.BaseLink, relative, f.Line)
+	}
+}
+
+// isProjectPackage tells whether a Go package or a Java function is inside one of the -project-package prefixes.
+func (j junit2jira) isProjectPackage(name string) bool {
+	for _, prefix := range j.projectPackages {
+		prefix = strings.TrimRight(prefix, "./")
+		if name == prefix || strings.HasPrefix(name, prefix+"/") || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// stackTraceADF renders project frames as a list and collapses runs of other frames.
+func stackTraceADF(frames []frame) []*models.CommentNodeScheme {
+	content := []*models.CommentNodeScheme{{
+		Type: "heading",
+		Attrs: map[string]any{
+			"level": 3,
+		},
+		Content: []*models.CommentNodeScheme{
+			{Type: "text", Text: "Stack Trace"},
+		},
+	}}
+
+	for start := 0; start < len(frames); {
+		end := start
+		for end < len(frames) && frames[end].Project == frames[start].Project {
+			end++
+		}
+		group := frames[start:end]
+		start = end
+
+		if !group[0].Project {
+			lines := make([]string, 0, len(group))
+			for _, f := range group {
+				lines = append(lines, f.String())
+			}
+			content = append(content, &models.CommentNodeScheme{
+				Type: "expand",
+				Attrs: map[string]any{
+					"title": fmt.Sprintf("%d runtime and dependency frames", len(group)),
+				},
+				Content: []*models.CommentNodeScheme{{
+					Type: "codeBlock",
+					Attrs: map[string]any{
+						"language": "text",
+					},
+					Content: []*models.CommentNodeScheme{
+						{Type: "text", Text: strings.Join(lines, "\n")},
+					},
+				}},
+			})
+			continue
+		}
+
+		items := make([]*models.CommentNodeScheme, 0, len(group))
+		for _, f := range group {
+			paragraph := []*models.CommentNodeScheme{}
+			if f.Function != "" {
+				paragraph = append(paragraph,
+					&models.CommentNodeScheme{Type: "text", Text: f.Function, Marks: []*models.MarkScheme{{Type: "code"}}},
+					&models.CommentNodeScheme{Type: "text", Text: " "},
+				)
+			}
+			location := &models.CommentNodeScheme{Type: "text", Text: f.location()}
+			if f.Link != "" {
+				location.Marks = []*models.MarkScheme{{
+					Type: "link",
+					Attrs: map[string]any{
+						"href": f.Link,
+					},
+				}}
+			}
+			paragraph = append(paragraph, location)
+			items = append(items, &models.CommentNodeScheme{
+				Type: "listItem",
+				Content: []*models.CommentNodeScheme{
+					{Type: "paragraph", Content: paragraph},
+				},
+			})
+		}
+		content = append(content, &models.CommentNodeScheme{
+			Type:    "bulletList",
+			Content: items,
+		})
+	}
+	return content
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const goPanic = `panic: runtime error: invalid memory address or nil pointer dereference [recovered]
+	panic: runtime error: invalid memory address or nil pointer dereference
+[signal SIGSEGV: segmentation violation code=0x1 addr=0x0 pc=0x1234]
+
+goroutine 7 [running]:
+testing.tRunner.func1.2({0x1a2b3c0, 0x2d4e5f0})
+	/usr/local/go/src/testing/testing.go:1545 +0x238
+panic({0x1a2b3c0?, 0x2d4e5f0?})
+	/usr/local/go/src/runtime/panic.go:914 +0x21f
+github.com/stackrox/rox/pkg/grpc.(*apiImpl).Start(0x0)
+	/go/src/github.com/stackrox/rox/pkg/grpc/api.go:120 +0x1d
+github.com/stackrox/rox/vendor/google.golang.org/grpc.(*Server).Serve(0xc000)
+	/go/src/github.com/stackrox/rox/vendor/google.golang.org/grpc/server.go:885 +0x42
+github.com/stackrox/rox/pkg/grpc.TestServer(0xc000123)
+	/go/src/github.com/stackrox/rox/pkg/grpc/api_test.go:42 +0x55
+created by testing.(*T).Run in goroutine 1
+	/usr/local/go/src/testing/testing.go:1648 +0x3ad
+`
+
+const testifyFailure = `    server_test.go:42: 
+        	Error Trace:	/home/runner/work/stackrox/stackrox/pkg/grpc/server_test.go:42
+        	            				/home/runner/work/stackrox/stackrox/pkg/grpc/suite_test.go:12
+        	Error:      	Should be true
+        	Test:       	TestServer
+`
+
+const groovyException = `org.spockframework.runtime.ConditionNotSatisfiedError: Condition not satisfied:
+	at org.spockframework.runtime.SpockRuntime.verifyCondition(SpockRuntime.java:96)
+	at util.Helpers.waitFor(Helpers.groovy:31)
+	at DefaultPoliciesTest.$spock_feature_0_1(DefaultPoliciesTest.groovy:123)
+	at java.base/jdk.internal.reflect.NativeMethodAccessorImpl.invoke0(Native Method)
+`
+
+func TestParseStackTrace(t *testing.T) {
+	frames := parseStackTrace(goPanic)
+	require.Len(t, frames, 6)
+	assert.Equal(t, frame{Function: "testing.tRunner.func1.2", File: "/usr/local/go/src/testing/testing.go", Line: 1545}, frames[0])
+	assert.Equal(t, "panic", frames[1].Function)
+	assert.Equal(t, "github.com/stackrox/rox/pkg/grpc.(*apiImpl).Start (api.go:120)", frames[2].String())
+	assert.Equal(t, "testing.(*T).Run", frames[5].Function)
+
+	frames = parseStackTrace(testifyFailure)
+	require.Len(t, frames, 2)
+	assert.Equal(t, "server_test.go:42", frames[0].String())
+	assert.Equal(t, "/home/runner/work/stackrox/stackrox/pkg/grpc/suite_test.go", frames[1].File)
+
+	frames = parseStackTrace(groovyException)
+	require.Len(t, frames, 4)
+	assert.Equal(t, frame{Function: "util.Helpers.waitFor", File: "Helpers.groovy", Line: 31}, frames[1])
+	assert.Equal(t, "java.base/jdk.internal.reflect.NativeMethodAccessorImpl.invoke0", frames[3].String())
+
+	assert.Empty(t, parseStackTrace("expected 1, got 2"))
+}
+
+func TestAddStackTraces(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"go.mod", "pkg/grpc/server_test.go", "qa/src/test/groovy/util/Helpers.groovy", "qa/src/test/groovy/DefaultPoliciesTest.groovy"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte("module github.com/stackrox/rox\n"), 0644))
+	}
+	j := junit2jira{params: params{BaseLink: "https://github.com/stackrox/stackrox/blob/abc"}, locator: newSourceLocator(dir)}
+
+	tests := j.addStackTraces([]j2jTestCase{
+		{Message: "Failed", Stdout: goPanic},
+		{Message: testifyFailure},
+		{Error: groovyException},
+		{Message: "no trace"},
+	})
+
+	frames := tests[0].StackTrace
+	assert.Equal(t, []bool{false, false, true, false, true, false}, []bool{frames[0].Project, frames[1].Project, frames[2].Project, frames[3].Project, frames[4].Project, frames[5].Project})
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/pkg/grpc/api.go#L120", frames[2].Link)
+	assert.Equal(t, "github.com/stackrox/rox/pkg/grpc.(*apiImpl).Start (api.go:120)", tests[0].TopFrame)
+
+	assert.Equal(t, "server_test.go:42", tests[1].TopFrame)
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/pkg/grpc/server_test.go#L42", tests[1].StackTrace[0].Link)
+	assert.False(t, tests[1].StackTrace[1].Project)
+
+	frames = tests[2].StackTrace
+	assert.False(t, frames[0].Project)
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/qa/src/test/groovy/util/Helpers.groovy#L31", frames[1].Link)
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/qa/src/test/groovy/DefaultPoliciesTest.groovy#L123", frames[2].Link)
+	assert.Equal(t, "util.Helpers.waitFor (Helpers.groovy:31)", tests[2].TopFrame)
+
+	assert.Empty(t, tests[3].StackTrace)
+	assert.Empty(t, tests[3].TopFrame)
+
+	// Without a checkout, frames outside of the standard library and dependencies are from the project.
+	j.locator = nil
+	tests = j.addStackTraces([]j2jTestCase{{Message: testifyFailure}})
+	assert.True(t, tests[0].StackTrace[0].Project)
+	assert.Empty(t, tests[0].StackTrace[0].Link)
+}
+
+const dependencyPanic = `panic: boom
+
+goroutine 7 [running]:
+google.golang.org/grpc.(*Server).handleStream(0xc000)
+	/home/runner/go/src/google.golang.org/grpc/server.go:1720 +0x42
+github.com/stackrox/rox/pkg/grpc.TestServer(0xc000123)
+	/go/src/github.com/stackrox/rox/pkg/grpc/server_test.go:42 +0x55
+`
+
+const dependencyException = `io.grpc.StatusRuntimeException: UNAVAILABLE: io exception
+	at io.grpc.stub.ClientCalls.toStatusRuntimeException(ClientCalls.java:271)
+	at io.grpc.stub.ClientCalls.blockingUnaryCall(ClientCalls.java:166)
+	at util.Helpers.waitFor(Helpers.groovy:31)
+`
+
+func TestAddStackTracesDependencyAboveProject(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"go.mod", "pkg/grpc/server_test.go", "qa/src/test/groovy/util/Helpers.groovy", "qa/src/test/groovy/ClientCalls.java"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte("module github.com/stackrox/rox\n"), 0644))
+	}
+	j := junit2jira{params: params{BaseLink: "https://github.com/stackrox/stackrox/blob/abc"}, locator: newSourceLocator(dir)}
+
+	tests := j.addStackTraces([]j2jTestCase{{Message: dependencyPanic}, {Error: dependencyException}})
+	assert.False(t, tests[0].StackTrace[0].Project)
+	assert.Empty(t, tests[0].StackTrace[0].Link)
+	assert.Equal(t, "github.com/stackrox/rox/pkg/grpc.TestServer (server_test.go:42)", tests[0].TopFrame)
+	// A file of the checkout with the same name does not make a dependency frame a project frame.
+	assert.False(t, tests[1].StackTrace[1].Project)
+	assert.Equal(t, "util.Helpers.waitFor (Helpers.groovy:31)", tests[1].TopFrame)
+
+	t.Run("project packages", func(t *testing.T) {
+		j := junit2jira{params: params{projectPackages: stringList{"github.com/stackrox/rox", "util."}}}
+		tests := j.addStackTraces([]j2jTestCase{{Message: dependencyPanic}, {Error: dependencyException}})
+		assert.False(t, tests[0].StackTrace[0].Project)
+		assert.Equal(t, "github.com/stackrox/rox/pkg/grpc.TestServer (server_test.go:42)", tests[0].TopFrame)
+		assert.Empty(t, tests[0].StackTrace[1].Link)
+		assert.False(t, tests[1].StackTrace[1].Project)
+		assert.Equal(t, "util.Helpers.waitFor (Helpers.groovy:31)", tests[1].TopFrame)
+	})
+	t.Run("no project packages", func(t *testing.T) {
+		tests := junit2jira{}.addStackTraces([]j2jTestCase{{Message: dependencyPanic}, {Error: dependencyException}})
+		assert.Empty(t, tests[0].TopFrame)
+		assert.Empty(t, tests[1].TopFrame)
+	})
+}
+
+func TestStackTraceADF(t *testing.T) {
+	frames := parseStackTrace(goPanic)
+	j := junit2jira{params: params{BaseLink: "https://github.com/stackrox/stackrox/blob/abc"}, locator: &sourceLocator{module: "github.com/stackrox/rox"}}
+	for i := range frames {
+		j.classifyFrame(&frames[i])
+	}
+	content := stackTraceADF(frames)
+	require.Len(t, content, 6)
+	assert.Equal(t, "Stack Trace", content[0].Content[0].Text)
+	assert.Equal(t, "expand", content[1].Type)
+	assert.Equal(t, "2 runtime and dependency frames", content[1].Attrs["title"])
+	assert.Equal(t, "bulletList", content[2].Type)
+	link := content[2].Content[0].Content[0].Content[2]
+	assert.Equal(t, "api.go:120", link.Text)
+	assert.Equal(t, "https://github.com/stackrox/stackrox/blob/abc/pkg/grpc/api.go#L120", link.Marks[0].Attrs["href"])
+	assert.Equal(t, "expand", content[3].Type)
+	assert.Equal(t, "bulletList", content[4].Type)
+	assert.Equal(t, "1 runtime and dependency frames", content[5].Attrs["title"])
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joshdk/go-junit"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const gitTimeout = time.Minute
+
+// suspectCommits are the commits between the last build where a test passed and the failing build.
+type suspectCommits struct {
+	LastGreen string   `json:"lastGreen"`
+	Path      string   `json:"path,omitempty"`
+	Commits   []commit `json:"commits"`
+	// More is the number of commits in the range that are not listed.
+	More int `json:"more,omitempty"`
+}
+
+type commit struct {
+	Hash    string `json:"hash"`
+	Author  string `json:"author"`
+	Subject string `json:"subject"`
+}
+
+func (c commit) String() string {
+	return fmt.Sprintf("%s %s (%s)", c.Hash, c.Subject, c.Author)
+}
+
+func (s suspectCommits) title(buildTag string) string {
+	title := fmt.Sprintf("%d commits between the last green build %s and %s", len(s.Commits)+s.More, s.LastGreen, buildTag)
+	if s.Path != "" {
+		title += fmt.Sprintf(" touching %s", s.Path)
+	}
+	return title
+}
+
+// greenHistory maps "<suite> / <test>" to the last build tag where the test passed.
+type greenHistory map[string]string
+
+func greenHistoryKey(suite, name string) string {
+	return suite + " / " + name
+}
+
+func loadGreenHistory(path string) (greenHistory, error) {
+	h := greenHistory{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read green history")
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, errors.Wrapf(err, "could not parse green history %s", path)
+	}
+	return h, nil
+}
+
+// recordGreenTests stores the build tag for all passed tests in the green history file. A corrupt file is replaced,
+// so that it does not fail every later run.
+func (j junit2jira) recordGreenTests(testSuites []junit.Suite) error {
+	if j.greenHistoryFile == "" || j.BuildTag == "" {
+		return nil
+	}
+	h, err := loadGreenHistory(j.greenHistoryFile)
+	if err != nil {
+		log.WithError(err).Warn("Could not load green history, starting a new one")
+		h = greenHistory{}
+	}
+	var record func(suites []junit.Suite)
+	record = func(suites []junit.Suite) {
+		for _, s := range suites {
+			record(s.Suites)
+			for _, t := range s.Tests {
+				if t.Status == junit.StatusPassed {
+					h[greenHistoryKey(t.Classname, t.Name)] = j.BuildTag
+				}
+			}
+		}
+	}
+	record(testSuites)
+
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(os.WriteFile(j.greenHistoryFile, data, 0644), "could not write green history")
+}
+
+// addSuspectCommits adds the commits since the last green build to failed tests. Like history, suspect commits
+// are optional, so errors are only logged.
+func (j junit2jira) addSuspectCommits(tests []j2jTestCase) []j2jTestCase {
+	if j.gitDir == "" || j.BuildTag == "" {
+		return tests
+	}
+	h := greenHistory{}
+	if j.greenHistoryFile != "" {
+		var err error
+		h, err = loadGreenHistory(j.greenHistoryFile)
+		if err != nil {
+			log.WithError(err).Warn("Could not load green history, using -last-green-tag for all tests")
+			h = greenHistory{}
+		}
+	}
+	module := ""
+	if j.suspectPackageFilter {
+		module = goModulePath(j.gitDir)
+	}
+
+	cache := map[string]*suspectCommits{}
+	for i, tc := range tests {
+		lastGreen := h[greenHistoryKey(tc.Suite, tc.Name)]
+		if lastGreen == "" {
+			lastGreen = j.lastGreenTag
+		}
+		if lastGreen == "" {
+			log.Debugf("No green build known for %s / %s", tc.Suite, tc.Name)
+			continue
+		}
+		path := goPackageDir(module, tc.Suite)
+
+		key := lastGreen + ":" + path
+		if _, ok := cache[key]; !ok {
+			s, err := j.gitLog(lastGreen, path)
+			if err != nil {
+				log.WithError(err).Warnf("Could not get commits since %s", lastGreen)
+			}
+			cache[key] = s
+		}
+		tests[i].SuspectCommits = cache[key]
+	}
+	return tests
+}
+
+// gitLog lists the commits in lastGreen..BuildTag, optionally only those touching path. Both revisions come from
+// flags or the green history file, so they are passed after --end-of-options to never be taken as options.
+func (j junit2jira) gitLog(lastGreen, path string) (*suspectCommits, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	args := []string{"-C", j.gitDir, "log", "--no-merges", "--format=%h%x09%an%x09%s", "--end-of-options", lastGreen + ".." + j.BuildTag}
+	if path != "" {
+		args = append(args, "--", path)
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "git log failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	s := &suspectCommits{LastGreen: lastGreen, Path: path, Commits: []commit{}}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if len(s.Commits) >= j.suspectCommitsMax {
+			s.More++
+			continue
+		}
+		s.Commits = append(s.Commits, commit{Hash: fields[0], Author: fields[1], Subject: fields[2]})
+	}
+	return s, scanner.Err()
+}
+
+// goModulePath returns the module path from go.mod in dir, or nothing if it is not a Go module.
+func goModulePath(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if module, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(module), `"`)
+		}
+	}
+	return ""
+}
+
+// goPackageDir returns the directory of a Go test suite (its package) relative to the module root.
+func goPackageDir(module, suite string) string {
+	if module == "" {
+		return ""
+	}
+	if suite == module {
+		return "."
+	}
+	dir, _ := strings.CutPrefix(suite, module+"/")
+	if dir == suite {
+		return ""
+	}
+	return dir
+}
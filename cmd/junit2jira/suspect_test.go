@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/joshdk/go-junit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGitRepo(t *testing.T) string {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=Dev", "GIT_AUTHOR_EMAIL=dev@example.com", "GIT_COMMITTER_NAME=Dev", "GIT_COMMITTER_EMAIL=dev@example.com")
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	commit := func(file, msg string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(msg), 0644))
+		git("add", "-A")
+		git("commit", "-q", "-m", msg)
+	}
+	git("init", "-q")
+	commit("go.mod", "module github.com/stackrox/rox\n")
+	git("tag", "1.0.0")
+	commit("pkg/grpc/server.go", "Change grpc")
+	commit("pkg/other/other.go", "Change other")
+	commit("pkg/grpc/client.go", "Change grpc client")
+	git("tag", "1.0.1")
+	return dir
+}
+
+func TestSuspectCommits(t *testing.T) {
+	dir := newGitRepo(t)
+	historyFile := filepath.Join(t.TempDir(), "green.json")
+	require.NoError(t, os.WriteFile(historyFile, []byte(`{"github.com/stackrox/rox/pkg/grpc / TestServer": "1.0.0"}`), 0644))
+
+	j := junit2jira{params: params{
+		BuildTag:             "1.0.1",
+		gitDir:               dir,
+		greenHistoryFile:     historyFile,
+		suspectPackageFilter: true,
+		suspectCommitsMax:    1,
+	}}
+	tests := j.addSuspectCommits([]j2jTestCase{
+		{Suite: "github.com/stackrox/rox/pkg/grpc", Name: "TestServer", BuildTag: "1.0.1"},
+		{Suite: "github.com/stackrox/rox/pkg/grpc", Name: "TestUnknown"},
+	})
+
+	s := tests[0].SuspectCommits
+	require.NotNil(t, s)
+	assert.Equal(t, "pkg/grpc", s.Path)
+	assert.Len(t, s.Commits, 1)
+	assert.Equal(t, "Change grpc client", s.Commits[0].Subject)
+	assert.Equal(t, "Dev", s.Commits[0].Author)
+	assert.Equal(t, 1, s.More)
+	assert.Equal(t, "2 commits between the last green build 1.0.0 and 1.0.1 touching pkg/grpc", s.title(tests[0].BuildTag))
+	assert.Nil(t, tests[1].SuspectCommits)
+
+	adf := tests[0].buildADFDescription()
+	assert.Equal(t, "Suspect Commits", adf.Content[0].Content[0].Text)
+	assert.Equal(t, "bulletList", adf.Content[2].Type)
+
+	attachment, err := failureToAttachment("title", j2jTestCase{Message: "failed", SuspectCommits: s, BuildTag: "1.0.1"})
+	require.NoError(t, err)
+	assert.Len(t, attachment.Blocks.BlockSet, 5)
+
+	j.lastGreenTag = "1.0.0"
+	j.suspectPackageFilter = false
+	j.suspectCommitsMax = 20
+	tests = j.addSuspectCommits([]j2jTestCase{{Suite: "DefaultPoliciesTest", Name: "TestUnknown"}})
+	assert.Len(t, tests[0].SuspectCommits.Commits, 3)
+	assert.Empty(t, tests[0].SuspectCommits.Path)
+}
+
+func TestSuspectCommitsErrors(t *testing.T) {
+	dir := newGitRepo(t)
+	output := filepath.Join(t.TempDir(), "output")
+	historyFile := filepath.Join(t.TempDir(), "green.json")
+	require.NoError(t, os.WriteFile(historyFile, []byte("not json"), 0644))
+	j := junit2jira{params: params{
+		BuildTag:          "1.0.1",
+		gitDir:            dir,
+		greenHistoryFile:  historyFile,
+		lastGreenTag:      "--output=" + output,
+		suspectCommitsMax: 20,
+	}}
+
+	tests := j.addSuspectCommits([]j2jTestCase{{Suite: "a", Name: "TestA"}})
+	assert.Nil(t, tests[0].SuspectCommits)
+	// Without --end-of-options git would write the log to the file named by the range.
+	assert.NoFileExists(t, output+"..1.0.1")
+}
+
+func TestRecordGreenTests(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "green.json")
+	require.NoError(t, os.WriteFile(historyFile, []byte(`{"a / TestOld": "1.0.0", "a / TestFail": "1.0.0"}`), 0644))
+
+	j := junit2jira{params: params{BuildTag: "1.0.1", greenHistoryFile: historyFile}}
+	require.NoError(t, j.recordGreenTests([]junit.Suite{{
+		Tests: []junit.Test{
+			{Classname: "a", Name: "TestFail", Status: junit.StatusFailed},
+		},
+		Suites: []junit.Suite{{Tests: []junit.Test{
+			{Classname: "a", Name: "TestPass", Status: junit.StatusPassed},
+		}}},
+	}}))
+
+	h, err := loadGreenHistory(historyFile)
+	require.NoError(t, err)
+	assert.Equal(t, greenHistory{"a / TestOld": "1.0.0", "a / TestFail": "1.0.0", "a / TestPass": "1.0.1"}, h)
+}
+
+func TestRecordGreenTestsCorruptHistory(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "green.json")
+	require.NoError(t, os.WriteFile(historyFile, []byte(`{"a / TestOld":`), 0644))
+
+	j := junit2jira{params: params{BuildTag: "1.0.1", greenHistoryFile: historyFile}}
+	require.NoError(t, j.recordGreenTests([]junit.Suite{{Tests: []junit.Test{
+		{Classname: "a", Name: "TestPass", Status: junit.StatusPassed},
+	}}}))
+
+	h, err := loadGreenHistory(historyFile)
+	require.NoError(t, err)
+	assert.Equal(t, greenHistory{"a / TestPass": "1.0.1"}, h)
+}
+
+func TestGoPackageDir(t *testing.T) {
+	assert.Equal(t, "pkg/grpc", goPackageDir("github.com/stackrox/rox", "github.com/stackrox/rox/pkg/grpc"))
+	assert.Equal(t, ".", goPackageDir("github.com/stackrox/rox", "github.com/stackrox/rox"))
+	assert.Empty(t, goPackageDir("github.com/stackrox/rox", "github.com/stackrox/roxctl"))
+	assert.Empty(t, goPackageDir("", "github.com/stackrox/rox/pkg/grpc"))
+}
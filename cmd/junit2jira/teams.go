@@ -0,0 +1,142 @@
+package main
+
+import "fmt"
+
+const (
+	teamsWebhookEnv = "TEAMS_WEBHOOK_URL"
+	// Teams rejects messages larger than 28 KB, some room is left for the envelope of the card.
+	teamsMaxMessageSize = 25000
+	teamsTextLimit      = 3000
+)
+
+// teamsNotifier renders the digest as an Adaptive Card for Microsoft Teams workflows and incoming webhooks.
+type teamsNotifier struct{}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsCard struct {
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []teamsElement    `json:"body"`
+	Actions []teamsAction     `json:"actions,omitempty"`
+	MSTeams map[string]string `json:"msteams,omitempty"`
+}
+
+// teamsElement is a TextBlock or a FactSet.
+type teamsElement struct {
+	Type      string      `json:"type"`
+	Text      string      `json:"text,omitempty"`
+	Size      string      `json:"size,omitempty"`
+	Weight    string      `json:"weight,omitempty"`
+	FontType  string      `json:"fontType,omitempty"`
+	IsSubtle  bool        `json:"isSubtle,omitempty"`
+	Separator bool        `json:"separator,omitempty"`
+	Wrap      bool        `json:"wrap,omitempty"`
+	Facts     []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type teamsAction struct {
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+func (teamsNotifier) name() string {
+	return "teams"
+}
+
+func (teamsNotifier) webhookEnv() string {
+	return teamsWebhookEnv
+}
+
+func (teamsNotifier) render(d chatDigest) []any {
+	body := []teamsElement{{Type: "TextBlock", Text: "Failed tests", Size: "Large", Weight: "Bolder"}}
+	if context := d.buildContext(markdownEscape, markdownLink); context != "" {
+		body = append(body, teamsElement{Type: "TextBlock", Text: context, IsSubtle: true, Wrap: true})
+	}
+	facts := []teamsFact{
+		{Title: "Failed", Value: fmt.Sprint(d.failed)},
+		{Title: "New issues", Value: fmt.Sprint(d.newIssues)},
+		{Title: "Existing issues", Value: fmt.Sprint(d.existingIssues)},
+	}
+	if d.total > 0 {
+		facts = append([]teamsFact{{Title: "Total", Value: fmt.Sprint(d.total)}}, facts...)
+	}
+	body = append(body, teamsElement{Type: "FactSet", Facts: facts})
+
+	for _, suite := range d.suites {
+		body = append(body, teamsElement{Type: "TextBlock", Text: markdownEscape(orDefault(suite.name, "No suite")), Weight: "Bolder", Separator: true, Wrap: true})
+		var lines []string
+		for _, f := range suite.failures {
+			lines = append(lines, "- "+f.line(markdownEscape, markdownLink))
+		}
+		for _, text := range joinLines(lines, teamsTextLimit) {
+			body = append(body, teamsElement{Type: "TextBlock", Text: text, Wrap: true})
+		}
+	}
+	if d.more > 0 {
+		body = append(body, teamsElement{Type: "TextBlock", Text: d.moreText(markdownLink), Wrap: true})
+	}
+
+	for _, f := range d.details {
+		message, value := failureTexts(f.testCase, teamsTextLimit)
+		if message == "" && value == "" {
+			continue
+		}
+		title := markdownEscape(f.title())
+		if f.issueURL != "" {
+			title = markdownLink(f.issueURL, title)
+		}
+		body = append(body, teamsElement{Type: "TextBlock", Text: title, Weight: "Bolder", Separator: true, Wrap: true})
+		for _, text := range []string{message, value} {
+			if text != "" {
+				body = append(body, teamsElement{Type: "TextBlock", Text: markdownEscape(text), FontType: "Monospace", Wrap: true})
+			}
+		}
+	}
+
+	var actions []teamsAction
+	if d.buildLink != "" {
+		actions = append(actions, teamsAction{Type: "Action.OpenUrl", Title: "Open build", URL: d.buildLink})
+	}
+	if d.reportLink != "" {
+		actions = append(actions, teamsAction{Type: "Action.OpenUrl", Title: "Open HTML report", URL: d.reportLink})
+	}
+
+	parts := splitBySize(body, teamsMaxMessageSize-jsonSize(actions), len(body))
+	messages := make([]any, 0, len(parts))
+	for n, part := range parts {
+		card := teamsCard{
+			Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+			Type:    "AdaptiveCard",
+			Version: "1.4",
+			Body:    part,
+			MSTeams: map[string]string{"width": "Full"},
+		}
+		if n == 0 {
+			card.Actions = actions
+		}
+		messages = append(messages, teamsMessage{
+			Type: "message",
+			Attachments: []teamsAttachment{{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content:     card,
+			}},
+		})
+	}
+	return messages
+}
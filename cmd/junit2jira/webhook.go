@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	webhookSecretEnv = "WEBHOOK_SECRET"
+	// webhookSignatureHeader is the hex encoded HMAC-SHA256 of the body with WEBHOOK_SECRET, prefixed by sha256=.
+	webhookSignatureHeader = "X-Junit2jira-Signature-256"
+
+	// webhookMaxRetries is the number of times a request is retried after it failed or was rate limited.
+	webhookMaxRetries = 5
+	webhookTimeout    = time.Minute
+	// webhookMaxRetryAfter is the longest Retry-After waited for, a webhook asking for more fails the request.
+	webhookMaxRetryAfter = webhookTimeout
+)
+
+// webhookRetryDelay is the delay before the first retry of a failed request, it doubles with each retry.
+var webhookRetryDelay = time.Second
+
+// webhookRun is the run as seen by webhook templates.
+type webhookRun struct {
+	JobName        string
+	BuildId        string
+	BuildLink      string
+	BuildTag       string
+	Orchestrator   string
+	Timestamp      string
+	JiraURL        string
+	HTMLReportLink string
+	// Total is 0 if no test was found in the reports.
+	Total          int
+	Failed         int
+	NewIssues      int
+	ExistingIssues int
+	Failures       []webhookFailure
+}
+
+// webhookFailure is a failed test with the issue it was filed in, if any.
+type webhookFailure struct {
+	j2jTestCase
+	Decision string
+	Issue    string
+	IssueURL string
+	NewJIRA  bool
+	SlackTs  string
+}
+
+func (j junit2jira) webhookRun(issues []*testIssue) webhookRun {
+	run := webhookRun{
+		JobName:        j.JobName,
+		BuildId:        j.BuildId,
+		BuildLink:      j.BuildLink,
+		BuildTag:       j.BuildTag,
+		Orchestrator:   j.Orchestrator,
+		Timestamp:      j.timestamp,
+		HTMLReportLink: j.htmlReportLink,
+		Total:          j.stats.Total,
+		Failed:         max(j.stats.Failed, len(issues)),
+		Failures:       make([]webhookFailure, 0, len(issues)),
+	}
+	if j.jiraUrl != nil {
+		run.JiraURL = j.jiraUrl.String()
+	}
+	for _, i := range issues {
+		f := webhookFailure{j2jTestCase: i.testCase, Decision: i.decision, NewJIRA: i.newJIRA, SlackTs: i.slackTs}
+		if i.issue != nil {
+			f.Issue = i.issue.Key
+			f.IssueURL = j.issueURL(i.issue.Key)
+			if i.newJIRA {
+				run.NewIssues++
+			} else {
+				run.ExistingIssues++
+			}
+		}
+		run.Failures = append(run.Failures, f)
+	}
+	return run
+}
+
+// webhookFuncs are available in webhook templates in addition to the builtin functions.
+var webhookFuncs = template.FuncMap{
+	// json quotes a value for a JSON body, e.g. {"name": {{ json .Name }}}.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"truncate": func(limit int, s string) string {
+		return crop(s, limit)
+	},
+	"join": func(sep string, s []string) string {
+		return strings.Join(s, sep)
+	},
+}
+
+func loadWebhookTemplate(fileName string) (*template.Template, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("read webhook template: %s", fileName))
+	}
+	t, err := template.New(fileName).Funcs(webhookFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("parse webhook template: %s", fileName))
+	}
+	return t, nil
+}
+
+func validateWebhookParams(p params) error {
+	if p.webhook != "" && p.webhookTemplate == "" {
+		return errors.New("-webhook-template is required for -webhook")
+	}
+	if p.webhook == "" && p.webhookTemplate != "" {
+		return errors.New("-webhook is required for -webhook-template")
+	}
+	for _, h := range p.webhookHeaders {
+		if name, secretName, ok := strings.Cut(h, "="); !ok || name == "" || secretName == "" {
+			return fmt.Errorf("invalid webhook header %q, expected Name=SECRET_NAME", h)
+		}
+	}
+	return nil
+}
+
+// isURL tells whether the webhook output is posted to rather than written to a file.
+func isURL(output string) bool {
+	return strings.HasPrefix(output, "http://") || strings.HasPrefix(output, "https://")
+}
+
+// sendWebhook renders the run with the webhook template and posts it to -webhook or writes it to a file.
+// Unlike chat messages, it is also sent when no test failed.
+func (j junit2jira) sendWebhook(issues []*testIssue) error {
+	if j.webhookTmpl == nil {
+		return nil
+	}
+	var body bytes.Buffer
+	if err := j.webhookTmpl.Execute(&body, j.webhookRun(issues)); err != nil {
+		return errors.Wrap(err, "could not render webhook template")
+	}
+
+	switch {
+	case j.webhook == "-":
+		_, err := os.Stdout.Write(body.Bytes())
+		return errors.Wrap(err, "could not write webhook body")
+	case !isURL(j.webhook):
+		if err := os.WriteFile(j.webhook, body.Bytes(), 0644); err != nil {
+			return fmt.Errorf("could not create file %q: %w", j.webhook, err)
+		}
+		return nil
+	case j.dryRun:
+		log.Infof("Dry run: would post %d failures to the webhook", len(issues))
+		return nil
+	}
+
+	header, err := j.webhookHeader(body.Bytes())
+	if err != nil {
+		return err
+	}
+	httpClient, err := j.transport.NewClient()
+	if err != nil {
+		return errors.Wrap(err, "could not create HTTP client")
+	}
+	if err := postWebhook(httpClient, j.webhook, body.Bytes(), header); err != nil {
+		return err
+	}
+	log.Infof("Posted %d failures to the webhook", len(issues))
+	return nil
+}
+
+// webhookHeader returns the headers of -webhook-header read from secrets and the signature of body if
+// WEBHOOK_SECRET is set.
+func (j junit2jira) webhookHeader(body []byte) (http.Header, error) {
+	header := http.Header{"Content-Type": {"application/json"}}
+	for _, h := range j.webhookHeaders {
+		name, secretName, _ := strings.Cut(h, "=")
+		value, err := secret(secretName, j.secretsDir)
+		if err != nil {
+			return nil, err
+		}
+		if value == "" {
+			return nil, fmt.Errorf("%s is required for the webhook header %s", secretName, name)
+		}
+		header.Set(name, value)
+	}
+
+	key, err := secret(webhookSecretEnv, j.secretsDir)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		header.Set(webhookSignatureHeader, signWebhook(key, body))
+	}
+	return header, nil
+}
+
+func signWebhook(key string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryableError is a request that failed but can be sent again.
+type retryableError struct {
+	err error
+	// rateLimited is set if the webhook asked to retry after retryAfter. Other requests are retried after
+	// an increasing delay.
+	rateLimited bool
+	retryAfter  time.Duration
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// postWebhook posts body to a webhook. Rate limited requests are retried after the delay requested in the
+// Retry-After header, requests that failed with a server or connection error after an increasing delay.
+func postWebhook(client *http.Client, webhookURL string, body []byte, header http.Header) error {
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := postWebhookOnce(client, webhookURL, body, header)
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || attempt >= webhookMaxRetries {
+			return err
+		}
+		wait := retryable.retryAfter
+		if !retryable.rateLimited {
+			wait = delay
+			delay *= 2
+		}
+		log.WithError(err).Warnf("Webhook request failed, retrying in %s", wait)
+		time.Sleep(wait)
+	}
+}
+
+// retryAfter returns the delay of a Retry-After header given in seconds or as an HTTP date, or one second if
+// the header is missing or invalid.
+func retryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return time.Second
+}
+
+// webhookOrigin returns the scheme and host of a webhook URL. Webhook URLs often carry their credential in the
+// path or query, so only this part is shown in errors and logs.
+func webhookOrigin(webhookURL string) string {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Host == "" {
+		return "(invalid URL)"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// withoutWebhookURL replaces the full URL in errors of the HTTP client by its origin.
+func withoutWebhookURL(err error, webhookURL string) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	return &url.Error{Op: urlErr.Op, URL: webhookOrigin(webhookURL), Err: urlErr.Err}
+}
+
+func postWebhookOnce(client *http.Client, webhookURL string, body []byte, header http.Header) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(withoutWebhookURL(err, webhookURL), "could not create request")
+	}
+	req.Header = header.Clone()
+	resp, err := client.Do(req)
+	if err != nil {
+		return &retryableError{err: errors.Wrap(withoutWebhookURL(err, webhookURL), "could not post to webhook")}
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("webhook answered %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		wait := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if wait > webhookMaxRetryAfter {
+			return errors.Wrapf(err, "webhook asked to retry after %s, more than %s", wait, webhookMaxRetryAfter)
+		}
+		return &retryableError{err: err, rateLimited: true, retryAfter: wait}
+	case resp.StatusCode >= 500:
+		return &retryableError{err: err}
+	default:
+		return err
+	}
+}
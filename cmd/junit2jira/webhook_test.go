@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ctreminiom/go-atlassian/v2/pkg/infra/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const webhookTestTemplate = "testdata/webhook/dashboard.tmpl"
+
+func webhookTestIssues() []*testIssue {
+	return []*testIssue{
+		{issue: &models.IssueScheme{Key: "ROX-1"}, newJIRA: true, testCase: j2jTestCase{Suite: "a", Name: "TestA", Message: strings.Repeat("x", 200)}},
+		{testCase: j2jTestCase{Suite: "b", Name: `Test"B"`, Message: "boom"}},
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+
+	tmpl, err := loadWebhookTemplate(webhookTestTemplate)
+	require.NoError(t, err)
+
+	var bodies [][]byte
+	var headers []http.Header
+	answers := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, body)
+		headers = append(headers, r.Header)
+		if answers[0] == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(answers[0])
+		answers = answers[1:]
+	}))
+	defer server.Close()
+	t.Setenv("DASHBOARD_TOKEN", "Bearer token")
+	t.Setenv(webhookSecretEnv, "signing-key")
+
+	j := junit2jira{
+		params:      params{webhook: server.URL, webhookHeaders: stringList{"Authorization=DASHBOARD_TOKEN"}, JobName: "nightly", BuildId: "42"},
+		stats:       runStats{Total: 10, Failed: 2},
+		webhookTmpl: tmpl,
+	}
+	require.NoError(t, j.sendWebhook(webhookTestIssues()))
+
+	require.Len(t, bodies, 3)
+	assert.Equal(t, bodies[0], bodies[2])
+	var run struct {
+		Job       string
+		Build     string
+		Total     int
+		Failed    int
+		NewIssues int
+		Failures  []struct {
+			Test    string
+			Issue   string
+			New     bool
+			Message string
+		}
+	}
+	require.NoError(t, json.Unmarshal(bodies[2], &run))
+	assert.Equal(t, "nightly", run.Job)
+	assert.Equal(t, "42", run.Build)
+	assert.Equal(t, 10, run.Total)
+	assert.Equal(t, 2, run.Failed)
+	assert.Equal(t, 1, run.NewIssues)
+	require.Len(t, run.Failures, 2)
+	assert.Equal(t, "a / TestA", run.Failures[0].Test)
+	assert.Equal(t, "ROX-1", run.Failures[0].Issue)
+	assert.True(t, run.Failures[0].New)
+	assert.Equal(t, strings.Repeat("x", 99)+"…", run.Failures[0].Message)
+	assert.Equal(t, `b / Test"B"`, run.Failures[1].Test)
+	assert.Empty(t, run.Failures[1].Issue)
+
+	h := headers[2]
+	assert.Equal(t, "application/json", h.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", h.Get("Authorization"))
+	assert.Equal(t, signWebhook("signing-key", bodies[2]), h.Get(webhookSignatureHeader))
+	assert.True(t, strings.HasPrefix(h.Get(webhookSignatureHeader), "sha256="))
+
+	t.Run("client error", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}))
+		defer server.Close()
+		j.webhook = server.URL
+		assert.ErrorContains(t, j.sendWebhook(webhookTestIssues()), "webhook answered 400 Bad Request: bad request")
+		assert.Equal(t, 1, requests)
+	})
+	t.Run("connection error hides the webhook URL", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		j.webhook = server.URL + "/runs?token=secret"
+		err := j.sendWebhook(webhookTestIssues())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `Post "`+server.URL+`"`)
+		assert.NotContains(t, err.Error(), "secret")
+	})
+	t.Run("missing header secret", func(t *testing.T) {
+		t.Setenv("DASHBOARD_TOKEN", "")
+		j.webhook = server.URL
+		assert.ErrorContains(t, j.sendWebhook(webhookTestIssues()), "DASHBOARD_TOKEN is required for the webhook header Authorization")
+	})
+	t.Run("file", func(t *testing.T) {
+		j.webhook = filepath.Join(t.TempDir(), "webhook.json")
+		require.NoError(t, j.sendWebhook(nil))
+		data, err := os.ReadFile(j.webhook)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"job":"nightly","build":"42","total":10,"failed":2,"newIssues":0,"failures":[]}`, string(data))
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 2500*time.Millisecond, retryAfter("2.5", now))
+	assert.Equal(t, 30*time.Second, retryAfter("Sun, 18 Oct 2026 12:00:30 GMT", now))
+	assert.Equal(t, time.Duration(0), retryAfter("Sun, 18 Oct 2026 11:00:00 GMT", now))
+	assert.Equal(t, time.Second, retryAfter("", now))
+	assert.Equal(t, time.Second, retryAfter("-1", now))
+}
+
+func TestPostWebhookRetryAfterTooLong(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "86400")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	err := postWebhook(server.Client(), server.URL, []byte("{}"), http.Header{})
+	assert.ErrorContains(t, err, "webhook asked to retry after 24h0m0s, more than 1m0s: webhook answered 429 Too Many Requests")
+	assert.Equal(t, 1, requests)
+}
+
+func TestLoadWebhookTemplate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "broken.tmpl")
+	require.NoError(t, os.WriteFile(name, []byte(`{"job": {{ .JobName }`), 0644))
+	_, err := loadWebhookTemplate(name)
+	assert.ErrorContains(t, err, "parse webhook template")
+}
+
+func TestValidateWebhookParams(t *testing.T) {
+	assert.NoError(t, validateWebhookParams(params{}))
+	assert.NoError(t, validateWebhookParams(params{webhook: "-", webhookTemplate: "t.tmpl", webhookHeaders: stringList{"Authorization=TOKEN"}}))
+	assert.ErrorContains(t, validateWebhookParams(params{webhook: "-"}), "-webhook-template is required")
+	assert.ErrorContains(t, validateWebhookParams(params{webhookTemplate: "t.tmpl"}), "-webhook is required")
+	assert.ErrorContains(t, validateWebhookParams(params{webhook: "-", webhookTemplate: "t.tmpl", webhookHeaders: stringList{"Authorization"}}), `invalid webhook header "Authorization"`)
+}
+
+func TestWebhookOrigin(t *testing.T) {
+	assert.Equal(t, "https://hooks.example.com", webhookOrigin("https://hooks.example.com/services/T0/B0/secret?token=secret"))
+	assert.Equal(t, "(invalid URL)", webhookOrigin("://secret"))
+
+	_, err := http.NewRequest(http.MethodPost, "https://hooks.example.com/%zz?token=secret", nil)
+	require.Error(t, err)
+	assert.NotContains(t, withoutWebhookURL(err, "https://hooks.example.com/%zz?token=secret").Error(), "secret")
+}
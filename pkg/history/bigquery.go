@@ -0,0 +1,98 @@
+package history
+
+import (
+	"cloud.google.com/go/bigquery"
+	"context"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/stackrox/junit2jira/pkg/transport"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+	"net/http"
+	"time"
+)
+
+const projectID = "acs-san-stackroxci"
+
+// RecentWindow is the time range covered by the recent flaky tests view read by GetRatioForTest.
+// The view is not filtered by date in the query, so the range has to be changed together with the view.
+const RecentWindow = "last 30 days"
+const queryTimeout = 1 * time.Minute
+const queryStrGetFailureRatio = `
+SELECT
+    TotalAll,
+    FailRatio
+FROM
+` + "`acs-san-stackroxci.ci_metrics.stackrox_tests__recent_flaky_tests`" + `
+WHERE
+    JobName = @jobName
+    AND Classname = @className
+    AND Name = @testName
+`
+
+type recentFlakyTestInfo struct {
+	TotalAll  int
+	FailRatio int
+}
+
+// Client reads the recent history of tests.
+type Client interface {
+	// GetRatioForTest returns the number of recent runs of a test and the percentage of failed runs.
+	GetRatioForTest(jobName, className, testName string) (int, int, error)
+}
+
+type bigQueryClient struct {
+	client *bigquery.Client
+}
+
+// NewBigQueryClient returns a client of the CI metrics in BigQuery.
+func NewBigQueryClient(transportOptions transport.Options) (Client, error) {
+	ctx := context.Background()
+
+	base, err := transportOptions.NewTransport()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating HTTP transport")
+	}
+	// The authenticated transport has to wrap ours, because a custom HTTP client disables authentication.
+	authenticated, err := htransport.NewTransport(ctx, base, option.WithScopes(bigquery.Scope))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating BigQuery transport")
+	}
+	httpClient := &http.Client{Transport: authenticated, Timeout: transportOptions.RequestTimeout}
+
+	client, err := bigquery.NewClient(ctx, projectID, option.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating BigQuery client")
+	}
+
+	return &bigQueryClient{client: client}, nil
+}
+
+func (c *bigQueryClient) GetRatioForTest(jobName, className, testName string) (int, int, error) {
+	query := c.client.Query(queryStrGetFailureRatio)
+	query.Parameters = []bigquery.QueryParameter{
+		{Name: "jobName", Value: jobName},
+		{Name: "className", Value: className},
+		{Name: "testName", Value: testName},
+	}
+
+	ctx, cancelBigQueryRequest := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancelBigQueryRequest()
+
+	resIter, err := query.Read(ctx)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "query data from BigQuery")
+	}
+
+	// We need only first flakyTestInfo. No need to loop over iterator.
+	var flakyTestInfo recentFlakyTestInfo
+	if errNext := resIter.Next(&flakyTestInfo); errNext != nil {
+		return 0, 0, errors.Wrapf(errNext, "read BigQuery result for flaky test for query params: %v - query: %s", query.Parameters, queryStrGetFailureRatio)
+	}
+
+	if resIter.TotalRows > 1 {
+		log.Warnf("Expected to find one row in DB, but got more for query params: %v - query: %s", query.Parameters, queryStrGetFailureRatio)
+	}
+
+	return flakyTestInfo.TotalAll, flakyTestInfo.FailRatio, nil
+}
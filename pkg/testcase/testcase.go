@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/joshdk/go-junit"
 	"slices"
+	"strconv"
 	"strings"
 )
 
@@ -20,6 +21,9 @@ type TestCase struct {
 	Stderr    string
 	Error     string
 	IsSubtest bool
+	// File and Line are the location of the test, if provided by the reporter.
+	File string
+	Line int
 }
 
 type ignoreTestCase struct {
@@ -116,6 +120,10 @@ func NewTestCase(tc junit.Test) TestCase {
 		Stdout:    tc.SystemOut,
 		Stderr:    tc.SystemErr,
 		Suite:     tc.Classname,
+		File:      tc.Properties["file"],
+	}
+	if line, err := strconv.Atoi(tc.Properties["line"]); err == nil {
+		c.Line = line
 	}
 
 	if tc.Error != nil {
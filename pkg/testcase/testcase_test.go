@@ -408,3 +408,17 @@ func Test_addFallbacks(t *testing.T) {
 		})
 	}
 }
+
+func Test_NewTestCaseLocation(t *testing.T) {
+	tc := NewTestCase(junit.Test{
+		Name:       "test",
+		Classname:  "class",
+		Properties: map[string]string{"file": "src/test/Class.java", "line": "42"},
+	})
+	assert.Equal(t, "src/test/Class.java", tc.File)
+	assert.Equal(t, 42, tc.Line)
+
+	tc = NewTestCase(junit.Test{Name: "test", Properties: map[string]string{"line": "unknown"}})
+	assert.Empty(t, tc.File)
+	assert.Zero(t, tc.Line)
+}
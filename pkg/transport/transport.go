@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// start is used as the beginning of the overall timeout, so it is shared by all clients of the process.
+var start = time.Now()
+
+// Options configure all outgoing HTTP connections of the tools.
+type Options struct {
+	// CABundle is a PEM file with additional trusted certificate authorities.
+	CABundle string
+	// ClientCert and ClientKey are PEM files used for mutual TLS.
+	ClientCert string
+	ClientKey  string
+	// Proxy is the URL of an HTTP(S) proxy. If empty, the proxy is taken from the environment.
+	Proxy string
+	// RequestTimeout limits a single request including reading the response body.
+	RequestTimeout time.Duration
+	// OverallTimeout limits the time from start of the process until the last request finishes.
+	OverallTimeout time.Duration
+}
+
+// AddFlags registers flags for all options.
+func (o *Options) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.CABundle, "ca-bundle", "", "PEM file with additional CA certificates trusted for outgoing connections")
+	fs.StringVar(&o.ClientCert, "client-cert", "", "PEM client certificate for mutual TLS")
+	fs.StringVar(&o.ClientKey, "client-key", "", "PEM client key for mutual TLS")
+	fs.StringVar(&o.Proxy, "proxy", "", "HTTP(S) proxy URL for outgoing connections (default from HTTPS_PROXY/HTTP_PROXY/NO_PROXY)")
+	fs.DurationVar(&o.RequestTimeout, "request-timeout", 2*time.Minute, "Timeout of a single outgoing request (0 to disable)")
+	fs.DurationVar(&o.OverallTimeout, "overall-timeout", 0, "Time limit for all outgoing requests counted from start (0 to disable)")
+}
+
+// NewTransport returns a transport configured with the options. It does not apply the request timeout.
+func (o Options) NewTransport() (http.RoundTripper, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if o.Proxy != "" {
+		proxy, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy %q", o.Proxy)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig, err := o.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		t.TLSClientConfig = tlsConfig
+	}
+
+	if o.OverallTimeout > 0 {
+		return &deadlineTransport{base: t, deadline: start.Add(o.OverallTimeout)}, nil
+	}
+	return t, nil
+}
+
+// TLSConfig returns the TLS configuration for the CA bundle and client certificate, or nil if none is set.
+// It is also used for connections other than HTTP, like SMTP.
+func (o Options) TLSConfig() (*tls.Config, error) {
+	if o.CABundle == "" && o.ClientCert == "" && o.ClientKey == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(o.CABundle)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read CA bundle")
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", o.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if o.ClientCert != "" || o.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// NewClient returns a client configured with the options.
+func (o Options) NewClient() (*http.Client, error) {
+	t, err := o.NewTransport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: t,
+		Timeout:   o.RequestTimeout,
+	}, nil
+}
+
+// deadlineTransport fails all requests that do not finish before the deadline.
+type deadlineTransport struct {
+	base     http.RoundTripper
+	deadline time.Time
+}
+
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithDeadline(req.Context(), t.deadline)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(err, "overall timeout exceeded")
+		}
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the request context once the response body is consumed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := Options{}.NewClient()
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.ErrorContains(t, err, "certificate")
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	client, err = Options{CABundle: bundle}.NewClient()
+	require.NoError(t, err)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("no certificates"), 0600))
+	_, err = Options{CABundle: empty}.NewClient()
+	assert.ErrorContains(t, err, "no certificates found in CA bundle")
+}
+
+func TestClientCertificate(t *testing.T) {
+	_, err := Options{ClientCert: "missing.pem", ClientKey: "missing-key.pem"}.NewClient()
+	assert.ErrorContains(t, err, "could not load client certificate")
+}
+
+func TestProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := Options{Proxy: proxy.URL}.NewClient()
+	require.NoError(t, err)
+	resp, err := client.Get("http://jira.example.com/rest/api/3/myself")
+	require.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, "http://jira.example.com/rest/api/3/myself", proxied)
+
+	_, err = Options{Proxy: "://"}.NewClient()
+	assert.ErrorContains(t, err, "invalid proxy")
+}
+
+func TestTimeouts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client, err := Options{RequestTimeout: 50 * time.Millisecond}.NewClient()
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.ErrorContains(t, err, "Client.Timeout exceeded")
+
+	client, err = Options{OverallTimeout: time.Since(start) + 50*time.Millisecond}.NewClient()
+	require.NoError(t, err)
+	_, err = client.Get(server.URL)
+	assert.ErrorContains(t, err, "overall timeout exceeded")
+
+	client, err = Options{OverallTimeout: time.Hour}.NewClient()
+	require.NoError(t, err)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+}